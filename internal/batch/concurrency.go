@@ -0,0 +1,187 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"RealityChecker/internal/network"
+	"RealityChecker/internal/types"
+)
+
+// AIMD调整参数
+const (
+	raiseBelowFailureRate = 0.1  // 一轮检测的超时和失败率低于该值时并发上限加1
+	backoffFailureRate    = 0.25 // 一轮检测的超时和失败率超过该值时并发上限减半
+	minAdjustWindow       = 4    // 每轮至少完成的检测数
+	initialLimit          = 4    // 自适应模式的初始并发上限，不超过配置的最大并发数
+)
+
+// ConcurrencyController 批量检测的并发控制器
+// 自适应模式按AIMD调整并发上限：从较低的上限开始，每完成一轮检测（不少于当前上限个）评估一次，
+// 超时和失败率低时加1，升高时减半，上限在1和配置的最大并发数之间；固定模式始终使用最大并发数
+type ConcurrencyController struct {
+	adaptive bool
+	max      int
+
+	mu       sync.Mutex
+	limit    int
+	active   int
+	changed  chan struct{} // 有检测完成或上限变化时关闭并替换，唤醒等待的检测
+	window   int           // 本轮完成的检测数
+	failures int           // 本轮超时和失败的检测数
+
+	stats      types.ConcurrencyStats
+	lastChange time.Time
+	activeArea float64 // 同时进行的检测数对时间的积分（秒）
+	startTime  time.Time
+}
+
+// NewConcurrencyController 创建并发控制器
+func NewConcurrencyController(config types.ConcurrencyConfig) *ConcurrencyController {
+	max := config.MaxConcurrent
+	if max <= 0 {
+		max = 1
+	}
+	initial := initialLimit
+	if config.Fixed || initial > max {
+		initial = max
+	}
+
+	now := time.Now()
+	return &ConcurrencyController{
+		adaptive: !config.Fixed,
+		max:      max,
+		limit:    initial,
+		changed:  make(chan struct{}),
+		stats: types.ConcurrencyStats{
+			Adaptive: !config.Fixed,
+			Initial:  initial,
+			Lowest:   initial,
+			Highest:  initial,
+		},
+		lastChange: now,
+		startTime:  now,
+	}
+}
+
+// Acquire 等待并发名额
+func (cc *ConcurrencyController) Acquire(ctx context.Context) error {
+	for {
+		cc.mu.Lock()
+		if cc.active < cc.limit {
+			cc.accumulate()
+			cc.active++
+			if cc.active > cc.stats.Peak {
+				cc.stats.Peak = cc.active
+			}
+			cc.mu.Unlock()
+			return nil
+		}
+		changed := cc.changed
+		cc.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release 释放并发名额，并按检测结果调整并发上限；缓存结果不参与调整
+func (cc *ConcurrencyController) Release(result *types.DetectionResult, err error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.accumulate()
+	cc.active--
+	if cc.adaptive && (result == nil || !result.Cached) {
+		cc.window++
+		if overloaded(result, err) {
+			cc.failures++
+		}
+		cc.adjust()
+	}
+	close(cc.changed)
+	cc.changed = make(chan struct{})
+}
+
+// adjust 一轮检测完成后按超时和失败率调整并发上限
+func (cc *ConcurrencyController) adjust() {
+	window := cc.limit
+	if window < minAdjustWindow {
+		window = minAdjustWindow
+	}
+	if cc.window < window {
+		return
+	}
+
+	rate := float64(cc.failures) / float64(cc.window)
+	cc.window, cc.failures = 0, 0
+
+	limit := cc.limit
+	switch {
+	case rate > backoffFailureRate:
+		limit = cc.limit / 2
+		if limit < 1 {
+			limit = 1
+		}
+	case rate < raiseBelowFailureRate && cc.limit < cc.max:
+		limit = cc.limit + 1
+	}
+	if limit == cc.limit {
+		return
+	}
+
+	cc.limit = limit
+	cc.stats.Adjustments++
+	if limit < cc.stats.Lowest {
+		cc.stats.Lowest = limit
+	}
+	if limit > cc.stats.Highest {
+		cc.stats.Highest = limit
+	}
+}
+
+// accumulate 累计同时进行的检测数对时间的积分，调用方持有锁
+func (cc *ConcurrencyController) accumulate() {
+	now := time.Now()
+	cc.activeArea += float64(cc.active) * now.Sub(cc.lastChange).Seconds()
+	cc.lastChange = now
+}
+
+// Stats 实际使用的并发数统计
+func (cc *ConcurrencyController) Stats() *types.ConcurrencyStats {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	cc.accumulate()
+	stats := cc.stats
+	stats.Final = cc.limit
+	if elapsed := time.Since(cc.startTime).Seconds(); elapsed > 0 {
+		stats.Average = cc.activeArea / elapsed
+	}
+	return &stats
+}
+
+// overloaded 检测结果是否表明并发过高：出错、阶段超时或连接超时
+// 连接被拒绝等明确的不可达在目标正常时也会出现，不作为降低并发的依据
+func overloaded(result *types.DetectionResult, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+	if result == nil {
+		return true
+	}
+	if result.TimedOut() || (result.Verdict != nil && result.Verdict.Code == types.ReasonTimeout) {
+		return true
+	}
+	for _, stageErr := range result.StageErrors {
+		if network.IsTimeout(stageErr.Err) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"RealityChecker/internal/types"
+)
+
+// outcome 一次检测完成时交给并发控制器的结果
+type outcome struct {
+	result *types.DetectionResult
+	err    error
+}
+
+var (
+	passed     = outcome{result: &types.DetectionResult{Suitable: true}}
+	failed     = outcome{err: errors.New("连接超时")}
+	canceled   = outcome{err: context.Canceled}
+	cached     = outcome{result: &types.DetectionResult{Cached: true}}
+	stageTimed = outcome{result: &types.DetectionResult{StageErrors: []types.StageError{
+		{Stage: "comprehensive_tls", Err: fmt.Errorf("%w: 握手未完成", types.ErrStageTimeout)},
+	}}}
+	timedOut = outcome{result: &types.DetectionResult{Verdict: types.NewVerdict(types.ReasonTimeout, "")}}
+)
+
+// repeat 返回 n 个相同的结果
+func repeat(o outcome, n int) []outcome {
+	outcomes := make([]outcome, n)
+	for i := range outcomes {
+		outcomes[i] = o
+	}
+	return outcomes
+}
+
+// sequence 依次连接多组结果
+func sequence(groups ...[]outcome) []outcome {
+	var outcomes []outcome
+	for _, group := range groups {
+		outcomes = append(outcomes, group...)
+	}
+	return outcomes
+}
+
+func TestConcurrencyControllerRelease(t *testing.T) {
+	adaptive := types.ConcurrencyConfig{MaxConcurrent: 8}
+
+	tests := []struct {
+		name        string
+		config      types.ConcurrencyConfig
+		outcomes    []outcome
+		wantInitial int
+		wantLimit   int
+	}{
+		{"初始上限低于最大并发数", adaptive, nil, 4, 4},
+		{"最大并发数较小时从最大并发数开始", types.ConcurrencyConfig{MaxConcurrent: 2}, nil, 2, 2},
+		{"一轮未完成不调整", adaptive, repeat(passed, 3), 4, 4},
+		{"每轮成功加1", adaptive, repeat(passed, 4), 4, 5},
+		{"每轮按当前上限计数", adaptive, sequence(repeat(passed, 4), repeat(passed, 5)), 4, 6},
+		{"加到最大并发数为止", types.ConcurrencyConfig{MaxConcurrent: 5}, repeat(passed, 4+5+5), 4, 5},
+		{"失败率高时减半", adaptive, repeat(failed, 4), 4, 2},
+		{"连续减半不低于1", adaptive, repeat(failed, 4+4+4), 4, 1},
+		{"失败率在两个阈值之间时不变", adaptive, sequence(repeat(passed, 3), repeat(failed, 1)), 4, 4},
+		{"一轮半数失败时减半", adaptive, sequence(repeat(passed, 2), repeat(failed, 2)), 4, 2},
+		{"阶段超时视为并发过高", adaptive, repeat(stageTimed, 4), 4, 2},
+		{"检测超时视为并发过高", adaptive, repeat(timedOut, 4), 4, 2},
+		{"取消不视为并发过高", adaptive, repeat(canceled, 4), 4, 5},
+		{"缓存结果不参与调整", adaptive, repeat(cached, 8), 4, 4},
+		{"减半后重新加1", adaptive, sequence(repeat(failed, 4), repeat(passed, 4)), 4, 3},
+		{"固定模式始终使用最大并发数", types.ConcurrencyConfig{MaxConcurrent: 8, Fixed: true}, repeat(failed, 16), 8, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controller := NewConcurrencyController(tt.config)
+			for _, o := range tt.outcomes {
+				if err := controller.Acquire(context.Background()); err != nil {
+					t.Fatalf("等待并发名额失败: %v", err)
+				}
+				controller.Release(o.result, o.err)
+			}
+
+			stats := controller.Stats()
+			if stats.Initial != tt.wantInitial {
+				t.Fatalf("初始上限 = %d，期望 %d", stats.Initial, tt.wantInitial)
+			}
+			if stats.Final != tt.wantLimit {
+				t.Fatalf("并发上限 = %d，期望 %d", stats.Final, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestConcurrencyControllerAcquireWaitsForLimit(t *testing.T) {
+	controller := NewConcurrencyController(types.ConcurrencyConfig{MaxConcurrent: 1})
+	if err := controller.Acquire(context.Background()); err != nil {
+		t.Fatalf("等待并发名额失败: %v", err)
+	}
+
+	// 名额用完时等待，被取消时返回取消原因
+	ctx, cancel := context.WithCancel(context.Background())
+	acquired := make(chan error)
+	go func() { acquired <- controller.Acquire(ctx) }()
+	cancel()
+	if err := <-acquired; !errors.Is(err, context.Canceled) {
+		t.Fatalf("取消后等待结果 = %v，期望 context.Canceled", err)
+	}
+
+	// 释放后可以再次领取
+	controller.Release(passed.result, nil)
+	if err := controller.Acquire(context.Background()); err != nil {
+		t.Fatalf("释放后等待并发名额失败: %v", err)
+	}
+	if peak := controller.Stats().Peak; peak != 1 {
+		t.Fatalf("最多同时进行 %d 个检测，期望 1", peak)
+	}
+}
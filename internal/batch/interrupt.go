@@ -0,0 +1,93 @@
+package batch
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// interruptGrace 中断后等待进行中的检测完成的时间
+const interruptGrace = 10 * time.Second
+
+// batchRun 一次批量检测的上下文
+// check 约束进行中的检测，时间预算用完或中断等待超时后取消；schedule 约束开始新的检测，中断时立即取消
+type batchRun struct {
+	check    context.Context
+	schedule context.Context
+	stopping chan struct{} // 中断时关闭
+	finish   func()
+}
+
+// startRun 开始一次批量检测，结束时调用 finish 取消未完成的检测
+func (bm *Manager) startRun(ctx context.Context) *batchRun {
+	check, cancelCheck := bm.withBudget(ctx)
+	schedule, stopSchedule := context.WithCancel(check)
+	run := &batchRun{
+		check:    check,
+		schedule: schedule,
+		stopping: make(chan struct{}),
+	}
+
+	bm.mu.Lock()
+	bm.stopping = run.stopping
+	bm.mu.Unlock()
+
+	run.finish = func() {
+		bm.mu.Lock()
+		if bm.stopping == run.stopping {
+			bm.stopping = nil
+		}
+		bm.mu.Unlock()
+		stopSchedule()
+		cancelCheck()
+	}
+
+	go func() {
+		select {
+		case <-run.stopping:
+		case <-check.Done():
+			return
+		}
+
+		stopSchedule()
+		fmt.Printf("\n[%s] 收到中断信号，不再开始新的检测，进行中的检测最多等待 %s（再次按 Ctrl-C 立即退出）\n",
+			time.Now().Format("15:04:05"), formatDuration(interruptGrace))
+
+		timer := time.NewTimer(interruptGrace)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			fmt.Printf("\n[%s] 等待超时，取消进行中的检测\n", time.Now().Format("15:04:05"))
+			cancelCheck()
+		case <-check.Done():
+		}
+	}()
+	return run
+}
+
+// interrupted 批量检测是否被中断
+func (r *batchRun) interrupted() bool {
+	select {
+	case <-r.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// Interrupt 中断正在进行的批量检测：不再开始新的检测，进行中的检测最多再等待 interruptGrace，
+// 之后取消未完成的检测，输出已完成部分的报告。没有正在进行的批量检测时返回false
+func (bm *Manager) Interrupt() bool {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	if bm.stopping == nil {
+		return false
+	}
+	select {
+	case <-bm.stopping:
+	default:
+		close(bm.stopping)
+	}
+	return true
+}
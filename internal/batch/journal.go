@@ -0,0 +1,137 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"RealityChecker/internal/types"
+)
+
+// maxJournalLine 检查点文件单条记录的最大长度
+const maxJournalLine = 16 * 1024 * 1024
+
+// journalEntry 检查点文件中的一条记录，每个检测完成的目标一行（JSON Lines）
+type journalEntry struct {
+	Target string                 `json:"target"`          // 输入中的检测目标
+	Error  string                 `json:"error,omitempty"` // 技术错误，结果的 Error 字段不参与序列化
+	Result *types.DetectionResult `json:"result"`
+}
+
+// Journal 批量检测的检查点文件
+// 每完成一个目标追加一条记录并落盘，中断（Ctrl-C、SSH断开、重启）后可以用 --resume 跳过已完成的目标
+type Journal struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// OpenJournal 打开检查点文件；resume 为true时读取已完成的结果并在文件末尾继续追加，
+// 否则清空文件重新记录。返回已完成的结果，键为检测目标
+func OpenJournal(path string, resume bool) (*Journal, map[string]*types.DetectionResult, error) {
+	finished := make(map[string]*types.DetectionResult)
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		var err error
+		if finished, err = loadJournal(path); err != nil {
+			return nil, nil, err
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开检查点文件失败: %v", err)
+	}
+
+	// 上次中断时最后一条记录可能只写了一半，换行后再追加，避免与新记录连在一起
+	if resume {
+		if info, err := file.Stat(); err == nil && info.Size() > 0 && !endsWithNewline(path, info.Size()) {
+			if _, err := file.Write([]byte("\n")); err != nil {
+				file.Close()
+				return nil, nil, fmt.Errorf("写入检查点文件失败: %v", err)
+			}
+		}
+	}
+
+	return &Journal{file: file, encoder: json.NewEncoder(file)}, finished, nil
+}
+
+// loadJournal 读取检查点文件中已完成的结果，同一目标有多条记录时以最后一条为准
+// 无法解析的记录（中断时只写了一半）和没有结论的记录（不可达、超时、取消等技术失败）被忽略，该目标会重新检测
+func loadJournal(path string) (map[string]*types.DetectionResult, error) {
+	finished := make(map[string]*types.DetectionResult)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return finished, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取检查点文件失败: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxJournalLine)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Target == "" || entry.Result == nil {
+			continue
+		}
+		if entry.Error != "" {
+			entry.Result.Error = errors.New(entry.Error)
+		}
+		if entry.Result.CheckFailed() {
+			delete(finished, entry.Target)
+			continue
+		}
+		finished[entry.Target] = entry.Result
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取检查点文件失败: %v", err)
+	}
+	return finished, nil
+}
+
+// endsWithNewline 文件最后一个字节是否为换行
+func endsWithNewline(path string, size int64) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, size-1); err != nil && err != io.EOF {
+		return true
+	}
+	return last[0] == '\n'
+}
+
+// Record 追加一个目标的检测结果并落盘
+func (j *Journal) Record(target string, result *types.DetectionResult) error {
+	if j == nil {
+		return nil
+	}
+
+	entry := journalEntry{Target: target, Result: result}
+	if result.Error != nil {
+		entry.Error = result.Error.Error()
+	}
+	if err := j.encoder.Encode(entry); err != nil {
+		return fmt.Errorf("写入检查点文件失败: %v", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("写入检查点文件失败: %v", err)
+	}
+	return nil
+}
+
+// Close 关闭检查点文件
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.file.Close()
+}
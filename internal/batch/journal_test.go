@@ -0,0 +1,202 @@
+package batch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"RealityChecker/internal/types"
+)
+
+// suitableResult 适合的检测结果
+func suitableResult(target string) *types.DetectionResult {
+	result := types.NewTargetResult(target)
+	result.Suitable = true
+	return result
+}
+
+// unsuitableResult 有结论的不适合检测结果
+func unsuitableResult(target string, code types.ReasonCode) *types.DetectionResult {
+	result := types.NewTargetResult(target)
+	result.Verdict = types.NewVerdict(code, "")
+	return result
+}
+
+// erroredResult 出错的检测结果
+func erroredResult(target string) *types.DetectionResult {
+	result := types.NewTargetResult(target)
+	result.Error = errors.New("连接被重置")
+	return result
+}
+
+// writeJournal 新建检查点文件并按顺序记录结果
+func writeJournal(t *testing.T, path string, targets []string, results []*types.DetectionResult) {
+	t.Helper()
+	journal, _, err := OpenJournal(path, false)
+	if err != nil {
+		t.Fatalf("打开检查点文件失败: %v", err)
+	}
+	defer journal.Close()
+	for i, target := range targets {
+		if err := journal.Record(target, results[i]); err != nil {
+			t.Fatalf("记录检测结果失败: %v", err)
+		}
+	}
+}
+
+// finishedTargets 已完成结果的目标，按字母排序
+func finishedTargets(finished map[string]*types.DetectionResult) string {
+	var targets []string
+	for target := range finished {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return strings.Join(targets, ",")
+}
+
+func TestLoadJournal(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		results []*types.DetectionResult
+		tail    string // 记录之后追加的内容
+		want    string
+	}{
+		{
+			name:    "有结论的结果都恢复",
+			targets: []string{"a.com", "b.com"},
+			results: []*types.DetectionResult{suitableResult("a.com"), unsuitableResult("b.com", types.ReasonDomestic)},
+			want:    "a.com,b.com",
+		},
+		{
+			name:    "技术失败的结果重新检测",
+			targets: []string{"a.com", "b.com", "c.com", "d.com", "e.com"},
+			results: []*types.DetectionResult{
+				suitableResult("a.com"),
+				unsuitableResult("b.com", types.ReasonUnreachable),
+				unsuitableResult("c.com", types.ReasonTimeout),
+				unsuitableResult("d.com", types.ReasonCanceled),
+				erroredResult("e.com"),
+			},
+			want: "a.com",
+		},
+		{
+			name:    "同一目标以最后一条记录为准",
+			targets: []string{"a.com", "b.com", "a.com", "b.com"},
+			results: []*types.DetectionResult{
+				suitableResult("a.com"),
+				unsuitableResult("b.com", types.ReasonTimeout),
+				unsuitableResult("a.com", types.ReasonTimeout),
+				suitableResult("b.com"),
+			},
+			want: "b.com",
+		},
+		{
+			name:    "忽略只写了一半的最后一行",
+			targets: []string{"a.com"},
+			results: []*types.DetectionResult{suitableResult("a.com")},
+			tail:    `{"target":"b.com","result":{"dom`,
+			want:    "a.com",
+		},
+		{
+			name:    "忽略空行和缺少字段的记录",
+			targets: []string{"a.com"},
+			results: []*types.DetectionResult{suitableResult("a.com")},
+			tail:    "\n{\"target\":\"b.com\"}\n{\"result\":{}}\n",
+			want:    "a.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal.jsonl")
+			writeJournal(t, path, tt.targets, tt.results)
+			if tt.tail != "" {
+				appendFile(t, path, tt.tail)
+			}
+
+			finished, err := loadJournal(path)
+			if err != nil {
+				t.Fatalf("读取检查点文件失败: %v", err)
+			}
+			if got := finishedTargets(finished); got != tt.want {
+				t.Fatalf("已完成的目标 = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadJournalMissingFile(t *testing.T) {
+	finished, err := loadJournal(filepath.Join(t.TempDir(), "missing.jsonl"))
+	if err != nil || len(finished) != 0 {
+		t.Fatalf("不存在的检查点文件 = %v, %v，期望没有结果", finished, err)
+	}
+}
+
+func TestOpenJournalResumeAfterTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	writeJournal(t, path,
+		[]string{"a.com", "b.com"},
+		[]*types.DetectionResult{suitableResult("a.com"), unsuitableResult("b.com", types.ReasonUnreachable)})
+	appendFile(t, path, `{"target":"c.com","result":{"dom`)
+
+	// 恢复时跳过无法解析的最后一行和技术失败的结果
+	journal, finished, err := OpenJournal(path, true)
+	if err != nil {
+		t.Fatalf("恢复检查点文件失败: %v", err)
+	}
+	if got := finishedTargets(finished); got != "a.com" {
+		t.Fatalf("恢复的目标 = %q，期望 %q", got, "a.com")
+	}
+	if !finished["a.com"].Suitable {
+		t.Fatalf("恢复的结果丢失了结论")
+	}
+
+	// 重新检测的结果追加在新的一行，不与只写了一半的记录连在一起
+	for _, result := range []*types.DetectionResult{suitableResult("b.com"), suitableResult("c.com")} {
+		if err := journal.Record(result.Domain, result); err != nil {
+			t.Fatalf("记录检测结果失败: %v", err)
+		}
+	}
+	journal.Close()
+
+	finished, err = loadJournal(path)
+	if err != nil {
+		t.Fatalf("读取检查点文件失败: %v", err)
+	}
+	if got := finishedTargets(finished); got != "a.com,b.com,c.com" {
+		t.Fatalf("再次恢复的目标 = %q，期望 %q", got, "a.com,b.com,c.com")
+	}
+}
+
+func TestOpenJournalWithoutResumeTruncates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	writeJournal(t, path, []string{"a.com"}, []*types.DetectionResult{suitableResult("a.com")})
+
+	journal, finished, err := OpenJournal(path, false)
+	if err != nil {
+		t.Fatalf("打开检查点文件失败: %v", err)
+	}
+	journal.Close()
+	if len(finished) != 0 {
+		t.Fatalf("不恢复时返回了 %d 个结果", len(finished))
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Fatalf("不恢复时检查点文件未清空")
+	}
+}
+
+// appendFile 在文件末尾追加内容
+func appendFile(t *testing.T, path, content string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+}
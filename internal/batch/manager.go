@@ -10,6 +10,7 @@ import (
 
 	"RealityChecker/internal/core"
 	"RealityChecker/internal/report"
+	"RealityChecker/internal/scoring"
 	"RealityChecker/internal/types"
 )
 
@@ -18,9 +19,16 @@ type Manager struct {
 	engine         *core.Engine
 	formatter      *report.Formatter
 	tableFormatter *report.TableFormatter
+	scorer         *scoring.Scorer
 	config         *types.Config
 	mu             sync.RWMutex
 	running        bool
+	journalPath    string        // 检查点文件，为空时不记录
+	resume         bool          // 从检查点文件恢复已完成的结果
+	stopping       chan struct{} // 正在进行的批量检测的中断通道，没有批量检测时为nil
+
+	// check 检测一个域名，为nil时使用引擎检测
+	check func(ctx context.Context, domain string) (*types.DetectionResult, error)
 }
 
 // NewManager 创建批量管理器
@@ -29,6 +37,7 @@ func NewManager(config *types.Config) *Manager {
 		config:         config,
 		formatter:      report.NewFormatter(config),
 		tableFormatter: report.NewTableFormatter(config),
+		scorer:         scoring.NewScorer(config),
 	}
 }
 
@@ -39,6 +48,7 @@ func NewManagerWithEngine(engine *core.Engine, config *types.Config) *Manager {
 		config:         config,
 		formatter:      report.NewFormatter(config),
 		tableFormatter: report.NewTableFormatter(config),
+		scorer:         scoring.NewScorer(config),
 	}
 }
 
@@ -85,6 +95,15 @@ func (bm *Manager) Stop() error {
 	return nil
 }
 
+// SetJournal 设置批量检测的检查点文件，path 为空时不记录；
+// resume 为true时跳过检查点中已完成的目标，报告包含这些目标的结果
+func (bm *Manager) SetJournal(path string, resume bool) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.journalPath = path
+	bm.resume = resume
+}
+
 // CheckDomains 批量检测域名
 func (bm *Manager) CheckDomains(ctx context.Context, domains []string) ([]*types.DetectionResult, error) {
 	if !bm.running {
@@ -97,120 +116,265 @@ func (bm *Manager) CheckDomains(ctx context.Context, domains []string) ([]*types
 
 	startTime := time.Now()
 
+	// 打开检查点文件，恢复时跳过已完成的目标
+	journal, finished, err := bm.openJournal()
+	if err != nil {
+		return nil, err
+	}
+	defer journal.Close()
+
+	pending := domains
+	if journal != nil {
+		pending = nil
+		for _, domain := range domains {
+			if _, ok := finished[domain]; !ok {
+				pending = append(pending, domain)
+			}
+		}
+		if resumed := len(domains) - len(pending); resumed > 0 {
+			fmt.Printf("[%s] 从检查点恢复 %d 个已完成的目标，继续检测剩余 %d 个\n",
+				time.Now().Format("15:04:05"), resumed, len(pending))
+		}
+	}
+
 	// 使用流式检测显示实时进度
-	results, err := bm.CheckDomainsWithProgress(ctx, domains)
+	checked, concurrency, err := bm.checkDomains(ctx, pending, journal)
 	if err != nil {
 		return nil, err
 	}
 
+	// 按输入顺序合并检查点中的结果和本次检测的结果
+	results := make([]*types.DetectionResult, len(domains))
+	resumed := 0
+	for i, domain := range domains {
+		if result, ok := finished[domain]; ok {
+			results[i] = result
+			resumed++
+		} else {
+			results[i], checked = checked[0], checked[1:]
+		}
+		results[i].Index = i
+	}
+
 	// 生成批量报告
 	batchReport := bm.generateBatchReport(results, startTime, time.Now())
+	batchReport.Concurrency = concurrency
+	batchReport.Statistics.ResumedResults = resumed
 
 	// 打印报告
 	fmt.Println(bm.formatBatchReport(batchReport))
 
+	// 导出JSON报告
+	if bm.config.Output.JSONFile != "" {
+		if err := report.WriteJSONReport(bm.config.Output.JSONFile, batchReport); err != nil {
+			fmt.Printf("导出JSON报告失败: %v\n", err)
+		} else {
+			fmt.Printf("JSON报告已导出: %s\n", bm.config.Output.JSONFile)
+		}
+	}
+
 	return results, nil
 }
 
+// openJournal 打开设置的检查点文件，未设置时返回nil和空的结果
+func (bm *Manager) openJournal() (*Journal, map[string]*types.DetectionResult, error) {
+	if bm.journalPath == "" {
+		return nil, make(map[string]*types.DetectionResult), nil
+	}
+	return OpenJournal(bm.journalPath, bm.resume)
+}
+
 // CheckDomainsWithProgress 带进度显示的并发批量检测
 func (bm *Manager) CheckDomainsWithProgress(ctx context.Context, domains []string) ([]*types.DetectionResult, error) {
+	results, _, err := bm.checkDomains(ctx, domains, nil)
+	return results, err
+}
+
+// checkDomains 带进度显示的并发批量检测，并发数由并发控制器调整，同时返回实际使用的并发数
+// 每个完成的检测写入检查点文件 journal（为nil时不记录）
+func (bm *Manager) checkDomains(ctx context.Context, domains []string, journal *Journal) ([]*types.DetectionResult, *types.ConcurrencyStats, error) {
 	results := make([]*types.DetectionResult, len(domains))
-	resultChan := make(chan *ProgressResult, len(domains))
 
-	// 启动并发检测
+	// 时间预算用完、中断或返回时取消仍在进行的检测
+	run := bm.startRun(ctx)
+	defer run.finish()
+
+	// 自适应模式从较低的并发上限开始，按超时和失败率调整
+	controller := NewConcurrencyController(bm.config.Concurrency)
+
+	// 固定数量的工作协程依次领取域名
+	jobs := make(chan batchJob)
 	go func() {
-		defer close(resultChan)
+		defer close(jobs)
+		for i, domain := range domains {
+			select {
+			case jobs <- batchJob{index: i, domain: domain}:
+			case <-run.schedule.Done():
+				return
+			}
+		}
+	}()
+	resultChan := bm.startWorkers(run, controller, jobs)
+
+	// 收集结果并显示进度，直到所有工作协程退出
+	completed := 0
+	budgetDone := run.check.Done()
+	for resultChan != nil {
+		select {
+		case progressResult, ok := <-resultChan:
+			if !ok {
+				resultChan = nil
+				continue
+			}
+			results[progressResult.Index] = progressResult.Result
+			completed++
 
-		// 使用WaitGroup控制并发
-		var wg sync.WaitGroup
+			// 失败的检测没有结论，不写入检查点，恢复时重新检测
+			if !progressResult.Result.CheckFailed() {
+				if err := journal.Record(progressResult.Domain, progressResult.Result); err != nil {
+					fmt.Printf("\n[%s] %v，停止记录检查点\n", time.Now().Format("15:04:05"), err)
+					journal = nil
+				}
+			}
 
-		// 使用配置的最大并发数，提高检测效率
-		concurrency := int(bm.config.Concurrency.MaxConcurrent) // 使用配置的并发数（默认8个）
-		semaphore := make(chan struct{}, concurrency)
+			// 显示进度
+			printProgress(fmt.Sprintf("%d/%d", completed, len(domains)), progressResult)
+		case <-budgetDone:
+			budgetDone = nil
+			if run.check.Err() == context.DeadlineExceeded {
+				fmt.Printf("\n[%s] 时间预算 %s 已用完，停止检测，正在取消未完成的检测\n",
+					time.Now().Format("15:04:05"), formatDuration(bm.config.Batch.Timeout))
+			}
+		}
+	}
 
-		for i, domain := range domains {
-			wg.Add(1)
-			go func(index int, domain string) {
-				defer wg.Done()
-
-				// 获取信号量
-				select {
-				case semaphore <- struct{}{}:
-					defer func() {
-						<-semaphore
-					}()
-				case <-ctx.Done():
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// 中断或时间预算用完时尚未开始检测的域名
+	code := types.ReasonSkipped
+	if run.interrupted() {
+		code = types.ReasonCanceled
+	}
+	for i, domain := range domains {
+		if results[i] == nil {
+			results[i] = types.NewTargetResult(domain)
+			results[i].Index = i
+			results[i].Verdict = types.NewVerdict(code, "")
+		}
+	}
+
+	return results, controller.Stats(), nil
+}
+
+// withBudget 按配置的时间预算限制整个批量检测，未配置预算时只可手动取消
+func (bm *Manager) withBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	if budget := bm.config.Batch.Timeout; budget > 0 {
+		return context.WithTimeout(ctx, budget)
+	}
+	return context.WithCancel(ctx)
+}
+
+// batchJob 待检测的域名及其在输入中的序号
+type batchJob struct {
+	index  int
+	domain string
+}
+
+// startWorkers 启动最大并发数个工作协程检测 jobs 中的域名，jobs 关闭且全部检测完成后关闭返回的通道
+// 工作协程数量固定，实际同时进行的检测数由并发控制器决定
+func (bm *Manager) startWorkers(run *batchRun, controller *ConcurrencyController, jobs <-chan batchJob) <-chan *ProgressResult {
+	workers := bm.config.Concurrency.MaxConcurrent
+	if workers <= 0 {
+		workers = 1
+	}
+	resultChan := make(chan *ProgressResult, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				// 等待并发名额，中断、时间预算用完或被取消时不再开始新的检测
+				if run.schedule.Err() != nil {
+					return
+				}
+				if err := controller.Acquire(run.schedule); err != nil {
 					return
 				}
 
-				// 检测域名
-				result, err := bm.engine.CheckDomain(ctx, domain)
+				// 在单域名时限内检测，结果用于调整并发上限
+				result, err := bm.checkDomain(run.check, job.domain)
+				controller.Release(result, err)
+				if result == nil {
+					result = types.NewTargetResult(job.domain)
+					result.Error = err
+				}
+				result.Index = job.index
+
+				// 时间预算用完或中断后被取消的检测，失败是取消造成的，不是目标不可达
+				if result.CheckFailed() {
+					switch run.check.Err() {
+					case context.DeadlineExceeded:
+						result.Suitable, result.Verdict = false, types.NewVerdict(types.ReasonTimeout, "")
+					case context.Canceled:
+						result.Suitable, result.Verdict = false, types.NewVerdict(types.ReasonCanceled, "")
+					}
+				}
 
-				// 发送结果
-				select {
-				case resultChan <- &ProgressResult{
-					Index:  index,
-					Domain: domain,
+				// 发送结果，接收方会读取到通道关闭为止，已完成的检测不会丢失
+				resultChan <- &ProgressResult{
+					Index:  job.index,
+					Domain: job.domain,
 					Result: result,
 					Error:  err,
-				}:
-				case <-ctx.Done():
-					return
 				}
-			}(i, domain)
-		}
+			}
+		}()
+	}
 
+	go func() {
 		wg.Wait()
+		close(resultChan)
 	}()
+	return resultChan
+}
 
-	// 收集结果并显示进度
-	completed := 0
-	timeout := time.NewTimer(15 * time.Second) // 添加15秒总超时
-	defer timeout.Stop()
+// checkDomain 在单域名时限（Concurrency.CheckTimeout）内检测一个域名，超时的检测结论为检测超时
+func (bm *Manager) checkDomain(ctx context.Context, domain string) (*types.DetectionResult, error) {
+	if timeout := bm.config.Concurrency.CheckTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if bm.check != nil {
+		return bm.check(ctx, domain)
+	}
+	return bm.engine.CheckDomain(ctx, domain)
+}
 
-	for completed < len(domains) {
-		select {
-		case progressResult := <-resultChan:
-			results[progressResult.Index] = progressResult.Result
-			completed++
+// printProgress 显示一个域名的检测结论，progress 为进度（如 3/10）
+func printProgress(progress string, progressResult *ProgressResult) {
+	fmt.Printf("[%s] 正在检测 [%s]: %s... ", time.Now().Format("15:04:05"), progress, progressResult.Domain)
 
-			// 显示进度
-			fmt.Printf("[%s] 正在检测 [%d/%d]: %s... ", time.Now().Format("15:04:05"), completed, len(domains), progressResult.Domain)
+	if progressResult.Result != nil && progressResult.Result.Cached {
+		fmt.Printf("(缓存) ")
+	}
 
-			if progressResult.Error != nil {
-				fmt.Printf("失败 - %v\n", progressResult.Error)
-			} else if progressResult.Result.Suitable {
-				fmt.Printf("适合\n")
-			} else {
-				// 获取不适合的原因
-				reason := "未知原因"
-				if progressResult.Result.Error != nil {
-					reason = progressResult.Result.Error.Error()
-				}
-				fmt.Printf("不适合 - %s\n", reason)
-			}
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-timeout.C:
-			// 超时处理：显示未完成的域名
-			fmt.Printf("\n[%s] 检测超时，以下域名未完成检测：\n", time.Now().Format("15:04:05"))
-			for i, domain := range domains {
-				if results[i] == nil {
-					fmt.Printf("  - %s (超时)\n", domain)
-					// 创建超时结果
-					results[i] = &types.DetectionResult{
-						Domain:   domain,
-						Index:    i,
-						Suitable: false,
-						Error:    fmt.Errorf("检测超时"),
-					}
-				}
-			}
-			return results, nil
+	if progressResult.Error != nil {
+		fmt.Printf("失败 - %v\n", progressResult.Error)
+	} else if progressResult.Result.Suitable {
+		fmt.Printf("适合\n")
+	} else {
+		// 获取不适合的原因
+		reason := progressResult.Result.Reason()
+		if reason == "" {
+			reason = "未知原因"
 		}
+		fmt.Printf("不适合 - %s\n", reason)
 	}
-
-	return results, nil
 }
 
 // ProgressResult 进度结果
@@ -237,43 +401,61 @@ func (bm *Manager) generateBatchReport(results []*types.DetectionResult, startTi
 	}
 
 	for _, result := range results {
-		// 区分技术错误和正常的检测结果
-		if result.Error == nil {
-			// 没有技术错误，检测成功
-			stats.SuccessfulChecks++
-		} else {
-			// 检查是否是正常的检测结果（被墙、国内等）
-			errorMsg := result.Error.Error()
-			if strings.Contains(errorMsg, "域名被墙") || strings.Contains(errorMsg, "国内网站") {
-				// 被墙和国内网站是正常的检测结果，不算失败
-				stats.SuccessfulChecks++
-			} else {
-				// 真正的技术错误
-				stats.FailedChecks++
-			}
-		}
+		countResult(stats, result)
+	}
 
-		if result.Suitable {
-			stats.SuitableDomains++
-		}
+	return newBatchReport(results, stats, startTime, endTime)
+}
+
+// countResult 将一个检测结果计入统计
+func countResult(stats *types.Statistics, result *types.DetectionResult) {
+	// 区分技术失败和正常的检测结论（被墙、国内、TLS不满足等都是正常结论）
+	if result.CheckFailed() {
+		stats.FailedChecks++
+	} else {
+		stats.SuccessfulChecks++
+	}
+
+	if result.Suitable {
+		stats.SuitableDomains++
+	}
+
+	if result.Blocked != nil && result.Blocked.IsBlocked {
+		stats.BlockedDomains++
+	}
+
+	if result.Cached {
+		stats.CachedResults++
+	}
 
-		if result.Blocked != nil && result.Blocked.IsBlocked {
-			stats.BlockedDomains++
+	if result.Verdict != nil {
+		switch result.Verdict.Code {
+		case types.ReasonTimeout:
+			stats.TimedOutDomains++
+		case types.ReasonSkipped:
+			stats.SkippedDomains++
+		case types.ReasonCanceled:
+			stats.CanceledDomains++
 		}
 	}
+}
 
-	return &types.BatchReport{
+// newBatchReport 按统计信息生成批量报告，results 为报告中列出的结果
+func newBatchReport(results []*types.DetectionResult, stats *types.Statistics, startTime, endTime time.Time) *types.BatchReport {
+	report := &types.BatchReport{
 		StartTime:     startTime,
 		EndTime:       endTime,
 		TotalDuration: endTime.Sub(startTime),
 		Results:       results,
 		Statistics:    stats,
-		Summary: &types.BatchSummary{
-			SuccessRate:     float64(stats.SuccessfulChecks) / float64(stats.TotalDomains),
-			SuitabilityRate: float64(stats.SuitableDomains) / float64(stats.TotalDomains),
-			BlockingRate:    float64(stats.BlockedDomains) / float64(stats.TotalDomains),
-		},
+		Summary:       &types.BatchSummary{},
+	}
+	if stats.TotalDomains > 0 {
+		report.Summary.SuccessRate = float64(stats.SuccessfulChecks) / float64(stats.TotalDomains)
+		report.Summary.SuitabilityRate = float64(stats.SuitableDomains) / float64(stats.TotalDomains)
+		report.Summary.BlockingRate = float64(stats.BlockedDomains) / float64(stats.TotalDomains)
 	}
+	return report
 }
 
 // formatBatchReport 格式化批量报告
@@ -295,17 +477,43 @@ func (bm *Manager) formatBatchReport(report *types.BatchReport) string {
 		report.Summary.SuitabilityRate*100,
 	))
 
+	if source := bm.config.Network.SourceAddress; source != "" {
+		result.WriteString(fmt.Sprintf("源地址: %s\n\n", source))
+	} else if iface := bm.config.Network.Interface; iface != "" {
+		result.WriteString(fmt.Sprintf("源地址: 网卡 %s\n\n", iface))
+	}
+
+	if concurrency := report.Concurrency; concurrency != nil {
+		result.WriteString(formatConcurrency(concurrency) + "\n\n")
+	}
+
+	if timeouts := bm.formatTimeouts(report.Statistics); timeouts != "" {
+		result.WriteString(timeouts + "\n\n")
+	}
+
+	if report.Statistics.CanceledDomains > 0 {
+		result.WriteString(fmt.Sprintf("检测被中断: %d 个域名未完成，报告只包含已完成的检测\n\n", report.Statistics.CanceledDomains))
+	}
+
+	if report.Statistics.ResumedResults > 0 {
+		result.WriteString(fmt.Sprintf("检查点结果: %d 个（来自 --resume）\n\n", report.Statistics.ResumedResults))
+	}
+
+	if report.Statistics.CachedResults > 0 {
+		result.WriteString(fmt.Sprintf("缓存结果: %d 个（使用 --refresh 重新检测）\n\n", report.Statistics.CachedResults))
+	}
+
 	// 分离适合和不适合的域名
 	var suitableResults []*types.DetectionResult
 	var unsuitableResults []*types.DetectionResult
 	var excludedResults []*types.DetectionResult // 状态码不自然的域名
 
 	for _, domainResult := range report.Results {
-		if domainResult.Suitable && domainResult.Error == nil {
+		if domainResult.Suitable {
 			suitableResults = append(suitableResults, domainResult)
 		} else {
 			// 检查是否因为状态码不自然而被排除
-			if domainResult.StatusCodeCategory == types.StatusCodeCategoryExcluded {
+			if domainResult.Verdict != nil && domainResult.Verdict.Code == types.ReasonBadStatus {
 				excludedResults = append(excludedResults, domainResult)
 			} else {
 				unsuitableResults = append(unsuitableResults, domainResult)
@@ -369,20 +577,27 @@ func (bm *Manager) formatExcludedDomains(excludedResults []*types.DetectionResul
 	return result.String()
 }
 
-// calculateOptimalConcurrency 计算最优并发数
-func (bm *Manager) calculateOptimalConcurrency(domainCount int) int {
-	// 更激进的并发策略，提高检测效率
-	if domainCount <= 5 {
-		return domainCount // 小批量：每个域名一个并发
-	} else if domainCount <= 20 {
-		return 6 // 中小批量：6个并发
-	} else if domainCount <= 50 {
-		return 8 // 中批量：8个并发
-	} else if domainCount <= 100 {
-		return 10 // 大批量：10个并发
-	} else {
-		return 12 // 超大批量：最多12个并发
+// formatConcurrency 实际使用的并发数说明
+func formatConcurrency(stats *types.ConcurrencyStats) string {
+	used := fmt.Sprintf("并发: 平均 %.1f，峰值 %d", stats.Average, stats.Peak)
+	if !stats.Adaptive {
+		return fmt.Sprintf("%s（固定上限 %d）", used, stats.Final)
+	}
+	return fmt.Sprintf("%s（自适应上限 %d→%d，范围 %d-%d，调整 %d 次）",
+		used, stats.Initial, stats.Final, stats.Lowest, stats.Highest, stats.Adjustments)
+}
+
+// formatTimeouts 超时和时间预算的说明，没有超时或跳过的域名时为空
+func (bm *Manager) formatTimeouts(stats *types.Statistics) string {
+	checkTimeout := formatDuration(bm.config.Concurrency.CheckTimeout)
+	if stats.SkippedDomains > 0 {
+		return fmt.Sprintf("时间预算 %s 已用完: %d 个域名未检测，%d 个检测超时（单域名时限 %s）",
+			formatDuration(bm.config.Batch.Timeout), stats.SkippedDomains, stats.TimedOutDomains, checkTimeout)
+	}
+	if stats.TimedOutDomains > 0 {
+		return fmt.Sprintf("检测超时: %d 个（单域名时限 %s）", stats.TimedOutDomains, checkTimeout)
 	}
+	return ""
 }
 
 // formatDuration 格式化时间显示
@@ -400,51 +615,17 @@ func formatDuration(d time.Duration) string {
 	}
 }
 
-// sortByRecommendationStars 按推荐星级排序，1星在最上面，5星在最下面
+// sortByRecommendationStars 按推荐评分排序，低分在最上面，高分在最下面
 func (bm *Manager) sortByRecommendationStars(results []*types.DetectionResult) {
-	// 使用sort.Slice进行排序
-	sort.Slice(results, func(i, j int) bool {
-		starsI := bm.calculateStars(results[i])
-		starsJ := bm.calculateStars(results[j])
-		return starsI < starsJ // 升序排列：1星在前，5星在后
+	sort.SliceStable(results, func(i, j int) bool {
+		return bm.scoreOf(results[i]).Total < bm.scoreOf(results[j]).Total // 升序排列：低分在前，高分在后
 	})
 }
 
-// calculateStars 计算域名的推荐星级数量
-func (bm *Manager) calculateStars(result *types.DetectionResult) int {
-	stars := 0
-
-	// 1. TLS硬性条件检查 (TLS1.3 + X25519 + H2 + SNI匹配)
-	if result.TLS != nil && result.TLS.SupportsTLS13 &&
-		result.TLS.SupportsX25519 && result.TLS.SupportsHTTP2 &&
-		result.SNI != nil && result.SNI.SNIMatch {
-		stars++
-	}
-
-	// 2. 握手时间延迟小 (<= 200ms)
-	if result.TLS != nil && result.TLS.HandshakeTime > 0 {
-		handshakeMs := int(result.TLS.HandshakeTime.Milliseconds())
-		if handshakeMs <= 200 {
-			stars++
-		}
+// scoreOf 获取结果的推荐评分，缺失时即时计算
+func (bm *Manager) scoreOf(result *types.DetectionResult) *types.ScoreResult {
+	if result.Score == nil {
+		result.Score = bm.scorer.Score(result)
 	}
-
-	// 3. 没有CDN (不使用CDN更安全)
-	if result.CDN == nil || !result.CDN.IsCDN {
-		stars++
-	}
-
-	// 4. 不是热门网站 (热门网站不推荐作为Reality目标)
-	if result.CDN != nil && !result.CDN.IsHotWebsite {
-		stars++
-	}
-
-	// 5. 证书时间长 (>= 60天)
-	if result.Certificate != nil && result.Certificate.Valid {
-		if result.Certificate.DaysUntilExpiry >= 60 {
-			stars++
-		}
-	}
-
-	return stars
+	return result.Score
 }
@@ -0,0 +1,172 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// newTestManager 创建使用 check 检测域名的批量管理器，不启动引擎
+func newTestManager(t *testing.T, concurrency types.ConcurrencyConfig, check func(context.Context, string) (*types.DetectionResult, error)) *Manager {
+	t.Helper()
+	bm := NewManager(&types.Config{Concurrency: concurrency})
+	bm.check = check
+	bm.running = true
+	return bm
+}
+
+func TestCheckDomainsMergesJournalInInputOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	writeJournal(t, path,
+		[]string{"b.com", "d.com"},
+		[]*types.DetectionResult{suitableResult("b.com"), unsuitableResult("d.com", types.ReasonTimeout)})
+
+	var mu sync.Mutex
+	checked := make(map[string]bool)
+	bm := newTestManager(t, types.ConcurrencyConfig{MaxConcurrent: 2}, func(ctx context.Context, target string) (*types.DetectionResult, error) {
+		mu.Lock()
+		checked[target] = true
+		mu.Unlock()
+		return unsuitableResult(target, types.ReasonDomestic), nil
+	})
+	bm.SetJournal(path, true)
+
+	domains := []string{"a.com", "b.com", "c.com", "d.com"}
+	results, err := bm.CheckDomains(context.Background(), domains)
+	if err != nil {
+		t.Fatalf("批量检测失败: %v", err)
+	}
+
+	tests := []struct {
+		domain       string
+		wantChecked  bool
+		wantSuitable bool
+	}{
+		{"a.com", true, false},
+		{"b.com", false, true}, // 检查点中的结果
+		{"c.com", true, false},
+		{"d.com", true, false}, // 检查点中超时的结果重新检测
+	}
+	for i, tt := range tests {
+		result := results[i]
+		if result.Domain != tt.domain || result.Index != i {
+			t.Fatalf("第 %d 个结果 = %s（序号 %d），期望 %s", i, result.Domain, result.Index, tt.domain)
+		}
+		if checked[tt.domain] != tt.wantChecked {
+			t.Fatalf("%s 是否检测 = %v，期望 %v", tt.domain, checked[tt.domain], tt.wantChecked)
+		}
+		if result.Suitable != tt.wantSuitable {
+			t.Fatalf("%s 是否适合 = %v，期望 %v", tt.domain, result.Suitable, tt.wantSuitable)
+		}
+	}
+}
+
+func TestCheckDomainsDeadlines(t *testing.T) {
+	// 阻塞到被取消为止的检测
+	blocking := func(ctx context.Context, target string) (*types.DetectionResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	tests := []struct {
+		name         string
+		checkTimeout time.Duration
+		budget       time.Duration
+		want         []types.ReasonCode
+	}{
+		{"单域名超时只影响该域名", 50 * time.Millisecond, 0, []types.ReasonCode{"", "", ""}},
+		{"时间预算用完时进行中的检测超时，未开始的跳过", 0, 50 * time.Millisecond, []types.ReasonCode{types.ReasonTimeout, types.ReasonSkipped, types.ReasonSkipped}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bm := newTestManager(t, types.ConcurrencyConfig{MaxConcurrent: 1, Fixed: true, CheckTimeout: tt.checkTimeout}, blocking)
+			bm.config.Batch.Timeout = tt.budget
+
+			results, err := bm.CheckDomains(context.Background(), []string{"a.com", "b.com", "c.com"})
+			if err != nil {
+				t.Fatalf("批量检测失败: %v", err)
+			}
+			for i, result := range results {
+				var code types.ReasonCode
+				if result.Verdict != nil {
+					code = result.Verdict.Code
+				}
+				if code != tt.want[i] {
+					t.Fatalf("%s 的结论 = %q，期望 %q", result.Domain, code, tt.want[i])
+				}
+				// 单域名超时的检测保留技术错误，由引擎给出结论
+				if tt.checkTimeout > 0 && !errors.Is(result.Error, context.DeadlineExceeded) {
+					t.Fatalf("%s 的错误 = %v，期望单域名超时", result.Domain, result.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestInterruptStopsSchedulingWithinGrace(t *testing.T) {
+	bm := newTestManager(t, types.ConcurrencyConfig{MaxConcurrent: 1}, nil)
+	if bm.Interrupt() {
+		t.Fatalf("没有批量检测时中断应返回false")
+	}
+
+	run := bm.startRun(context.Background())
+	defer run.finish()
+	if run.interrupted() {
+		t.Fatalf("未中断时 interrupted 应为false")
+	}
+
+	if !bm.Interrupt() || !bm.Interrupt() {
+		t.Fatalf("批量检测进行中时中断应返回true，重复中断不出错")
+	}
+
+	// 中断后立即不再开始新的检测，进行中的检测在等待时间内继续
+	select {
+	case <-run.schedule.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("中断后仍在开始新的检测")
+	}
+	if !run.interrupted() {
+		t.Fatalf("中断后 interrupted 应为true")
+	}
+	if err := run.check.Err(); err != nil {
+		t.Fatalf("等待时间内进行中的检测被取消: %v", err)
+	}
+
+	// 结束后不再能中断
+	run.finish()
+	if bm.Interrupt() {
+		t.Fatalf("批量检测结束后中断应返回false")
+	}
+}
+
+func TestCheckDomainsInterrupted(t *testing.T) {
+	var bm *Manager
+	bm = newTestManager(t, types.ConcurrencyConfig{MaxConcurrent: 1, Fixed: true}, func(ctx context.Context, target string) (*types.DetectionResult, error) {
+		if target == "a.com" {
+			// 第一个检测进行中收到中断，等待调度停止后完成
+			bm.Interrupt()
+			time.Sleep(100 * time.Millisecond)
+		}
+		return suitableResult(target), nil
+	})
+
+	results, err := bm.CheckDomains(context.Background(), []string{"a.com", "b.com", "c.com"})
+	if err != nil {
+		t.Fatalf("批量检测失败: %v", err)
+	}
+
+	// 进行中的检测保留结论，未开始的检测记为被取消
+	if !results[0].Suitable || results[0].Verdict != nil {
+		t.Fatalf("进行中的检测结论 = %v，期望适合", results[0].Reason())
+	}
+	for _, result := range results[1:] {
+		if result.Verdict == nil || result.Verdict.Code != types.ReasonCanceled {
+			t.Fatalf("%s 的结论 = %q，期望被取消", result.Domain, result.Reason())
+		}
+	}
+}
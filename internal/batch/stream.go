@@ -0,0 +1,192 @@
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"RealityChecker/internal/report"
+	"RealityChecker/internal/types"
+)
+
+// streamTopResults 流式检测报告中保留的适合域名数（按推荐评分取最高的）
+const streamTopResults = 20
+
+// Source 流式检测的目标来源
+type Source interface {
+	// Next 返回下一个检测目标，没有更多目标时返回 io.EOF
+	Next() (string, error)
+}
+
+// CheckStream 流式批量检测：从 source 逐个读取目标，由固定数量的工作协程检测，
+// 每个结果检测完成后立即以JSON Lines写入 output（为nil时不写入），报告只保留统计和评分最高的适合域名，
+// 内存占用与目标总数无关。设置了检查点文件时记录每个结果，恢复时已完成的目标直接使用检查点中的结果
+func (bm *Manager) CheckStream(ctx context.Context, source Source, output io.Writer) (*types.BatchReport, error) {
+	if !bm.running {
+		return nil, fmt.Errorf("批量管理器未运行")
+	}
+
+	startTime := time.Now()
+
+	journal, finished, err := bm.openJournal()
+	if err != nil {
+		return nil, err
+	}
+	defer journal.Close()
+
+	run := bm.startRun(ctx)
+	defer run.finish()
+
+	// 自适应模式从较低的并发上限开始，按超时和失败率调整
+	controller := NewConcurrencyController(bm.config.Concurrency)
+
+	// 边读取边分发，有工作协程空闲时才读取下一个目标；检查点中已有结果的目标不再检测
+	var sourceErr error
+	jobs := make(chan batchJob)
+	resumed := make(chan *ProgressResult)
+	go func() {
+		defer close(jobs)
+		defer close(resumed)
+		for index := 0; ; index++ {
+			domain, err := source.Next()
+			if err != nil {
+				if err != io.EOF {
+					sourceErr = err
+					run.finish()
+				}
+				return
+			}
+
+			if result, ok := finished[domain]; ok {
+				delete(finished, domain)
+				result.Index = index
+				select {
+				case resumed <- &ProgressResult{Index: index, Domain: domain, Result: result}:
+				case <-run.schedule.Done():
+					return
+				}
+				continue
+			}
+
+			select {
+			case jobs <- batchJob{index: index, domain: domain}:
+			case <-run.schedule.Done():
+				return
+			}
+		}
+	}()
+	resultChan := bm.startWorkers(run, controller, jobs)
+
+	var encoder *json.Encoder
+	if output != nil {
+		encoder = json.NewEncoder(output)
+	}
+	stats := &types.Statistics{}
+	var top []*types.DetectionResult
+	var writeErr error
+
+	for resultChan != nil || resumed != nil {
+		var progressResult *ProgressResult
+		fromJournal := false
+		select {
+		case result, ok := <-resultChan:
+			if !ok {
+				resultChan = nil
+				continue
+			}
+			progressResult = result
+
+			// 失败的检测没有结论，不写入检查点，恢复时重新检测
+			if !result.Result.CheckFailed() {
+				if err := journal.Record(result.Domain, result.Result); err != nil {
+					fmt.Printf("\n[%s] %v，停止记录检查点\n", time.Now().Format("15:04:05"), err)
+					journal = nil
+				}
+			}
+		case result, ok := <-resumed:
+			if !ok {
+				resumed = nil
+				continue
+			}
+			progressResult, fromJournal = result, true
+			stats.ResumedResults++
+		}
+
+		result := progressResult.Result
+		stats.TotalDomains++
+		countResult(stats, result)
+		if !fromJournal {
+			printProgress(fmt.Sprintf("%d", stats.TotalDomains), progressResult)
+		}
+
+		// 先计算评分，写出的结果包含评分
+		bm.scoreOf(result)
+		if encoder != nil && writeErr == nil {
+			if err := encoder.Encode(result); err != nil {
+				writeErr = fmt.Errorf("写入检测结果失败: %v", err)
+				run.finish()
+			}
+		}
+		if result.Suitable {
+			top = bm.keepTop(top, result)
+		}
+	}
+
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	if sourceErr != nil {
+		return nil, fmt.Errorf("读取检测目标失败: %v", sourceErr)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if stats.ResumedResults > 0 {
+		fmt.Printf("\n[%s] 从检查点恢复 %d 个已完成的目标\n", time.Now().Format("15:04:05"), stats.ResumedResults)
+	}
+	if run.interrupted() {
+		fmt.Printf("\n[%s] 检测被中断，剩余目标未读取\n", time.Now().Format("15:04:05"))
+	} else if run.check.Err() == context.DeadlineExceeded {
+		fmt.Printf("\n[%s] 时间预算 %s 已用完，剩余目标未读取\n",
+			time.Now().Format("15:04:05"), formatDuration(bm.config.Batch.Timeout))
+	}
+
+	batchReport := newBatchReport(top, stats, startTime, time.Now())
+	batchReport.Concurrency = controller.Stats()
+
+	// 打印报告
+	fmt.Println(bm.formatBatchReport(batchReport))
+	if stats.SuitableDomains > len(top) {
+		fmt.Printf("以上为推荐评分最高的 %d 个适合域名，共 %d 个\n", len(top), stats.SuitableDomains)
+	}
+
+	// 导出JSON报告
+	if bm.config.Output.JSONFile != "" {
+		if err := report.WriteJSONReport(bm.config.Output.JSONFile, batchReport); err != nil {
+			fmt.Printf("导出JSON报告失败: %v\n", err)
+		} else {
+			fmt.Printf("JSON报告已导出: %s\n", bm.config.Output.JSONFile)
+		}
+	}
+
+	return batchReport, nil
+}
+
+// keepTop 将适合的结果加入推荐评分最高的结果列表，超过 streamTopResults 个时替换评分最低的
+func (bm *Manager) keepTop(top []*types.DetectionResult, result *types.DetectionResult) []*types.DetectionResult {
+	if len(top) < streamTopResults {
+		return append(top, result)
+	}
+	lowest := 0
+	for i := range top {
+		if bm.scoreOf(top[i]).Total < bm.scoreOf(top[lowest]).Total {
+			lowest = i
+		}
+	}
+	if bm.scoreOf(result).Total > bm.scoreOf(top[lowest]).Total {
+		top[lowest] = result
+	}
+	return top
+}
@@ -0,0 +1,195 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"RealityChecker/internal/types"
+)
+
+// sliceSource 依次返回固定目标的来源，读完后返回 err（为nil时返回 io.EOF）
+type sliceSource struct {
+	targets []string
+	err     error
+}
+
+func (s *sliceSource) Next() (string, error) {
+	if len(s.targets) == 0 {
+		if s.err != nil {
+			return "", s.err
+		}
+		return "", io.EOF
+	}
+	target := s.targets[0]
+	s.targets = s.targets[1:]
+	return target, nil
+}
+
+// scoredTargets 生成 n 个目标，第 i 个的推荐评分为 i，序号能被3整除的不适合
+func scoredTargets(n int) ([]string, func(context.Context, string) (*types.DetectionResult, error)) {
+	targets := make([]string, n)
+	scores := make(map[string]int, n)
+	for i := range targets {
+		targets[i] = fmt.Sprintf("d%02d.com", i)
+		scores[targets[i]] = i
+	}
+	check := func(ctx context.Context, target string) (*types.DetectionResult, error) {
+		score := scores[target]
+		result := types.NewTargetResult(target)
+		result.Score = &types.ScoreResult{Total: float64(score)}
+		if score%3 == 0 {
+			result.Verdict = types.NewVerdict(types.ReasonDomestic, "")
+		} else {
+			result.Suitable = true
+		}
+		return result, nil
+	}
+	return targets, check
+}
+
+// decodeLines 解析JSON Lines输出中每个结果的目标
+func decodeLines(t *testing.T, output *bytes.Buffer) []string {
+	t.Helper()
+	var targets []string
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		var result types.DetectionResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("输出的结果无法解析: %v", err)
+		}
+		if result.Score == nil {
+			t.Fatalf("输出的结果 %s 没有推荐评分", result.Domain)
+		}
+		targets = append(targets, result.Domain)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+func TestCheckStream(t *testing.T) {
+	tests := []struct {
+		name         string
+		targets      int
+		wantSuitable int
+		wantTop      []string
+	}{
+		{"适合的域名少于报告上限时全部保留", 9, 6, []string{"d01.com", "d02.com", "d04.com", "d05.com", "d07.com", "d08.com"}},
+		{"报告只保留评分最高的适合域名", 45, 30, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, check := scoredTargets(tt.targets)
+			bm := newTestManager(t, types.ConcurrencyConfig{MaxConcurrent: 4}, check)
+
+			var output bytes.Buffer
+			report, err := bm.CheckStream(context.Background(), &sliceSource{targets: append([]string{}, targets...)}, &output)
+			if err != nil {
+				t.Fatalf("流式检测失败: %v", err)
+			}
+
+			// 每个结果都逐行写出
+			if got := strings.Join(decodeLines(t, &output), ","); got != strings.Join(targets, ",") {
+				t.Fatalf("写出的结果 = %s，期望 %s", got, strings.Join(targets, ","))
+			}
+
+			stats := report.Statistics
+			if stats.TotalDomains != tt.targets || stats.SuccessfulChecks != tt.targets || stats.SuitableDomains != tt.wantSuitable {
+				t.Fatalf("统计 = %+v，期望 %d 个目标、%d 个适合", *stats, tt.targets, tt.wantSuitable)
+			}
+
+			// 报告中保留评分最高的适合域名
+			want := tt.wantTop
+			if want == nil {
+				for i := tt.targets - 1; len(want) < streamTopResults; i-- {
+					if i%3 != 0 {
+						want = append(want, fmt.Sprintf("d%02d.com", i))
+					}
+				}
+			}
+			var top []string
+			for _, result := range report.Results {
+				top = append(top, result.Domain)
+			}
+			sort.Strings(top)
+			sort.Strings(want)
+			if strings.Join(top, ",") != strings.Join(want, ",") {
+				t.Fatalf("报告中的适合域名 = %v，期望 %v", top, want)
+			}
+		})
+	}
+}
+
+func TestCheckStreamResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	writeJournal(t, path,
+		[]string{"a.com", "b.com"},
+		[]*types.DetectionResult{suitableResult("a.com"), unsuitableResult("b.com", types.ReasonUnreachable)})
+	appendFile(t, path, `{"target":"c.com","res`)
+
+	checked := make(chan string, 3)
+	bm := newTestManager(t, types.ConcurrencyConfig{MaxConcurrent: 2}, func(ctx context.Context, target string) (*types.DetectionResult, error) {
+		checked <- target
+		return suitableResult(target), nil
+	})
+	bm.SetJournal(path, true)
+
+	var output bytes.Buffer
+	report, err := bm.CheckStream(context.Background(), &sliceSource{targets: []string{"a.com", "b.com", "c.com"}}, &output)
+	if err != nil {
+		t.Fatalf("流式检测失败: %v", err)
+	}
+	close(checked)
+
+	// 检查点中技术失败和只写了一半的目标重新检测，已完成的目标直接使用检查点中的结果
+	var rechecked []string
+	for target := range checked {
+		rechecked = append(rechecked, target)
+	}
+	sort.Strings(rechecked)
+	if got := strings.Join(rechecked, ","); got != "b.com,c.com" {
+		t.Fatalf("重新检测的目标 = %s，期望 b.com,c.com", got)
+	}
+	if got := strings.Join(decodeLines(t, &output), ","); got != "a.com,b.com,c.com" {
+		t.Fatalf("写出的结果 = %s，期望 a.com,b.com,c.com", got)
+	}
+	if stats := report.Statistics; stats.TotalDomains != 3 || stats.ResumedResults != 1 || stats.SuitableDomains != 3 {
+		t.Fatalf("统计 = %+v，期望 3 个目标、恢复 1 个、3 个适合", *stats)
+	}
+
+	// 本次检测的结果写入检查点，再次恢复时全部完成
+	finished, err := loadJournal(path)
+	if err != nil {
+		t.Fatalf("读取检查点文件失败: %v", err)
+	}
+	if got := finishedTargets(finished); got != "a.com,b.com,c.com" {
+		t.Fatalf("检查点中已完成的目标 = %s，期望 a.com,b.com,c.com", got)
+	}
+}
+
+func TestCheckStreamSourceError(t *testing.T) {
+	bm := newTestManager(t, types.ConcurrencyConfig{MaxConcurrent: 2}, func(ctx context.Context, target string) (*types.DetectionResult, error) {
+		return types.NewTargetResult(target), nil
+	})
+
+	source := &sliceSource{targets: []string{"a.com"}, err: errors.New("磁盘读取错误")}
+	_, err := bm.CheckStream(context.Background(), source, nil)
+	if err == nil || !strings.Contains(err.Error(), "磁盘读取错误") {
+		t.Fatalf("读取目标出错时返回 %v，期望包含读取错误", err)
+	}
+}
+
+func TestCheckStreamNotRunning(t *testing.T) {
+	bm := NewManager(&types.Config{})
+	if _, err := bm.CheckStream(context.Background(), &sliceSource{}, nil); err == nil {
+		t.Fatalf("批量管理器未运行时应返回错误")
+	}
+}
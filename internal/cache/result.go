@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"RealityChecker/internal/types"
+	"RealityChecker/internal/version"
+)
+
+// Mode 结果缓存的使用方式
+type Mode int
+
+// Mode 常量
+const (
+	ModeDefault  Mode = iota // 命中未过期的缓存时直接使用，检测结果写回缓存
+	ModeRefresh              // 忽略已有缓存重新检测，检测结果写回缓存
+	ModeDisabled             // 不读也不写缓存
+)
+
+// ResultStore 持久化到本地文件的检测结果缓存
+// 键为域名加影响检测结论的配置摘要，修改策略或评分配置后旧结果自动失效
+type ResultStore struct {
+	path    string
+	maxSize int
+	config  *types.Config
+	cache   *types.ResultCache
+	mu      sync.Mutex
+	dirty   bool
+}
+
+// NewResultStore 创建结果缓存并加载缓存文件，文件不存在时从空缓存开始
+func NewResultStore(config *types.Config) (*ResultStore, error) {
+	store := &ResultStore{
+		path:    config.Cache.Path,
+		maxSize: config.Cache.MaxSize,
+		config:  config,
+		cache: &types.ResultCache{
+			Cache: make(map[string]*types.CachedResult),
+			TTL:   config.Cache.TTL,
+		},
+	}
+
+	data, err := os.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取结果缓存失败: %v", err)
+	}
+	if err := json.Unmarshal(data, store.cache); err != nil {
+		return nil, fmt.Errorf("解析结果缓存失败: %v", err)
+	}
+	if store.cache.Cache == nil {
+		store.cache.Cache = make(map[string]*types.CachedResult)
+	}
+	return store, nil
+}
+
+// Get 返回检测目标未过期的缓存结果
+func (s *ResultStore) Get(target string) (*types.DetectionResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.cache.Cache[s.key(target)]
+	if !ok || entry.Result == nil || s.expired(entry, time.Now()) {
+		return nil, false
+	}
+
+	// 返回副本，调用方修改序号等字段不影响缓存
+	result := *entry.Result
+	result.Cached = true
+	return &result, true
+}
+
+// Put 写入检测结果，技术失败的结果不缓存，下次检测时重试
+func (s *ResultStore) Put(result *types.DetectionResult) {
+	if result == nil || result.CheckFailed() || len(result.StageErrors) > 0 {
+		return
+	}
+
+	stored := *result
+	stored.Cached = false
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache.Cache[s.key(result.Target())] = &types.CachedResult{Result: &stored, Timestamp: time.Now()}
+	s.dirty = true
+
+	// 条目数达到上限两倍时提前淘汰，长时间的流式检测中缓存占用的内存保持有界
+	if s.maxSize > 0 && len(s.cache.Cache) >= 2*s.maxSize {
+		s.prune(time.Now())
+	}
+}
+
+// Save 清理过期条目、按上限淘汰最旧的条目后写入缓存文件
+func (s *ResultStore) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	s.prune(time.Now())
+
+	data, err := json.Marshal(s.cache)
+	if err != nil {
+		return fmt.Errorf("序列化结果缓存失败: %v", err)
+	}
+
+	// 先写临时文件再重命名，避免中断时留下不完整的缓存文件
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建缓存目录失败: %v", err)
+		}
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入结果缓存失败: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入结果缓存失败: %v", err)
+	}
+
+	s.dirty = false
+	return nil
+}
+
+// prune 删除过期条目，超过上限时保留最新的条目
+func (s *ResultStore) prune(now time.Time) {
+	for key, entry := range s.cache.Cache {
+		if entry.Result == nil || s.expired(entry, now) {
+			delete(s.cache.Cache, key)
+		}
+	}
+
+	if s.maxSize <= 0 || len(s.cache.Cache) <= s.maxSize {
+		return
+	}
+	keys := make([]string, 0, len(s.cache.Cache))
+	for key := range s.cache.Cache {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return s.cache.Cache[keys[i]].Timestamp.After(s.cache.Cache[keys[j]].Timestamp)
+	})
+	for _, key := range keys[s.maxSize:] {
+		delete(s.cache.Cache, key)
+	}
+}
+
+// expired 条目是否超过TTL
+func (s *ResultStore) expired(entry *types.CachedResult, now time.Time) bool {
+	return s.cache.TTL > 0 && now.Sub(entry.Timestamp) > s.cache.TTL
+}
+
+// key 缓存键：检测目标加配置摘要，example.com 和 example.com:443 为同一目标，
+// 指定连接地址的目标与解析域名的目标分别缓存
+func (s *ResultStore) key(target string) string {
+	parsed := types.ParseTarget(target)
+	parsed.Domain = strings.ToLower(parsed.Domain)
+	return parsed.String() + "|" + s.configHash(parsed.Domain)
+}
+
+// configHash 影响检测结论的配置摘要：域名适用的策略、评分、TLS、DNS、出口配置以及程序版本
+func (s *ResultStore) configHash(domain string) string {
+	data, _ := json.Marshal(struct {
+		Version    string
+		Policy     types.PolicyConfig
+		Scoring    types.ScoringConfig
+		TLS        types.TLSConfig
+		DNSServers []string
+		Proxy      string
+		Source     string
+		Interface  string
+		AllIPs     bool
+		IPVersion  string
+		Samples    int
+	}{
+		Version:    version.GetVersion(),
+		Policy:     s.config.PolicyFor(domain),
+		Scoring:    s.config.Scoring,
+		TLS:        s.config.TLS,
+		DNSServers: s.config.Network.DNSServers,
+		Proxy:      s.config.Network.Proxy,
+		Source:     s.config.Network.SourceAddress,
+		Interface:  s.config.Network.Interface,
+		AllIPs:     s.config.Network.AllAddresses,
+		IPVersion:  s.config.Network.IPVersion,
+		Samples:    s.config.Network.LatencySamples,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"RealityChecker/internal/types"
 	"RealityChecker/internal/ui"
 )
 
@@ -95,6 +96,9 @@ func parseDomains(domainsStr string) ([]string, []string, []string) {
 		}
 
 		if isValidDomain(domain) {
+			// 统一目标写法，example.com:443 与 example.com 视为重复
+			domain = types.ParseTarget(domain).String()
+
 			// 检查是否已存在，避免重复
 			if !domainSet[domain] {
 				validDomains = append(validDomains, domain)
@@ -4,10 +4,11 @@ import (
 	"fmt"
 	"net"
 	"regexp"
+	"strconv"
 	"strings"
 
-	"RealityChecker/internal/config"
 	"RealityChecker/internal/report"
+	"RealityChecker/internal/types"
 	"RealityChecker/internal/ui"
 )
 
@@ -18,12 +19,14 @@ func (r *RootCmd) executeCheck(domain string) {
 	if !isValidDomain(domain) {
 		ui.PrintErrorWithDetails(
 			fmt.Sprintf("错误：域名格式无效 '%s'", domain),
-			"提示：请检查域名格式，例如：apple.com, google.com",
+			"提示：请检查域名格式，例如：apple.com, google.com, example.com:8443",
 			"域名要求：",
 			"   - 只能包含字母、数字、连字符和点",
 			"   - 不能以点开头或结尾",
 			"   - 不能包含连续的点",
 			"   - 长度不超过253个字符",
+			"   - 可以带端口（1-65535），未指定时检测443端口",
+			"   - 可以用 IP@域名 指定连接地址，例如：1.2.3.4@example.com",
 		)
 		return
 	}
@@ -37,16 +40,30 @@ func (r *RootCmd) executeCheck(domain string) {
 	}
 
 	// 使用格式化器输出结果
-	cfg, _ := config.LoadConfig("")
-	formatter := report.NewFormatter(cfg)
+	formatter := report.NewFormatter(r.config)
 	fmt.Printf("\n%s", formatter.FormatSingleResult(result))
 
 	// 显示广告
 	ui.PrintAdvertisement()
 }
 
-// isValidDomain 验证域名格式是否有效
-func isValidDomain(domain string) bool {
+// isValidDomain 验证域名格式是否有效，域名或IP可以带端口（host:port），
+// 也可以用 IP@域名 指定连接地址
+func isValidDomain(target string) bool {
+	parsed := types.ParseTarget(target)
+	if number, err := strconv.Atoi(parsed.Port); err != nil || number < 1 || number > 65535 {
+		return false
+	}
+	if strings.Contains(target, "@") && net.ParseIP(parsed.IP) == nil {
+		return false
+	}
+	domain := parsed.Domain
+
+	// IP地址无需检查域名格式
+	if net.ParseIP(domain) != nil {
+		return true
+	}
+
 	// 基本长度检查
 	if len(domain) == 0 || len(domain) > 253 {
 		return false
@@ -67,19 +84,10 @@ func isValidDomain(domain string) bool {
 		return false
 	}
 
-	// 使用正则表达式验证域名格式
-	domainRegex := regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?)*$`)
-	if !domainRegex.MatchString(domain) {
-		return false
-	}
-
-	// 尝试解析域名（不进行实际DNS查询）
-	_, err := net.LookupHost(domain)
-	if err != nil {
-		// 即使DNS解析失败，只要格式正确就认为是有效的
-		// 因为可能是网络问题或域名确实不存在
-		return true
-	}
-
-	return true
+	// 使用正则表达式验证域名格式；只检查格式，不进行DNS查询，
+	// 域名不存在或网络问题由检测结论说明，流式检测数十万个目标时也不会被逐个查询拖慢
+	return domainRegex.MatchString(domain)
 }
+
+// domainRegex 域名格式
+var domainRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?)*$`)
@@ -1,11 +1,9 @@
 package cmd
 
 import (
-	"encoding/csv"
 	"fmt"
 	"os"
 	"strings"
-	"time"
 
 	"RealityChecker/internal/ui"
 )
@@ -32,12 +30,15 @@ func (r *RootCmd) executeCSV(csvFile string) {
 	}
 	defer file.Close()
 
-	// 解析CSV
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	// 逐行解析CSV，提取检测目标（IP和CERT_DOMAIN列）并去重
+	source, err := newCSVSource(file)
+	empty := false
+	if err == nil {
+		empty, err = source.empty()
+	}
 	if err != nil {
 		ui.PrintErrorWithDetails(
-			fmt.Sprintf("错误：解析CSV文件失败: %v", err),
+			fmt.Sprintf("错误：%v", err),
 			"请使用 RealiTLScanner 工具扫描，得到 CSV 文件",
 			"命令：./RealiTLScanner -addr <VPS IP> -port 443 -thread 100 -timeout 5 -out file.csv",
 			"（提示：RealiTLScanner 尽量在本地运行，不要在远端）",
@@ -46,9 +47,9 @@ func (r *RootCmd) executeCSV(csvFile string) {
 		return
 	}
 
-	if len(records) < 2 {
+	if empty {
 		ui.PrintErrorWithDetails(
-			"错误：CSV文件格式错误或为空",
+			"错误：未找到有效的域名",
 			"请使用 RealiTLScanner 工具扫描，得到 CSV 文件",
 			"命令：./RealiTLScanner -addr <VPS IP> -port 443 -thread 100 -timeout 5 -out file.csv",
 			"（提示：RealiTLScanner 尽量在本地运行，不要在远端）",
@@ -57,24 +58,26 @@ func (r *RootCmd) executeCSV(csvFile string) {
 		return
 	}
 
-	// 提取域名（从CERT_DOMAIN列）
-	domains := extractDomainsFromCSV(records)
-	if len(domains) == 0 {
-		ui.PrintErrorWithDetails(
-			"错误：未找到有效的域名",
-			"请使用 RealiTLScanner 工具扫描，得到 CSV 文件",
-			"命令：./RealiTLScanner -addr <VPS IP> -port 443 -thread 100 -timeout 5 -out file.csv",
-			"（提示：RealiTLScanner 尽量在本地运行，不要在远端）",
-			"（重要：多次运行时请更改输出文件名，如 file1.csv、file2.csv 等）",
-		)
+	// 指定 --output 时与 stream 命令相同，边读取边检测，结果逐个写入文件
+	if r.opts.output != "" {
+		ui.PrintTimestampedMessage("开始批量检测...")
+		r.runStream(source)
 		return
 	}
 
-	fmt.Printf("[%s] 从CSV文件提取到 %d 个域名\n", time.Now().Format("15:04:05"), len(domains))
+	// 否则读取全部目标，报告给出全部适合的域名
+	domains, err := source.all()
+	if err != nil {
+		ui.PrintError(fmt.Sprintf("错误：%v", err))
+		return
+	}
+	if source.invalid > 0 || source.duplicates > 0 {
+		ui.PrintTimestampedMessage("已跳过 %d 个无效目标、%d 个重复目标", source.invalid, source.duplicates)
+	}
+	ui.PrintTimestampedMessage("从CSV文件提取到 %d 个检测目标", len(domains))
 	ui.PrintTimestampedMessage("开始批量检测...")
 
-	_, err = r.batchManager.CheckDomains(r.ctx, domains)
-	if err != nil {
+	if _, err := r.batchManager.CheckDomains(r.ctx, domains); err != nil {
 		fmt.Printf("批量检测失败: %v\n", err)
 		return
 	}
@@ -83,38 +86,14 @@ func (r *RootCmd) executeCSV(csvFile string) {
 	ui.PrintAdvertisement()
 }
 
-// extractDomainsFromCSV 从CSV记录中提取域名
-func extractDomainsFromCSV(records [][]string) []string {
-	var domains []string
-	domainSet := make(map[string]bool) // 用于去重
-
-	// 跳过标题行，从第二行开始处理
-	for i := 1; i < len(records); i++ {
-		if len(records[i]) < 3 {
-			continue
-		}
-
-		certDomain := strings.TrimSpace(records[i][2]) // CERT_DOMAIN列
-		if certDomain == "" {
-			continue
-		}
-
-		// 清理域名（移除引号等）
-		certDomain = strings.Trim(certDomain, "\"")
-
-		// 排除一些不需要的域名
-		if shouldExcludeDomain(certDomain) {
-			continue
-		}
-
-		// 去重
-		if !domainSet[certDomain] {
-			domains = append(domains, certDomain)
-			domainSet[certDomain] = true
+// csvColumn 返回标题行中指定列的位置，找不到时返回 fallback
+func csvColumn(header []string, name string, fallback int) int {
+	for i, column := range header {
+		if strings.EqualFold(strings.Trim(strings.TrimSpace(column), "\"\ufeff"), name) {
+			return i
 		}
 	}
-
-	return domains
+	return fallback
 }
 
 // shouldExcludeDomain 判断是否应该排除某个域名
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"RealityChecker/internal/report"
+	"RealityChecker/internal/ui"
+)
+
+// executeExplain 检测单个域名并说明检测过程
+func (r *RootCmd) executeExplain(domain string) {
+	// 验证域名格式
+	domain = strings.TrimSpace(domain)
+	if !isValidDomain(domain) {
+		ui.PrintErrorWithDetails(
+			fmt.Sprintf("错误：域名格式无效 '%s'", domain),
+			"提示：请检查域名格式，例如：apple.com, google.com",
+		)
+		return
+	}
+
+	ui.PrintTimestampedMessage("开始检测域名: %s", domain)
+
+	result, err := r.engine.CheckDomain(r.ctx, domain)
+	if err != nil {
+		fmt.Printf("检测失败: %v\n", err)
+		return
+	}
+
+	formatter := report.NewFormatter(r.config)
+	fmt.Printf("\n%s\n", formatter.FormatExplain(result, r.engine.GetStages()))
+}
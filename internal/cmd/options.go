@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"RealityChecker/internal/cache"
+	"RealityChecker/internal/network"
+	"RealityChecker/internal/types"
+)
+
+// options 命令行选项，可以出现在命令参数中的任意位置
+type options struct {
+	noCache bool          // 不读也不写结果缓存
+	refresh bool          // 忽略已有缓存重新检测，结果写回缓存
+	source  string        // 探测使用的本地源IP或网卡
+	allIPs  bool          // 分别检测域名的每个地址
+	ipVer   string        // 检测使用的地址族：4、6 或 both
+	samples int           // 延迟采样次数，0为使用配置
+	output  string        // 流式检测结果的JSON Lines文件
+	budget  time.Duration // 批量检测的时间预算，0为使用配置
+	journal string        // 批量检测的检查点文件
+	resume  string        // 从该检查点文件恢复并继续记录
+}
+
+// parseArgs 解析命令参数，返回选项和其余的位置参数
+func parseArgs(args []string) (*options, []string, error) {
+	opts := &options{}
+	fs := flag.NewFlagSet("reality-checker", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.BoolVar(&opts.noCache, "no-cache", false, "不使用结果缓存")
+	fs.BoolVar(&opts.refresh, "refresh", false, "重新检测并刷新结果缓存")
+	fs.StringVar(&opts.source, "source", "", "本地源IP或网卡")
+	fs.BoolVar(&opts.allIPs, "all-ips", false, "分别检测每个地址")
+	fs.StringVar(&opts.ipVer, "ip-version", "", "地址族：4、6 或 both")
+	fs.IntVar(&opts.samples, "samples", 0, "延迟采样次数")
+	fs.StringVar(&opts.output, "output", "", "流式检测结果文件")
+	fs.DurationVar(&opts.budget, "budget", 0, "批量检测的时间预算")
+	fs.StringVar(&opts.journal, "journal", "", "检查点文件")
+	fs.StringVar(&opts.resume, "resume", "", "从检查点文件恢复")
+
+	// flag 包遇到第一个位置参数即停止，逐段解析以支持选项出现在任意位置
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, nil, fmt.Errorf("参数无效: %v", err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if opts.samples < 0 {
+		return nil, nil, fmt.Errorf("--samples 不能为负数")
+	}
+	if opts.budget < 0 {
+		return nil, nil, fmt.Errorf("--budget 不能为负数")
+	}
+	if opts.journal != "" && opts.resume != "" {
+		return nil, nil, fmt.Errorf("--journal 和 --resume 不能同时使用，--resume 会继续写入同一个检查点文件")
+	}
+	if opts.noCache && opts.refresh {
+		return nil, nil, fmt.Errorf("--no-cache 和 --refresh 不能同时使用")
+	}
+	return opts, positional, nil
+}
+
+// apply 将网络相关的选项写入配置
+func (o *options) apply(config *types.Config) error {
+	if o.source != "" {
+		if net.ParseIP(o.source) != nil {
+			config.Network.SourceAddress, config.Network.Interface = o.source, ""
+		} else {
+			config.Network.SourceAddress, config.Network.Interface = "", o.source
+		}
+		if err := network.ValidateSource(config.Network); err != nil {
+			return fmt.Errorf("--source 无效: %v", err)
+		}
+	}
+	if o.allIPs {
+		config.Network.AllAddresses = true
+	}
+	if o.ipVer != "" {
+		if err := network.ValidateIPVersion(o.ipVer); err != nil {
+			return fmt.Errorf("--ip-version 无效: %v", err)
+		}
+		config.Network.IPVersion = o.ipVer
+	}
+	if o.samples > 0 {
+		config.Network.LatencySamples = o.samples
+	}
+	if o.budget > 0 {
+		config.Batch.Timeout = o.budget
+	}
+	return nil
+}
+
+// journalFile 检查点文件及是否从中恢复，未指定时路径为空
+func (o *options) journalFile() (string, bool) {
+	if o.resume != "" {
+		return o.resume, true
+	}
+	return o.journal, false
+}
+
+// cacheMode 选项对应的结果缓存使用方式
+func (o *options) cacheMode() cache.Mode {
+	switch {
+	case o.noCache:
+		return cache.ModeDisabled
+	case o.refresh:
+		return cache.ModeRefresh
+	default:
+		return cache.ModeDefault
+	}
+}
@@ -9,16 +9,21 @@ import (
 	"syscall"
 
 	"RealityChecker/internal/batch"
+	"RealityChecker/internal/cache"
 	"RealityChecker/internal/config"
 	"RealityChecker/internal/core"
+	"RealityChecker/internal/types"
 	"RealityChecker/internal/ui"
 	"RealityChecker/internal/version"
 )
 
 // RootCmd 根命令结构
 type RootCmd struct {
+	config       *types.Config
 	engine       *core.Engine
 	batchManager *batch.Manager
+	opts         *options
+	args         []string // 命令之后的位置参数
 	ctx          context.Context
 	cancel       context.CancelFunc
 }
@@ -31,6 +36,19 @@ func NewRootCmd() (*RootCmd, error) {
 		return nil, fmt.Errorf("加载配置失败: %v", err)
 	}
 
+	// 解析命令行选项，命令行指定的网络选项覆盖配置文件
+	var rawArgs []string
+	if len(os.Args) > 2 {
+		rawArgs = os.Args[2:]
+	}
+	opts, args, err := parseArgs(rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.apply(cfg); err != nil {
+		return nil, err
+	}
+
 	// 创建引擎
 	engine := core.NewEngine(cfg)
 	if err := engine.Start(); err != nil {
@@ -44,18 +62,27 @@ func NewRootCmd() (*RootCmd, error) {
 		return nil, fmt.Errorf("启动批量管理器失败: %v", err)
 	}
 
-	// 设置信号处理
+	// 设置信号处理：批量检测中第一次中断停止开始新的检测，输出已完成部分的报告，
+	// 其他命令直接取消；第二次中断立即退出
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
-		sigChan := make(chan os.Signal, 1)
+		sigChan := make(chan os.Signal, 2)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		<-sigChan
-		cancel()
+		if !batchManager.Interrupt() {
+			cancel()
+		}
+		<-sigChan
+		fmt.Println("\n再次收到中断信号，立即退出")
+		os.Exit(130)
 	}()
 
 	return &RootCmd{
+		config:       cfg,
 		engine:       engine,
 		batchManager: batchManager,
+		opts:         opts,
+		args:         args,
 		ctx:          ctx,
 		cancel:       cancel,
 	}, nil
@@ -70,9 +97,13 @@ func (r *RootCmd) Execute() {
 		os.Exit(1)
 	}
 
+	opts, args := r.opts, r.args
+	r.engine.SetCacheMode(opts.cacheMode())
+	r.batchManager.SetJournal(opts.journalFile())
+
 	switch os.Args[1] {
 	case "check":
-		if len(os.Args) < 3 {
+		if len(args) < 1 {
 			ui.PrintErrorWithDetails(
 				"错误：缺少域名参数",
 				"用法: reality-checker check <domain>",
@@ -80,9 +111,23 @@ func (r *RootCmd) Execute() {
 			)
 			os.Exit(1)
 		}
-		r.executeCheck(os.Args[2])
+		r.executeCheck(args[0])
+	case "explain":
+		if len(args) < 1 {
+			ui.PrintErrorWithDetails(
+				"错误：缺少域名参数",
+				"用法: reality-checker explain <domain>",
+				"示例: reality-checker explain apple.com",
+			)
+			os.Exit(1)
+		}
+		// explain 用于排查检测过程，不使用已有的缓存结果
+		if opts.cacheMode() == cache.ModeDefault {
+			r.engine.SetCacheMode(cache.ModeRefresh)
+		}
+		r.executeExplain(args[0])
 	case "batch":
-		if len(os.Args) < 3 {
+		if len(args) < 1 {
 			ui.PrintErrorWithDetails(
 				"错误：缺少域名参数",
 				"用法: reality-checker batch <domain1> <domain2> <domain3> ...",
@@ -91,10 +136,10 @@ func (r *RootCmd) Execute() {
 			os.Exit(1)
 		}
 		// 将所有参数（除了命令名）合并为空格分隔的字符串
-		domainsStr := strings.Join(os.Args[2:], " ")
+		domainsStr := strings.Join(args, " ")
 		r.executeBatch(domainsStr)
 	case "csv":
-		if len(os.Args) < 3 {
+		if len(args) < 1 {
 			ui.PrintErrorWithDetails(
 				"错误：缺少CSV文件参数",
 				"用法: reality-checker csv <csv_file>",
@@ -102,13 +147,23 @@ func (r *RootCmd) Execute() {
 			)
 			os.Exit(1)
 		}
-		r.executeCSV(os.Args[2])
+		r.executeCSV(args[0])
+	case "stream":
+		if len(args) < 1 {
+			ui.PrintErrorWithDetails(
+				"错误：缺少目标列表参数",
+				"用法: reality-checker stream <file|-> [--output results.jsonl]",
+				"示例: reality-checker stream domains.txt --output results.jsonl",
+			)
+			os.Exit(1)
+		}
+		r.executeStream(args[0])
 	case "version", "-v", "--version":
 		r.showVersion()
 	default:
 		ui.PrintErrorWithDetails(
 			fmt.Sprintf("错误：未知命令 '%s'", os.Args[1]),
-			"可用命令: check, batch, csv, version",
+			"可用命令: check, explain, batch, csv, stream, version",
 		)
 		os.Exit(1)
 	}
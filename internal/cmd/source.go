@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"RealityChecker/internal/types"
+)
+
+// maxLineSize 目标列表单行的最大长度
+const maxLineSize = 1024 * 1024
+
+// dedupWindow 去重记住的最近目标数，与其中某个目标相同的目标被跳过，更早出现过的目标会再次检测
+const dedupWindow = 100000
+
+// targetSource 逐行读取检测目标并去重，供流式检测使用
+// 去重只记住最近 dedupWindow 个不同的目标，内存占用与列表长度无关
+type targetSource struct {
+	read       func() ([]string, error) // 读取下一行中的检测目标，读完时返回 io.EOF
+	pending    []string
+	seen       map[string]struct{} // 最近出现过的目标
+	recent     []string            // seen 中的目标，按出现顺序循环覆盖
+	oldest     int                 // recent 中最早出现的目标的位置
+	invalid    int                 // 跳过的无效目标数
+	duplicates int                 // 跳过的重复目标数
+}
+
+// newTargetSource 创建目标来源，首行包含 CERT_DOMAIN 列时按 RealiTLScanner 的CSV读取，
+// 否则每行可以有一个或多个以空白分隔的目标，# 之后为注释
+func newTargetSource(input io.Reader) (*targetSource, error) {
+	reader := bufio.NewReader(input)
+	firstLine, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("读取检测目标失败: %v", err)
+	}
+	input = io.MultiReader(strings.NewReader(firstLine), reader)
+
+	if strings.Contains(strings.ToUpper(firstLine), "CERT_DOMAIN") {
+		return newCSVSource(input)
+	}
+
+	source := &targetSource{seen: make(map[string]struct{})}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	source.read = func() ([]string, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		var targets []string
+		for _, field := range strings.FieldsFunc(line, isTargetSeparator) {
+			if !isValidDomain(field) {
+				source.invalid++
+				continue
+			}
+			// 统一目标写法，example.com:443 与 example.com 视为重复
+			targets = append(targets, types.ParseTarget(field).String())
+		}
+		return targets, nil
+	}
+	return source, nil
+}
+
+// newCSVSource 创建读取 RealiTLScanner CSV 的目标来源，逐行读取，不一次读入整个文件
+func newCSVSource(input io.Reader) (*targetSource, error) {
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV文件为空")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析CSV文件失败: %v", err)
+	}
+
+	// 按标题行定位列，找不到时使用 RealiTLScanner 的默认列顺序
+	ipColumn, domainColumn := csvColumn(header, "IP", 0), csvColumn(header, "CERT_DOMAIN", 2)
+
+	source := &targetSource{seen: make(map[string]struct{})}
+	source.read = func() ([]string, error) {
+		record, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			return nil, fmt.Errorf("解析CSV文件失败: %v", err)
+		}
+		target, ok := csvTarget(record, ipColumn, domainColumn)
+		if !ok {
+			source.invalid++
+			return nil, nil
+		}
+		return []string{target}, nil
+	}
+	return source, nil
+}
+
+// Next 返回下一个未出现过的检测目标，没有更多目标时返回 io.EOF
+func (s *targetSource) Next() (string, error) {
+	for {
+		for len(s.pending) > 0 {
+			target := s.pending[0]
+			s.pending = s.pending[1:]
+
+			if _, ok := s.seen[target]; ok {
+				s.duplicates++
+				continue
+			}
+			s.remember(target)
+			return target, nil
+		}
+
+		targets, err := s.read()
+		if err != nil {
+			return "", err
+		}
+		s.pending = targets
+	}
+}
+
+// all 读取来源中的全部检测目标
+// 目标全部保存在内存中，去重不受 dedupWindow 限制
+func (s *targetSource) all() ([]string, error) {
+	var targets []string
+	seen := make(map[string]struct{})
+	for {
+		target, err := s.Next()
+		if err == io.EOF {
+			return targets, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[target]; ok {
+			s.duplicates++
+			continue
+		}
+		seen[target] = struct{}{}
+		targets = append(targets, target)
+	}
+}
+
+// remember 记住一个目标用于去重，已记住 dedupWindow 个目标时替换最早的
+func (s *targetSource) remember(target string) {
+	if len(s.recent) < dedupWindow {
+		s.recent = append(s.recent, target)
+	} else {
+		delete(s.seen, s.recent[s.oldest])
+		s.recent[s.oldest] = target
+		s.oldest = (s.oldest + 1) % dedupWindow
+	}
+	s.seen[target] = struct{}{}
+}
+
+// empty 读取到第一个检测目标为止，判断来源中是否没有目标，须在第一次调用 Next 之前调用
+func (s *targetSource) empty() (bool, error) {
+	for len(s.pending) == 0 {
+		targets, err := s.read()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		s.pending = targets
+	}
+	return false, nil
+}
+
+// isTargetSeparator 目标列表中的分隔符：空白和逗号
+func isTargetSeparator(r rune) bool {
+	return r == ',' || r == ' ' || r == '\t' || r == '\r'
+}
+
+// csvTarget 从CSV记录中提取检测目标
+// RealiTLScanner 的每行是扫描到的IP及其证书域名（CERT_DOMAIN），
+// 因此提取为 IP@域名，直接检测该IP在该SNI下的表现；IP列无效时只提取域名
+func csvTarget(record []string, ipColumn, domainColumn int) (string, bool) {
+	if len(record) <= domainColumn {
+		return "", false
+	}
+
+	// 清理域名（移除引号等）
+	certDomain := strings.Trim(strings.TrimSpace(record[domainColumn]), "\"")
+	if certDomain == "" {
+		return "", false
+	}
+
+	// 排除一些不需要的域名
+	if shouldExcludeDomain(certDomain) {
+		return "", false
+	}
+
+	target := types.Target{Domain: certDomain, Port: types.DefaultPort}
+	if len(record) > ipColumn {
+		if ip := net.ParseIP(strings.Trim(strings.TrimSpace(record[ipColumn]), "\"")); ip != nil {
+			target.IP = ip.String()
+		}
+	}
+	return target.String(), true
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"RealityChecker/internal/ui"
+)
+
+// executeStream 流式批量检测：从文件或标准输入（-）逐行读取检测目标，
+// 结果逐个写入 --output 指定的JSON Lines文件，适合数十万个目标的列表
+func (r *RootCmd) executeStream(path string) {
+	input := os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			ui.PrintError(fmt.Sprintf("错误：无法打开目标列表 '%s': %v", path, err))
+			return
+		}
+		defer file.Close()
+		input = file
+	}
+
+	source, err := newTargetSource(input)
+	if err != nil {
+		ui.PrintError(fmt.Sprintf("错误：%v", err))
+		return
+	}
+
+	ui.PrintTimestampedMessage("开始流式检测...")
+	r.runStream(source)
+}
+
+// runStream 流式检测目标来源中的目标，结果逐个写入 --output 指定的JSON Lines文件（未指定时不写入）
+func (r *RootCmd) runStream(source *targetSource) {
+	var output io.Writer
+	if r.opts.output != "" {
+		file, err := os.Create(r.opts.output)
+		if err != nil {
+			ui.PrintError(fmt.Sprintf("错误：无法创建结果文件 '%s': %v", r.opts.output, err))
+			return
+		}
+		defer file.Close()
+		output = file
+	}
+
+	_, err := r.batchManager.CheckStream(r.ctx, source, output)
+	if source.invalid > 0 || source.duplicates > 0 {
+		ui.PrintTimestampedMessage("已跳过 %d 个无效目标、%d 个重复目标", source.invalid, source.duplicates)
+	}
+	if err != nil {
+		fmt.Printf("批量检测失败: %v\n", err)
+		return
+	}
+	if r.opts.output != "" {
+		fmt.Printf("检测结果已写入: %s\n", r.opts.output)
+	}
+
+	// 显示广告
+	ui.PrintAdvertisement()
+}
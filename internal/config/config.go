@@ -5,6 +5,8 @@ import (
 	"os"
 	"time"
 
+	"RealityChecker/internal/network"
+	"RealityChecker/internal/policy"
 	"RealityChecker/internal/types"
 
 	"gopkg.in/yaml.v3"
@@ -38,11 +40,80 @@ func LoadConfig(configPath string) (*types.Config, error) {
 		}
 	}
 
+	// 加载独立策略文件
+	if config.Policy.File != "" {
+		if err := loadPolicyFromFile(config, config.Policy.File); err != nil {
+			return nil, fmt.Errorf("加载策略文件失败: %v", err)
+		}
+	}
+
 	// 验证并设置默认值
 	validateAndSetDefaults(config)
+
+	// 策略配置错误需要明确报告，不能静默回退
+	if err := policy.Validate(config.Policy); err != nil {
+		return nil, fmt.Errorf("策略配置无效: %v", err)
+	}
+	if err := network.ValidateDNSServers(config.Network.DNSServers); err != nil {
+		return nil, fmt.Errorf("DNS配置无效: %v", err)
+	}
+	if err := network.ValidateProxy(config.Network.Proxy); err != nil {
+		return nil, fmt.Errorf("代理配置无效: %v", err)
+	}
+	if err := network.ValidateSource(config.Network); err != nil {
+		return nil, fmt.Errorf("源地址配置无效: %v", err)
+	}
+	if err := network.ValidateIPVersion(config.Network.IPVersion); err != nil {
+		return nil, fmt.Errorf("地址族配置无效: %v", err)
+	}
 	return config, nil
 }
 
+// loadPolicyFromFile 从独立文件加载策略，文件内容与 config.yaml 的 policy 节相同
+func loadPolicyFromFile(config *types.Config, filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("读取策略文件失败: %v", err)
+	}
+
+	var filePolicy types.PolicyConfig
+	if err := yaml.Unmarshal(data, &filePolicy); err != nil {
+		return fmt.Errorf("解析策略文件失败: %v", err)
+	}
+
+	// 策略文件覆盖 config.yaml 中的策略
+	mergePolicy(&config.Policy, &filePolicy)
+	return nil
+}
+
+// mergePolicy 合并策略配置，非空字段覆盖
+func mergePolicy(defaultPolicy *types.PolicyConfig, filePolicy *types.PolicyConfig) {
+	if filePolicy.File != "" {
+		defaultPolicy.File = filePolicy.File
+	}
+	if len(filePolicy.Rules) > 0 {
+		defaultPolicy.Rules = filePolicy.Rules
+	}
+	if len(filePolicy.AllowedStatusCodes) > 0 {
+		defaultPolicy.AllowedStatusCodes = filePolicy.AllowedStatusCodes
+	}
+	if len(filePolicy.DomesticCountries) > 0 {
+		defaultPolicy.DomesticCountries = filePolicy.DomesticCountries
+	}
+	if filePolicy.MinCertDays > 0 {
+		defaultPolicy.MinCertDays = filePolicy.MinCertDays
+	}
+	if filePolicy.MaxHandshake > 0 {
+		defaultPolicy.MaxHandshake = filePolicy.MaxHandshake
+	}
+	if filePolicy.MinAddressRatio > 0 {
+		defaultPolicy.MinAddressRatio = filePolicy.MinAddressRatio
+	}
+	if len(filePolicy.Overrides) > 0 {
+		defaultPolicy.Overrides = filePolicy.Overrides
+	}
+}
+
 // loadConfigFromFile 从文件加载配置
 func loadConfigFromFile(config *types.Config, filePath string) error {
 	// 检查文件是否存在
@@ -80,6 +151,32 @@ func mergeConfig(defaultConfig *types.Config, fileConfig *types.Config) {
 	if len(fileConfig.Network.DNSServers) > 0 {
 		defaultConfig.Network.DNSServers = fileConfig.Network.DNSServers
 	}
+	if fileConfig.Network.Proxy != "" {
+		defaultConfig.Network.Proxy = fileConfig.Network.Proxy
+	}
+	if fileConfig.Network.SourceAddress != "" {
+		defaultConfig.Network.SourceAddress = fileConfig.Network.SourceAddress
+	}
+	if fileConfig.Network.Interface != "" {
+		defaultConfig.Network.Interface = fileConfig.Network.Interface
+	}
+	defaultConfig.Network.AllAddresses = fileConfig.Network.AllAddresses
+	if fileConfig.Network.IPVersion != "" {
+		defaultConfig.Network.IPVersion = fileConfig.Network.IPVersion
+	}
+	if fileConfig.Network.LatencySamples > 0 {
+		defaultConfig.Network.LatencySamples = fileConfig.Network.LatencySamples
+	}
+	// 限速配置为负数表示不限制，因此只跳过未设置的0
+	if fileConfig.Network.RateLimit.ConnectionsPerSecond != 0 {
+		defaultConfig.Network.RateLimit.ConnectionsPerSecond = fileConfig.Network.RateLimit.ConnectionsPerSecond
+	}
+	if fileConfig.Network.RateLimit.PerIP != 0 {
+		defaultConfig.Network.RateLimit.PerIP = fileConfig.Network.RateLimit.PerIP
+	}
+	if fileConfig.Network.RateLimit.PerSubnet != 0 {
+		defaultConfig.Network.RateLimit.PerSubnet = fileConfig.Network.RateLimit.PerSubnet
+	}
 
 	// TLS配置
 	if fileConfig.TLS.MinVersion > 0 {
@@ -93,9 +190,13 @@ func mergeConfig(defaultConfig *types.Config, fileConfig *types.Config) {
 	if fileConfig.Concurrency.MaxConcurrent > 0 {
 		defaultConfig.Concurrency.MaxConcurrent = fileConfig.Concurrency.MaxConcurrent
 	}
+	defaultConfig.Concurrency.Fixed = fileConfig.Concurrency.Fixed
 	if fileConfig.Concurrency.CheckTimeout > 0 {
 		defaultConfig.Concurrency.CheckTimeout = fileConfig.Concurrency.CheckTimeout
 	}
+	if fileConfig.Concurrency.StageTimeout > 0 {
+		defaultConfig.Concurrency.StageTimeout = fileConfig.Concurrency.StageTimeout
+	}
 	if fileConfig.Concurrency.CacheTTL > 0 {
 		defaultConfig.Concurrency.CacheTTL = fileConfig.Concurrency.CacheTTL
 	}
@@ -104,6 +205,9 @@ func mergeConfig(defaultConfig *types.Config, fileConfig *types.Config) {
 	if fileConfig.Output.Format != "" {
 		defaultConfig.Output.Format = fileConfig.Output.Format
 	}
+	if fileConfig.Output.JSONFile != "" {
+		defaultConfig.Output.JSONFile = fileConfig.Output.JSONFile
+	}
 	defaultConfig.Output.Color = fileConfig.Output.Color
 	defaultConfig.Output.Verbose = fileConfig.Output.Verbose
 
@@ -116,6 +220,9 @@ func mergeConfig(defaultConfig *types.Config, fileConfig *types.Config) {
 	if fileConfig.Cache.MaxSize > 0 {
 		defaultConfig.Cache.MaxSize = fileConfig.Cache.MaxSize
 	}
+	if fileConfig.Cache.Path != "" {
+		defaultConfig.Cache.Path = fileConfig.Cache.Path
+	}
 
 	// 批量配置
 	defaultConfig.Batch.StreamOutput = fileConfig.Batch.StreamOutput
@@ -126,15 +233,51 @@ func mergeConfig(defaultConfig *types.Config, fileConfig *types.Config) {
 	if fileConfig.Batch.Timeout > 0 {
 		defaultConfig.Batch.Timeout = fileConfig.Batch.Timeout
 	}
+
+	// 策略配置
+	mergePolicy(&defaultConfig.Policy, &fileConfig.Policy)
+
+	// 评分配置（未设置的阈值由评分器使用默认值）
+	if len(fileConfig.Scoring.Weights) > 0 {
+		if defaultConfig.Scoring.Weights == nil {
+			defaultConfig.Scoring.Weights = make(map[string]float64)
+		}
+		for name, weight := range fileConfig.Scoring.Weights {
+			defaultConfig.Scoring.Weights[name] = weight
+		}
+	}
+	if fileConfig.Scoring.MaxHandshake > 0 {
+		defaultConfig.Scoring.MaxHandshake = fileConfig.Scoring.MaxHandshake
+	}
+	if fileConfig.Scoring.MinCertDays > 0 {
+		defaultConfig.Scoring.MinCertDays = fileConfig.Scoring.MinCertDays
+	}
+	if fileConfig.Scoring.MaxJitter > 0 {
+		defaultConfig.Scoring.MaxJitter = fileConfig.Scoring.MaxJitter
+	}
+	if fileConfig.Scoring.MaxRedirects > 0 {
+		defaultConfig.Scoring.MaxRedirects = fileConfig.Scoring.MaxRedirects
+	}
+	if len(fileConfig.Scoring.PreferredIssuers) > 0 {
+		defaultConfig.Scoring.PreferredIssuers = fileConfig.Scoring.PreferredIssuers
+	}
+	if fileConfig.Scoring.VPSASN != "" {
+		defaultConfig.Scoring.VPSASN = fileConfig.Scoring.VPSASN
+	}
 }
 
 // getDefaultConfig 获取默认配置
 func getDefaultConfig() *types.Config {
 	return &types.Config{
 		Network: types.NetworkConfig{
-			Timeout:    3 * time.Second, // 减少到3秒
-			Retries:    1,
-			DNSServers: []string{"8.8.8.8", "1.1.1.1"},
+			Timeout:        3 * time.Second, // 减少到3秒
+			Retries:        1,
+			DNSServers:     []string{"8.8.8.8", "1.1.1.1"},
+			LatencySamples: types.DefaultLatencySamples,
+			RateLimit: types.RateLimitConfig{
+				PerIP:     4,
+				PerSubnet: 16,
+			},
 		},
 		TLS: types.TLSConfig{
 			MinVersion: 771, // TLS 1.2
@@ -142,7 +285,8 @@ func getDefaultConfig() *types.Config {
 		},
 		Concurrency: types.ConcurrencyConfig{
 			MaxConcurrent: 8,
-			CheckTimeout:  3 * time.Second, // 减少到3秒
+			CheckTimeout:  30 * time.Second,
+			StageTimeout:  10 * time.Second,
 			CacheTTL:      5 * time.Minute,
 		},
 		Output: types.OutputConfig{
@@ -155,12 +299,19 @@ func getDefaultConfig() *types.Config {
 			ResultEnabled: true,
 			TTL:           5 * time.Minute,
 			MaxSize:       1000,
+			Path:          "data/result_cache.json",
 		},
 		Batch: types.BatchConfig{
 			StreamOutput: false,
 			ProgressBar:  true,
 			ReportFormat: "text",
-			Timeout:      30 * time.Second,
+			Timeout:      0, // 不限制总时间
+		},
+		Policy: types.PolicyConfig{
+			Rules:              append([]string{}, types.DefaultPolicyRules...),
+			AllowedStatusCodes: append([]int{}, types.DefaultSafeStatusCodes...),
+			DomesticCountries:  append([]string{}, types.DefaultDomesticCountries...),
+			MinCertDays:        1, // 只要求证书未过期
 		},
 	}
 }
@@ -177,6 +328,9 @@ func validateAndSetDefaults(config *types.Config) {
 	if len(config.Network.DNSServers) == 0 {
 		config.Network.DNSServers = []string{"8.8.8.8", "1.1.1.1"}
 	}
+	if config.Network.LatencySamples <= 0 {
+		config.Network.LatencySamples = types.DefaultLatencySamples
+	}
 
 	// TLS配置验证
 	if config.TLS.MinVersion == 0 {
@@ -193,6 +347,9 @@ func validateAndSetDefaults(config *types.Config) {
 	if config.Concurrency.CheckTimeout <= 0 {
 		config.Concurrency.CheckTimeout = 30 * time.Second
 	}
+	if config.Concurrency.StageTimeout <= 0 {
+		config.Concurrency.StageTimeout = 10 * time.Second
+	}
 	if config.Concurrency.CacheTTL <= 0 {
 		config.Concurrency.CacheTTL = 5 * time.Minute
 	}
@@ -209,12 +366,29 @@ func validateAndSetDefaults(config *types.Config) {
 	if config.Cache.MaxSize <= 0 {
 		config.Cache.MaxSize = 1000
 	}
+	if config.Cache.Path == "" {
+		config.Cache.Path = "data/result_cache.json"
+	}
 
 	// 批量配置验证
 	if config.Batch.ReportFormat == "" {
 		config.Batch.ReportFormat = "text"
 	}
-	if config.Batch.Timeout <= 0 {
-		config.Batch.Timeout = 60 * time.Second
+	if config.Batch.Timeout < 0 {
+		config.Batch.Timeout = 0
+	}
+
+	// 策略配置验证
+	if len(config.Policy.Rules) == 0 {
+		config.Policy.Rules = append([]string{}, types.DefaultPolicyRules...)
+	}
+	if len(config.Policy.AllowedStatusCodes) == 0 {
+		config.Policy.AllowedStatusCodes = append([]int{}, types.DefaultSafeStatusCodes...)
+	}
+	if len(config.Policy.DomesticCountries) == 0 {
+		config.Policy.DomesticCountries = append([]string{}, types.DefaultDomesticCountries...)
+	}
+	if config.Policy.MinCertDays <= 0 {
+		config.Policy.MinCertDays = 1
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sync"
 
+	"RealityChecker/internal/cache"
 	"RealityChecker/internal/network"
 	"RealityChecker/internal/types"
 )
@@ -14,6 +15,8 @@ type Engine struct {
 	config      *types.Config
 	pipeline    *Pipeline
 	connections *network.ConnectionManager
+	results     *cache.ResultStore // 结果缓存，未启用或加载失败时为nil
+	cacheMode   cache.Mode
 	mu          sync.RWMutex
 	running     bool
 }
@@ -45,7 +48,15 @@ func (e *Engine) Start() error {
 		return fmt.Errorf("启动连接管理器失败: %v", err)
 	}
 
-	// 缓存管理器已移除
+	// 加载结果缓存，缓存文件损坏时不使用缓存，不影响检测
+	if e.config.Cache.ResultEnabled && e.results == nil {
+		results, err := cache.NewResultStore(e.config)
+		if err != nil {
+			fmt.Printf("结果缓存不可用: %v\n", err)
+		} else {
+			e.results = results
+		}
+	}
 
 	e.running = true
 	return nil
@@ -60,7 +71,12 @@ func (e *Engine) Stop() error {
 		return nil
 	}
 
-	// 缓存管理器已移除
+	// 写回结果缓存
+	if e.results != nil && e.cacheMode != cache.ModeDisabled {
+		if err := e.results.Save(); err != nil {
+			fmt.Printf("保存结果缓存失败: %v\n", err)
+		}
+	}
 
 	// 停止连接管理器
 	if err := e.connections.Stop(); err != nil {
@@ -73,11 +89,34 @@ func (e *Engine) Stop() error {
 
 // CheckDomain 检测单个域名（直接使用pipeline，简化架构）
 func (e *Engine) CheckDomain(ctx context.Context, domain string) (*types.DetectionResult, error) {
-	if !e.running {
+	// 本次检测使用的缓存方式在开始时确定，检测期间修改只影响之后的检测
+	e.mu.RLock()
+	running, results, mode := e.running, e.results, e.cacheMode
+	e.mu.RUnlock()
+
+	if !running {
 		return nil, fmt.Errorf("引擎未运行")
 	}
 
-	return e.pipeline.Execute(ctx, domain)
+	useCache := results != nil && mode != cache.ModeDisabled
+	if useCache && mode != cache.ModeRefresh {
+		if result, ok := results.Get(domain); ok {
+			return result, nil
+		}
+	}
+
+	result, err := e.pipeline.Execute(ctx, domain)
+	if err == nil && useCache && ctx.Err() == nil {
+		results.Put(result)
+	}
+	return result, err
+}
+
+// SetCacheMode 设置结果缓存的使用方式
+func (e *Engine) SetCacheMode(mode cache.Mode) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cacheMode = mode
 }
 
 // CheckDomains 批量检测域名（移除并发控制，由调用方管理）
@@ -95,12 +134,10 @@ func (e *Engine) CheckDomains(ctx context.Context, domains []string) ([]*types.D
 
 	for i, domain := range domains {
 		// 直接执行检测，不进行并发控制
-		result, err := e.pipeline.Execute(ctx, domain)
+		result, err := e.CheckDomain(ctx, domain)
 		if err != nil {
-			result = &types.DetectionResult{
-				Domain: domain,
-				Error:  err,
-			}
+			result = types.NewTargetResult(domain)
+			result.Error = err
 		}
 		results[i] = result
 	}
@@ -130,12 +167,10 @@ func (e *Engine) CheckDomainsStream(ctx context.Context, domains []string) (<-ch
 				semaphore <- struct{}{}
 				defer func() { <-semaphore }()
 
-				result, err := e.pipeline.Execute(ctx, domain)
+				result, err := e.CheckDomain(ctx, domain)
 				if err != nil {
-					result = &types.DetectionResult{
-						Domain: domain,
-						Error:  err,
-					}
+					result = types.NewTargetResult(domain)
+					result.Error = err
 				}
 
 				select {
@@ -152,6 +187,11 @@ func (e *Engine) CheckDomainsStream(ctx context.Context, domains []string) (<-ch
 	return resultChan, nil
 }
 
+// GetStages 获取流水线的检测阶段（按拓扑顺序）
+func (e *Engine) GetStages() []types.DetectionStage {
+	return e.pipeline.GetStages()
+}
+
 // GetStats 获取引擎统计信息（简化版本）
 func (e *Engine) GetStats() *EngineStats {
 	e.mu.RLock()
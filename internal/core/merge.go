@@ -0,0 +1,116 @@
+package core
+
+import (
+	"RealityChecker/internal/types"
+)
+
+// mergeResult 将阶段的部分结果合并到目标结果
+// 调用方按拓扑顺序依次合并，保证结果与阶段完成的先后无关；
+// 合并时不修改已有的子结果，而是生成新对象，已分发给阶段的快照不受影响
+// 部分结果中的 EarlyExit 只是阶段的退出请求，是否真正退出由调度器决定，不在此合并
+func mergeResult(dst, partial *types.DetectionResult) {
+	if partial == nil {
+		return
+	}
+
+	if partial.StatusCodeCategory != "" {
+		dst.StatusCodeCategory = partial.StatusCodeCategory
+	}
+
+	// 单一生产者的结果，后合并的覆盖先合并的
+	if partial.Network != nil {
+		dst.Network = partial.Network
+	}
+	if partial.TLS != nil {
+		dst.TLS = partial.TLS
+	}
+	if partial.Certificate != nil {
+		dst.Certificate = partial.Certificate
+	}
+	if partial.SNI != nil {
+		dst.SNI = partial.SNI
+	}
+	if partial.PageStatus != nil {
+		dst.PageStatus = partial.PageStatus
+	}
+	if partial.Blocked != nil {
+		dst.Blocked = partial.Blocked
+	}
+	if partial.Summary != nil {
+		dst.Summary = partial.Summary
+	}
+	if len(partial.Addresses) > 0 {
+		dst.Addresses = partial.Addresses
+	}
+	if partial.IPv6 != nil {
+		dst.IPv6 = partial.IPv6
+	}
+
+	// 多个阶段共同产出的结果，按字段合并
+	dst.Location = mergeLocation(dst.Location, partial.Location)
+	dst.CDN = mergeCDN(dst.CDN, partial.CDN)
+}
+
+// mergeLocation 合并地理位置结果，非空字段覆盖
+func mergeLocation(base, partial *types.LocationResult) *types.LocationResult {
+	if partial == nil {
+		return base
+	}
+	merged := types.LocationResult{}
+	if base != nil {
+		merged = *base
+	}
+
+	if partial.Country != "" {
+		merged.Country = partial.Country
+	}
+	if partial.CountryCode != "" {
+		merged.CountryCode = partial.CountryCode
+	}
+	if partial.IPAddress != "" {
+		merged.IPAddress = partial.IPAddress
+	}
+	if partial.ISP != "" {
+		merged.ISP = partial.ISP
+	}
+	if partial.ASN != "" {
+		merged.ASN = partial.ASN
+	}
+	if partial.City != "" {
+		merged.City = partial.City
+	}
+	if partial.Region != "" {
+		merged.Region = partial.Region
+	}
+	if partial.IPVersion != 0 {
+		merged.IPVersion = partial.IPVersion
+	}
+	merged.IsDomestic = merged.IsDomestic || partial.IsDomestic
+
+	return &merged
+}
+
+// mergeCDN 合并CDN结果
+// 先得出的CDN结论优先（HTTP特征置信度高于证书特征），热门网站标记取并集
+func mergeCDN(base, partial *types.CDNResult) *types.CDNResult {
+	if partial == nil {
+		return base
+	}
+	merged := types.CDNResult{}
+	if base != nil {
+		merged = *base
+	}
+
+	if partial.IsCDN && !merged.IsCDN {
+		merged.IsCDN = true
+		merged.CDNProvider = partial.CDNProvider
+		merged.Confidence = partial.Confidence
+		merged.Evidence = partial.Evidence
+	}
+	merged.IsHotWebsite = merged.IsHotWebsite || partial.IsHotWebsite
+	if merged.Error == nil {
+		merged.Error = partial.Error
+	}
+
+	return &merged
+}
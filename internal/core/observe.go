@@ -0,0 +1,127 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"RealityChecker/internal/types"
+)
+
+// describePartial 按阶段声明的产出描述其部分结果，供 explain 输出
+// 只描述部分结果中实际存在的数据，阶段未产出任何数据时返回空字符串
+func describePartial(stage types.DetectionStage, partial *types.DetectionResult) string {
+	if partial == nil {
+		return ""
+	}
+
+	produces := make(map[types.Artifact]bool)
+	for _, artifact := range stage.Produces() {
+		produces[artifact] = true
+	}
+
+	var parts []string
+
+	if partial.Blocked != nil {
+		if partial.Blocked.IsBlocked {
+			parts = append(parts, fmt.Sprintf("被墙（%s）", strings.Join(partial.Blocked.BlockedReasons, ", ")))
+		} else {
+			parts = append(parts, "未被墙")
+		}
+	}
+
+	if partial.Network != nil {
+		if !partial.Network.Accessible {
+			parts = append(parts, "不可达")
+		} else {
+			parts = append(parts, fmt.Sprintf("状态码%d", partial.Network.StatusCode))
+			if partial.Network.IsRedirected {
+				parts = append(parts, fmt.Sprintf("重定向%d次至%s", partial.Network.RedirectCount, partial.Network.FinalDomain))
+			}
+		}
+	}
+
+	if partial.StatusCodeCategory != "" {
+		parts = append(parts, fmt.Sprintf("状态码分类%s", partial.StatusCodeCategory))
+	}
+
+	if location := partial.Location; location != nil {
+		if location.IPAddress != "" {
+			parts = append(parts, fmt.Sprintf("IP %s", location.IPAddress))
+		}
+		if location.Country != "" {
+			country := location.Country
+			if location.CountryCode != "" {
+				country = fmt.Sprintf("%s(%s)", country, location.CountryCode)
+			}
+			parts = append(parts, country)
+		}
+		if location.ASN != "" {
+			parts = append(parts, location.ASN)
+		}
+	}
+
+	if tls := partial.TLS; tls != nil {
+		parts = append(parts, fmt.Sprintf("%s X25519=%t H2=%t", tls.ProtocolVersion, tls.SupportsX25519, tls.SupportsHTTP2))
+		if tls.Latency != nil {
+			parts = append(parts, fmt.Sprintf("握手中位数%dms（%d/%d次采样）", tls.Handshake().Milliseconds(), tls.Latency.Samples, tls.Latency.Attempts))
+		} else if tls.HandshakeTime > 0 {
+			parts = append(parts, fmt.Sprintf("握手%dms", tls.HandshakeTime.Milliseconds()))
+		}
+	}
+
+	if partial.SNI != nil {
+		parts = append(parts, fmt.Sprintf("SNI匹配=%t", partial.SNI.SNIMatch))
+	}
+
+	if cert := partial.Certificate; cert != nil {
+		if cert.Valid {
+			parts = append(parts, fmt.Sprintf("证书有效（剩余%d天）", cert.DaysUntilExpiry))
+		} else {
+			parts = append(parts, "证书无效")
+		}
+	}
+
+	if cdn := partial.CDN; cdn != nil {
+		if produces[types.ArtifactCDN] {
+			if cdn.IsCDN {
+				parts = append(parts, fmt.Sprintf("CDN %s(%s)", cdn.CDNProvider, cdn.Confidence))
+			} else {
+				parts = append(parts, "未检测到CDN")
+			}
+		}
+		if produces[types.ArtifactHotWebsite] {
+			if cdn.IsHotWebsite {
+				parts = append(parts, "热门网站")
+			} else {
+				parts = append(parts, "非热门网站")
+			}
+		}
+	}
+
+	if len(partial.Addresses) > 0 {
+		failed := 0
+		for _, address := range partial.Addresses {
+			if address.Error != "" {
+				failed++
+			}
+		}
+		if failed > 0 {
+			parts = append(parts, fmt.Sprintf("检测%d个地址，%d个握手失败", len(partial.Addresses), failed))
+		} else {
+			parts = append(parts, fmt.Sprintf("检测%d个地址", len(partial.Addresses)))
+		}
+	}
+
+	if ipv6 := partial.IPv6; ipv6 != nil {
+		switch {
+		case ipv6.Error != "" && ipv6.IP == "":
+			parts = append(parts, ipv6.Error)
+		case ipv6.Error != "":
+			parts = append(parts, fmt.Sprintf("IPv6 %s 握手失败", ipv6.IP))
+		default:
+			parts = append(parts, fmt.Sprintf("IPv6 %s %s X25519=%t H2=%t", ipv6.IP, ipv6.TLS.ProtocolVersion, ipv6.TLS.SupportsX25519, ipv6.TLS.SupportsHTTP2))
+		}
+	}
+
+	return strings.Join(parts, "，")
+}
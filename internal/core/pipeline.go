@@ -3,18 +3,27 @@ package core
 import (
 	"context"
 	"fmt"
-	"sort"
-	"sync"
+	"net"
+	"strconv"
 	"time"
 
 	"RealityChecker/internal/detectors"
 	"RealityChecker/internal/network"
+	"RealityChecker/internal/policy"
+	"RealityChecker/internal/scoring"
 	"RealityChecker/internal/types"
 )
 
 // Pipeline 检测流水线
 type Pipeline struct {
 	stages      []types.DetectionStage
+	plan        *stagePlan
+	policy      *policy.Engine
+	policyErr   error
+	resolver    *network.Resolver
+	resolverErr error
+	stagesErr   error
+	scorer      *scoring.Scorer
 	config      *types.Config
 	earlyExit   bool
 	connections *network.ConnectionManager
@@ -28,223 +37,218 @@ func NewPipeline(connections *network.ConnectionManager, config *types.Config) *
 		connections: connections,
 	}
 
-	// 初始化检测阶段
-	pipeline.initializeStages()
+	// 初始化策略引擎，配置加载时已校验，这里的错误留到执行时返回
+	var policyConfig types.PolicyConfig
+	if config != nil {
+		policyConfig = config.Policy
+	}
+	pipeline.policy, pipeline.policyErr = policy.NewEngine(policyConfig)
+	pipeline.scorer = scoring.NewScorer(config)
+
+	// 初始化DNS解析器，所有阶段共用配置的上游服务器
+	pipeline.resolver, pipeline.resolverErr = network.NewResolver(config)
+
+	// 初始化检测阶段，依赖图构建失败时错误留到执行时返回
+	pipeline.stagesErr = pipeline.initializeStages()
 
 	return pipeline
 }
 
 // initializeStages 初始化检测阶段
-func (p *Pipeline) initializeStages() {
-	p.stages = []types.DetectionStage{
-		detectors.NewBlockedStage(),          // 1. 被墙检测 (最高优先级)
-		detectors.NewRedirectStage(),         // 2. 重定向检测
-		detectors.NewStatusCheckStage(),      // 3. 状态码检查
-		detectors.NewIPResolverStage(),       // 4. IP解析
-		detectors.NewLocationStage(),         // 5. 地理位置检测
-		detectors.NewLocationCheckStage(),    // 6. 地理位置检查
-		detectors.NewComprehensiveTLSStage(), // 7. 综合TLS检测 (TLS1.3、X25519、H2、SNI、证书、CDN)
-		detectors.NewHotWebsiteStage(),       // 8. 热门网站检测
+// 执行顺序由各阶段声明的依赖决定，无需手动排序
+func (p *Pipeline) initializeStages() error {
+	location := detectors.NewLocationStage()
+	comprehensiveTLS := detectors.NewComprehensiveTLSStage()
+	stages := []types.DetectionStage{
+		detectors.NewBlockedStage(),       // 被墙检测
+		detectors.NewRedirectStage(),      // 重定向检测
+		detectors.NewStatusCheckStage(),   // 状态码检查
+		detectors.NewIPResolverStage(),    // IP解析
+		location,                          // 地理位置检测
+		detectors.NewLocationCheckStage(), // 地理位置检查
+		comprehensiveTLS,                  // 综合TLS检测 (TLS1.3、X25519、H2、SNI、证书、CDN)
+		detectors.NewHotWebsiteStage(),    // 热门网站检测
 	}
 
-	// 按优先级排序
-	sort.Slice(p.stages, func(i, j int) bool {
-		return p.stages[i].Priority() < p.stages[j].Priority()
-	})
+	// 多地址模式下逐个检测域名的所有地址
+	if p.config != nil && p.config.Network.AllAddresses {
+		stages = append(stages, detectors.NewAddressStage(location, comprehensiveTLS))
+	}
+
+	// 双栈模式下另外检测IPv6地址
+	if p.config != nil && p.config.Network.IPVersion == types.IPVersionBoth {
+		stages = append(stages, detectors.NewDualStackStage(location, comprehensiveTLS))
+	}
+
+	return p.setStages(stages)
 }
 
-// Execute 执行检测流水线
-func (p *Pipeline) Execute(ctx context.Context, domain string) (*types.DetectionResult, error) {
+// setStages 设置检测阶段并重建依赖图
+func (p *Pipeline) setStages(stages []types.DetectionStage) error {
+	plan, err := buildStagePlan(stages)
+	if err != nil {
+		return err
+	}
+	p.plan = plan
+	p.stages = plan.stages
+	return nil
+}
+
+// Execute 执行检测流水线，target 的写法见 types.ParseTarget
+func (p *Pipeline) Execute(ctx context.Context, target string) (*types.DetectionResult, error) {
+	if p.policyErr != nil {
+		return nil, fmt.Errorf("策略配置无效: %v", p.policyErr)
+	}
+	if p.resolverErr != nil {
+		return nil, fmt.Errorf("DNS配置无效: %v", p.resolverErr)
+	}
+	if p.stagesErr != nil {
+		return nil, fmt.Errorf("检测阶段配置无效: %v", p.stagesErr)
+	}
+
 	startTime := time.Now()
+	parsed := types.ParseTarget(target)
+	domain, port := parsed.Domain, parsed.Port
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("端口无效: %s", port)
+	}
+	if parsed.IP != "" && net.ParseIP(parsed.IP) == nil {
+		return nil, fmt.Errorf("连接地址无效: %s", parsed.IP)
+	}
 
 	// 创建流水线上下文
 	pipelineCtx := &types.PipelineContext{
 		Domain:      domain,
+		Port:        port,
+		ConnectIP:   parsed.IP,
 		StartTime:   startTime,
-		Result:      &types.DetectionResult{Domain: domain, StartTime: startTime},
+		Result:      &types.DetectionResult{Domain: domain, Port: portNumber, ConnectIP: parsed.IP, StartTime: startTime},
 		Connections: p.connections, // 传递连接管理器给检测器
-		Cache:       nil,           // 缓存管理器已移除
+		Resolver:    p.resolver,
+		DNSCache:    types.NewDNSCache(0), // 记录集只在本次检测内有效
 		Config:      p.config,
 		Context:     ctx, // 传递原始context
-		EarlyExit:   false,
 	}
 
-	// 并发执行检测阶段，提高检测效率
-	p.executeStagesConcurrently(ctx, pipelineCtx)
+	// 指定连接地址时不解析域名，所有连接都使用该地址
+	if parsed.IP != "" {
+		network.PinRecords(pipelineCtx, domain, parsed.IP)
+	}
+
+	// 按依赖图执行检测阶段，互不依赖的阶段并发执行
+	p.plan.run(ctx, pipelineCtx, p.earlyExit, p.stageTimeout())
 
 	// 计算总耗时
 	pipelineCtx.Result.Duration = time.Since(startTime)
 
 	// 评估适合性
-	p.evaluateSuitability(pipelineCtx.Result)
+	p.evaluateSuitability(ctx, pipelineCtx.Result)
+
+	// 计算推荐评分
+	pipelineCtx.Result.Score = p.scorer.Score(pipelineCtx.Result)
 
 	return pipelineCtx.Result, nil
 }
 
-// executeStagesConcurrently 并发执行检测阶段
-func (p *Pipeline) executeStagesConcurrently(ctx context.Context, pipelineCtx *types.PipelineContext) {
-	// 将检测阶段分为两组：阻塞检测和网络检测
-	var blockingStages []types.DetectionStage
-	var networkStages []types.DetectionStage
-
-	for _, stage := range p.stages {
-		if stage.CanEarlyExit() {
-			blockingStages = append(blockingStages, stage)
-		} else {
-			networkStages = append(networkStages, stage)
-		}
+// evaluateSuitability 评估适合性
+// 按策略引擎评估硬性条件，不适合时写入结构化结论，技术错误保留在 Error/StageErrors 中
+func (p *Pipeline) evaluateSuitability(ctx context.Context, result *types.DetectionResult) {
+	// 按策略分类状态码
+	if result.Network != nil {
+		result.StatusCodeCategory = p.policy.Policy(result.Domain).ClassifyStatusCode(result.Network.StatusCode, result.Network.Accessible)
 	}
 
-	// 先执行阻塞检测（被墙检测、地理位置检测等）
-	for _, stage := range blockingStages {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
+	// 先评估多地址模式下的各个地址和双栈模式下的IPv6地址，addresses、ipv6 规则据此判断
+	p.policy.EvaluateAddresses(ctx, result)
 
-		if err := stage.Execute(pipelineCtx); err != nil {
-			pipelineCtx.Result.Error = err
-			if stage.CanEarlyExit() {
-				pipelineCtx.EarlyExit = true
-				return
-			}
-		}
-
-		// 检查是否需要早期退出
-		if p.earlyExit && stage.CanEarlyExit() && pipelineCtx.EarlyExit {
-			pipelineCtx.Result.EarlyExit = true
+	// 评估全部规则，第一个未通过的规则作为结论
+	result.Rules = p.policy.EvaluateAll(ctx, result)
+	p.markFailedStages(result)
+	p.evaluateFamilies(result)
+	for _, outcome := range result.Rules {
+		if !outcome.Passed {
+			result.Suitable = false
+			result.Verdict = outcome.Verdict
 			return
 		}
 	}
 
-	// 如果被阻塞，直接返回
-	if pipelineCtx.EarlyExit {
-		return
-	}
-
-	// 并发执行网络检测阶段
-	if len(networkStages) > 0 {
-		p.executeNetworkStagesConcurrently(ctx, pipelineCtx, networkStages)
-	}
-}
-
-// executeNetworkStagesConcurrently 并发执行网络检测阶段
-func (p *Pipeline) executeNetworkStagesConcurrently(ctx context.Context, pipelineCtx *types.PipelineContext, stages []types.DetectionStage) {
-	// 使用信号量控制网络检测的并发数
-	networkConcurrency := 4 // 网络检测使用4个并发
-	semaphore := make(chan struct{}, networkConcurrency)
-
-	var wg sync.WaitGroup
-	for i, stage := range stages {
-		wg.Add(1)
-		go func(index int, s types.DetectionStage) {
-			defer wg.Done()
-
-			// 获取信号量
-			select {
-			case semaphore <- struct{}{}:
-				defer func() {
-					<-semaphore
-				}()
-			case <-ctx.Done():
-				return
-			}
-
-			// 执行检测阶段
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						pipelineCtx.Result.Error = fmt.Errorf("检测阶段 %s panic: %v", s.Name(), r)
-					}
-				}()
-
-				if err := s.Execute(pipelineCtx); err != nil {
-					pipelineCtx.Result.Error = err
-				}
-			}()
-		}(i, stage)
-	}
-
-	wg.Wait()
+	// 所有硬性条件都符合
+	result.Suitable = true
+	result.HardRequirementsMet = true
 }
 
-// evaluateSuitability 评估适合性
-func (p *Pipeline) evaluateSuitability(result *types.DetectionResult) {
-	// 检查硬性条件
-	if result.Blocked != nil && result.Blocked.IsBlocked {
-		result.Suitable = false
-		result.Error = fmt.Errorf("域名被墙")
+// evaluateFamilies 双栈模式下分别给出IPv4和IPv6的结论
+// IPv4的结论为除 ipv6 规则外第一个未通过的规则，IPv6的结论来自对IPv6地址的单独评估；
+// 域名只有IPv6地址时主要检测使用的是IPv6地址，IPv4的结论为没有地址
+func (p *Pipeline) evaluateFamilies(result *types.DetectionResult) {
+	if result.IPv6 == nil {
 		return
 	}
 
-	if result.Location != nil && result.Location.IsDomestic {
-		result.Suitable = false
-		result.Error = fmt.Errorf("国内网站")
-		return
+	ipv4 := types.FamilyResult{Family: "IPv4", Passed: true}
+	if result.Location != nil {
+		ipv4.IP = result.Location.IPAddress
 	}
-
-	if result.Network != nil && !result.Network.Accessible {
-		result.Suitable = false
-		result.Error = fmt.Errorf("网络不可达")
-		result.StatusCodeCategory = types.StatusCodeCategoryNetwork
-		return
+	if network.IPVersion(ipv4.IP) == 6 {
+		ipv4 = types.FamilyResult{Family: "IPv4", Verdict: types.NewVerdict(types.ReasonUnreachable, "未找到IPv4地址")}
+		ipv4.Verdict.Rule = types.RuleReachable
+	} else {
+		for _, outcome := range result.Rules {
+			if !outcome.Passed && outcome.Rule != types.RuleIPv6 {
+				ipv4.Passed = false
+				ipv4.Verdict = outcome.Verdict
+				break
+			}
+		}
 	}
 
-	// 检查状态码是否安全
-	if result.Network != nil && result.Network.Accessible {
-		statusCodeCategory := types.ClassifyStatusCode(result.Network.StatusCode, true)
-		result.StatusCodeCategory = statusCodeCategory
-
-		// 如果状态码不安全，标记为不适合
-		if statusCodeCategory == types.StatusCodeCategoryExcluded {
-			result.Suitable = false
-			result.Error = fmt.Errorf("状态码不自然: %d", result.Network.StatusCode)
-			return
-		}
+	result.Families = []types.FamilyResult{
+		ipv4,
+		{Family: "IPv6", IP: result.IPv6.IP, Passed: result.IPv6.Passed, Verdict: result.IPv6.Verdict},
 	}
+}
 
-	if result.TLS != nil {
-		if !result.TLS.SupportsTLS13 {
-			result.Suitable = false
-			result.Error = fmt.Errorf("不支持TLS 1.3")
-			return
+// markFailedStages 将未通过规则所检查数据的生产阶段标记为未通过
+func (p *Pipeline) markFailedStages(result *types.DetectionResult) {
+	failed := make(map[types.Artifact]bool)
+	for _, outcome := range result.Rules {
+		if outcome.Passed {
+			continue
 		}
-		if !result.TLS.SupportsX25519 {
-			result.Suitable = false
-			result.Error = fmt.Errorf("不支持X25519密钥交换")
-			return
-		}
-		if !result.TLS.SupportsHTTP2 {
-			result.Suitable = false
-			result.Error = fmt.Errorf("不支持HTTP/2")
-			return
+		for _, artifact := range policy.RuleArtifacts(outcome.Rule, result) {
+			failed[artifact] = true
 		}
 	}
+	if len(failed) == 0 {
+		return
+	}
 
-	if result.Certificate != nil {
-		if !result.Certificate.Valid {
-			result.Suitable = false
-			result.Error = fmt.Errorf("证书无效")
-			return
+	produces := make(map[string][]types.Artifact)
+	for _, stage := range p.stages {
+		produces[stage.Name()] = stage.Produces()
+	}
+	for i := range result.Stages {
+		report := &result.Stages[i]
+		if !report.Ran {
+			continue
 		}
-		// 只有真正过期的证书才标记为不适合（天数小于等于0）
-		if result.Certificate.DaysUntilExpiry <= 0 {
-			result.Suitable = false
-			result.Error = fmt.Errorf("证书已过期（%d天）", result.Certificate.DaysUntilExpiry)
-			return
+		for _, artifact := range produces[report.Name] {
+			if failed[artifact] {
+				report.Outcome = types.StageOutcomeFailed
+				break
+			}
 		}
 	}
+}
 
-	if result.SNI != nil && (!result.SNI.SupportsSNI || !result.SNI.SNIMatch) {
-		result.Suitable = false
-		result.Error = fmt.Errorf("SNI不匹配")
-		return
+// stageTimeout 单个检测阶段的时限，未配置时不限制
+func (p *Pipeline) stageTimeout() time.Duration {
+	if p.config == nil {
+		return 0
 	}
-
-	// 所有硬性条件都符合
-	result.Suitable = true
-	result.HardRequirementsMet = true
+	return p.config.Concurrency.StageTimeout
 }
 
 // SetEarlyExit 设置是否早期退出
@@ -252,26 +256,54 @@ func (p *Pipeline) SetEarlyExit(earlyExit bool) {
 	p.earlyExit = earlyExit
 }
 
-// GetStages 获取检测阶段
+// GetStages 获取检测阶段（按拓扑顺序）
 func (p *Pipeline) GetStages() []types.DetectionStage {
 	return p.stages
 }
 
 // AddStage 添加检测阶段
-func (p *Pipeline) AddStage(stage types.DetectionStage) {
-	p.stages = append(p.stages, stage)
-	sort.Slice(p.stages, func(i, j int) bool {
-		return p.stages[i].Priority() < p.stages[j].Priority()
-	})
+// 名称重复或引入循环依赖时返回错误，流水线保持不变
+func (p *Pipeline) AddStage(stage types.DetectionStage) error {
+	stages := append(append([]types.DetectionStage{}, p.stages...), stage)
+	return p.setStages(stages)
 }
 
 // RemoveStage 移除检测阶段
-func (p *Pipeline) RemoveStage(name string) {
-	var newStages []types.DetectionStage
+// 阶段不存在，或移除后其他阶段依赖的结果没有生产者时返回错误，流水线保持不变
+func (p *Pipeline) RemoveStage(name string) error {
+	var (
+		newStages []types.DetectionStage
+		removed   types.DetectionStage
+	)
 	for _, stage := range p.stages {
-		if stage.Name() != name {
+		if stage.Name() == name {
+			removed = stage
+		} else {
 			newStages = append(newStages, stage)
 		}
 	}
-	p.stages = newStages
+	if removed == nil {
+		return fmt.Errorf("检测阶段不存在: %s", name)
+	}
+
+	// 依赖图把没有生产者的结果视为已就绪，移除唯一的生产者后消费者会读不到结果
+	produced := make(map[types.Artifact]bool)
+	for _, stage := range newStages {
+		for _, artifact := range stage.Produces() {
+			produced[artifact] = true
+		}
+	}
+	for _, artifact := range removed.Produces() {
+		if produced[artifact] {
+			continue
+		}
+		for _, stage := range newStages {
+			for _, consumed := range stage.Consumes() {
+				if consumed == artifact {
+					return fmt.Errorf("移除检测阶段 %s 后，阶段 %s 依赖的 %s 没有生产者", name, stage.Name(), artifact)
+				}
+			}
+		}
+	}
+	return p.setStages(newStages)
 }
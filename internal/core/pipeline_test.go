@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"RealityChecker/internal/policy"
+	"RealityChecker/internal/types"
+)
+
+func TestRemoveStage(t *testing.T) {
+	p := &Pipeline{}
+	err := p.setStages([]types.DetectionStage{
+		&fakeStage{name: "redirect", priority: 2, produces: []types.Artifact{types.ArtifactFinalDomain}},
+		&fakeStage{name: "cdn", priority: 8, produces: []types.Artifact{types.ArtifactCDN}, consumes: []types.Artifact{types.ArtifactFinalDomain}},
+		&fakeStage{name: "hot_website", priority: 9, produces: []types.Artifact{types.ArtifactHotWebsite}},
+	})
+	if err != nil {
+		t.Fatalf("setStages: %v", err)
+	}
+
+	// 移除唯一的生产者会让消费者读不到结果
+	err = p.RemoveStage("redirect")
+	if err == nil || !strings.Contains(err.Error(), "cdn") || !strings.Contains(err.Error(), string(types.ArtifactFinalDomain)) {
+		t.Fatalf("错误 = %v，期望指出 cdn 缺少 final_domain", err)
+	}
+	if len(p.GetStages()) != 3 {
+		t.Fatalf("移除失败后阶段数 = %d，期望保持 3", len(p.GetStages()))
+	}
+
+	if err := p.RemoveStage("missing"); err == nil {
+		t.Fatal("移除不存在的阶段未报错")
+	}
+
+	if err := p.RemoveStage("hot_website"); err != nil {
+		t.Fatalf("RemoveStage: %v", err)
+	}
+	if got := strings.Join(stageNames(p.GetStages()), ","); got != "redirect,cdn" {
+		t.Fatalf("阶段 = %s，期望 redirect,cdn", got)
+	}
+
+	// 还有其他生产者时可以移除
+	if err := p.AddStage(&fakeStage{name: "redirect_fallback", priority: 3, produces: []types.Artifact{types.ArtifactFinalDomain}}); err != nil {
+		t.Fatalf("AddStage: %v", err)
+	}
+	if err := p.RemoveStage("redirect"); err != nil {
+		t.Fatalf("RemoveStage: %v", err)
+	}
+}
+
+// ipv6OnlyResult 双栈模式下只有IPv6地址的域名：主要检测和IPv6检测都使用同一个IPv6地址
+func ipv6OnlyResult(ipv6Status int) *types.DetectionResult {
+	tls := &types.TLSResult{ProtocolVersion: "TLS 1.3", SupportsTLS13: true, SupportsX25519: true, SupportsHTTP2: true}
+	cert := &types.CertificateResult{Valid: true, DaysUntilExpiry: 90}
+	sni := &types.SNIResult{SupportsSNI: true, SNIMatch: true}
+	location := &types.LocationResult{Country: "美国", CountryCode: "US", IPAddress: "2001:db8::1", IPVersion: 6}
+
+	result := types.NewTargetResult("example.com")
+	result.Network = &types.NetworkResult{Accessible: true, StatusCode: 200, FinalDomain: "example.com"}
+	result.Location, result.TLS, result.Certificate, result.SNI = location, tls, cert, sni
+	result.IPv6 = &types.AddressResult{
+		IP:          "2001:db8::1",
+		Network:     &types.NetworkResult{Accessible: true, StatusCode: ipv6Status, FinalDomain: "example.com"},
+		Location:    location,
+		TLS:         tls,
+		Certificate: cert,
+		SNI:         sni,
+	}
+	return result
+}
+
+func TestEvaluateSuitabilityIPv6OnlyInBothMode(t *testing.T) {
+	engine, err := policy.NewEngine(types.PolicyConfig{})
+	if err != nil {
+		t.Fatalf("NewEngine: %v", err)
+	}
+	p := &Pipeline{policy: engine}
+
+	result := ipv6OnlyResult(200)
+	p.evaluateSuitability(context.Background(), result)
+	if !result.Suitable {
+		t.Fatalf("只有IPv6的域名不适合: %v", result.Verdict)
+	}
+	if len(result.Families) != 2 {
+		t.Fatalf("地址族结论 = %+v", result.Families)
+	}
+	ipv4, ipv6 := result.Families[0], result.Families[1]
+	if ipv4.Passed || ipv4.IP != "" || ipv4.Verdict == nil || ipv4.Verdict.Code != types.ReasonUnreachable {
+		t.Errorf("IPv4结论 = %+v，期望没有地址", ipv4)
+	}
+	if !ipv6.Passed || ipv6.IP != "2001:db8::1" {
+		t.Errorf("IPv6结论 = %+v，期望通过", ipv6)
+	}
+
+	// 经IPv6地址请求的状态码同样按策略评估
+	result = ipv6OnlyResult(http.StatusInternalServerError)
+	p.evaluateSuitability(context.Background(), result)
+	if result.IPv6.Passed || result.IPv6.Verdict == nil || result.IPv6.Verdict.Rule != types.RuleStatusCode {
+		t.Fatalf("IPv6结论 = %+v，期望状态码不可接受", result.IPv6.Verdict)
+	}
+	if result.Suitable {
+		t.Fatal("IPv6地址状态码不可接受时仍判为适合")
+	}
+}
@@ -0,0 +1,305 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// maxStageConcurrency 单个域名内同时执行的阶段数上限
+const maxStageConcurrency = 4
+
+// stagePlan 检测阶段依赖图
+// stages按拓扑顺序排列，deps/dependents/ancestors使用stages中的下标
+type stagePlan struct {
+	stages     []types.DetectionStage
+	deps       [][]int
+	dependents [][]int
+	ancestors  [][]int // 直接和间接依赖，按拓扑顺序排列
+}
+
+// buildStagePlan 根据阶段声明的产出与依赖构建依赖图
+// 某个数据有多个生产者时，消费者依赖全部生产者；没有生产者的数据视为已就绪
+func buildStagePlan(stages []types.DetectionStage) (*stagePlan, error) {
+	names := make(map[string]bool)
+	producers := make(map[types.Artifact][]int)
+	for i, stage := range stages {
+		if names[stage.Name()] {
+			return nil, fmt.Errorf("检测阶段名称重复: %s", stage.Name())
+		}
+		names[stage.Name()] = true
+		for _, artifact := range stage.Produces() {
+			producers[artifact] = append(producers[artifact], i)
+		}
+	}
+
+	// 计算每个阶段依赖的阶段（去重，排除自身）
+	deps := make([][]int, len(stages))
+	for i, stage := range stages {
+		seen := make(map[int]bool)
+		for _, artifact := range stage.Consumes() {
+			for _, producer := range producers[artifact] {
+				if producer == i || seen[producer] {
+					continue
+				}
+				seen[producer] = true
+				deps[i] = append(deps[i], producer)
+			}
+		}
+	}
+
+	// 拓扑排序，同层按优先级和名称稳定排序
+	pending := make([]int, len(stages))
+	dependents := make([][]int, len(stages))
+	for i := range stages {
+		pending[i] = len(deps[i])
+		for _, dep := range deps[i] {
+			dependents[dep] = append(dependents[dep], i)
+		}
+	}
+
+	less := func(a, b int) bool {
+		if stages[a].Priority() != stages[b].Priority() {
+			return stages[a].Priority() < stages[b].Priority()
+		}
+		return stages[a].Name() < stages[b].Name()
+	}
+
+	var ready []int
+	for i := range stages {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	order := make([]int, 0, len(stages))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(a, b int) bool { return less(ready[a], ready[b]) })
+		current := ready[0]
+		ready = ready[1:]
+		order = append(order, current)
+		for _, dependent := range dependents[current] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(order) != len(stages) {
+		var cyclic []string
+		for i, stage := range stages {
+			if pending[i] > 0 {
+				cyclic = append(cyclic, stage.Name())
+			}
+		}
+		sort.Strings(cyclic)
+		return nil, fmt.Errorf("检测阶段存在循环依赖: %s", strings.Join(cyclic, ", "))
+	}
+
+	// 按拓扑顺序重新编号
+	position := make([]int, len(stages))
+	for pos, index := range order {
+		position[index] = pos
+	}
+
+	plan := &stagePlan{
+		stages:     make([]types.DetectionStage, len(stages)),
+		deps:       make([][]int, len(stages)),
+		dependents: make([][]int, len(stages)),
+		ancestors:  make([][]int, len(stages)),
+	}
+	for pos, index := range order {
+		plan.stages[pos] = stages[index]
+		for _, dep := range deps[index] {
+			plan.deps[pos] = append(plan.deps[pos], position[dep])
+		}
+		sort.Ints(plan.deps[pos])
+	}
+	for pos := range plan.stages {
+		seen := make(map[int]bool)
+		for _, dep := range plan.deps[pos] {
+			plan.dependents[dep] = append(plan.dependents[dep], pos)
+			seen[dep] = true
+			for _, ancestor := range plan.ancestors[dep] {
+				seen[ancestor] = true
+			}
+		}
+		for ancestor := range seen {
+			plan.ancestors[pos] = append(plan.ancestors[pos], ancestor)
+		}
+		sort.Ints(plan.ancestors[pos])
+	}
+
+	return plan, nil
+}
+
+// stageCompletion 阶段执行完成通知
+type stageCompletion struct {
+	index      int
+	partial    *types.DetectionResult
+	err        error
+	startTime  time.Time
+	endTime    time.Time
+	operations []types.NetworkOperation
+}
+
+// run 按依赖图调度阶段：依赖全部完成的阶段立即并发执行
+// 每个阶段只读取由其上游部分结果合并出的快照，并返回自己的部分结果；
+// 所有共享状态只在调度协程中修改，最终结果按拓扑顺序合并
+// 可早期退出的阶段出错或请求早期退出后，不再启动新的阶段
+// stageTimeout 大于0时，每个阶段的context带有独立的时限
+func (plan *stagePlan) run(ctx context.Context, pipelineCtx *types.PipelineContext, earlyExit bool, stageTimeout time.Duration) {
+	partials := make([]*types.DetectionResult, len(plan.stages))
+	errs := make([]error, len(plan.stages))
+	completions := make([]*stageCompletion, len(plan.stages))
+
+	pending := make([]int, len(plan.stages))
+	var ready []int
+	for i := range plan.stages {
+		pending[i] = len(plan.deps[i])
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	done := make(chan stageCompletion, len(plan.stages))
+	running := 0
+	halted := false
+
+	for {
+		// 启动所有已就绪的阶段
+		for !halted && len(ready) > 0 && running < maxStageConcurrency && ctx.Err() == nil {
+			index := ready[0]
+			ready = ready[1:]
+			running++
+
+			// 每个阶段使用独立的记录器，网络层通过context记录操作
+			trace := &types.StageTrace{}
+			stageCtx := *pipelineCtx
+			stageCtx.Result = plan.snapshot(pipelineCtx.Result, partials, index)
+			stageCtx.Context = types.WithStageTrace(pipelineCtx.Context, trace)
+			cancel := context.CancelFunc(func() {})
+			if stageTimeout > 0 {
+				stageCtx.Context, cancel = context.WithTimeout(stageCtx.Context, stageTimeout)
+			}
+
+			go func(index int, stage types.DetectionStage, stageCtx *types.PipelineContext) {
+				defer cancel()
+				startTime := time.Now()
+				partial, err := executeStage(stage, stageCtx)
+
+				// 只因本阶段时限中断时标记为阶段超时，整体取消或超时由调用方判断
+				if err != nil && ctx.Err() == nil && stageCtx.Context.Err() == context.DeadlineExceeded {
+					err = fmt.Errorf("%w（%s）: %v", types.ErrStageTimeout, stageTimeout, err)
+				}
+
+				done <- stageCompletion{
+					index:      index,
+					partial:    partial,
+					err:        err,
+					startTime:  startTime,
+					endTime:    time.Now(),
+					operations: trace.Operations(),
+				}
+			}(index, plan.stages[index], &stageCtx)
+		}
+
+		if running == 0 {
+			break
+		}
+
+		completion := <-done
+		running--
+		stage := plan.stages[completion.index]
+		partials[completion.index] = completion.partial
+		errs[completion.index] = completion.err
+		completions[completion.index] = &completion
+
+		// 检查是否需要早期退出
+		requested := completion.partial != nil && completion.partial.EarlyExit
+		if stage.CanEarlyExit() && (completion.err != nil || (earlyExit && requested)) {
+			halted = true
+			continue
+		}
+
+		for _, dependent := range plan.dependents[completion.index] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+		sort.Ints(ready)
+	}
+
+	// 按拓扑顺序合并所有部分结果和错误，并记录各阶段的执行情况
+	result := pipelineCtx.Result
+	for i, stage := range plan.stages {
+		mergeResult(result, partials[i])
+
+		report := types.StageReport{
+			Name:     stage.Name(),
+			Outcome:  types.StageOutcomeSkipped,
+			Observed: describePartial(stage, partials[i]),
+		}
+		if completion := completions[i]; completion != nil {
+			report.Ran = true
+			report.StartTime = completion.startTime
+			report.EndTime = completion.endTime
+			report.Duration = completion.endTime.Sub(completion.startTime)
+			report.Operations = completion.operations
+			for _, operation := range completion.operations {
+				if operation.Attempt > 1 {
+					report.Retries++
+				}
+			}
+			report.Outcome = types.StageOutcomePassed
+			report.EarlyExit = partials[i] != nil && partials[i].EarlyExit
+			if errs[i] != nil || report.EarlyExit {
+				report.Outcome = types.StageOutcomeFailed
+			}
+		}
+		if errs[i] != nil {
+			report.Error = errs[i].Error()
+		}
+		result.Stages = append(result.Stages, report)
+
+		if errs[i] != nil {
+			result.StageErrors = append(result.StageErrors, types.StageError{
+				Stage:   stage.Name(),
+				Message: errs[i].Error(),
+				Err:     errs[i],
+			})
+			if result.Error == nil {
+				result.Error = errs[i]
+			}
+		}
+	}
+	if halted {
+		result.EarlyExit = true
+	}
+}
+
+// snapshot 生成某阶段可见的结果快照：基础结果加上全部上游阶段的部分结果
+func (plan *stagePlan) snapshot(base *types.DetectionResult, partials []*types.DetectionResult, index int) *types.DetectionResult {
+	view := *base
+	for _, ancestor := range plan.ancestors[index] {
+		mergeResult(&view, partials[ancestor])
+	}
+	return &view
+}
+
+// executeStage 执行单个阶段，捕获panic
+func executeStage(stage types.DetectionStage, pipelineCtx *types.PipelineContext) (partial *types.DetectionResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			partial = nil
+			err = fmt.Errorf("检测阶段 %s panic: %v", stage.Name(), r)
+		}
+	}()
+	return stage.Execute(pipelineCtx)
+}
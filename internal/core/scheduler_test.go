@@ -0,0 +1,368 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// fakeStage 测试用检测阶段，execute 为nil时返回空的部分结果
+type fakeStage struct {
+	name      string
+	priority  int
+	earlyExit bool
+	produces  []types.Artifact
+	consumes  []types.Artifact
+	execute   func(ctx *types.PipelineContext) (*types.DetectionResult, error)
+}
+
+func (s *fakeStage) Execute(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+	if s.execute == nil {
+		return &types.DetectionResult{}, nil
+	}
+	return s.execute(ctx)
+}
+
+func (s *fakeStage) CanEarlyExit() bool         { return s.earlyExit }
+func (s *fakeStage) Priority() int              { return s.priority }
+func (s *fakeStage) Name() string               { return s.name }
+func (s *fakeStage) Produces() []types.Artifact { return s.produces }
+func (s *fakeStage) Consumes() []types.Artifact { return s.consumes }
+
+// newPipelineContext 创建测试用的流水线上下文
+func newPipelineContext(domain string) *types.PipelineContext {
+	return &types.PipelineContext{
+		Domain:  domain,
+		Result:  types.NewTargetResult(domain),
+		Context: context.Background(),
+	}
+}
+
+// rendezvous 等待 n 个阶段同时到达，超时说明阶段没有并发执行
+type rendezvous struct {
+	mu      sync.Mutex
+	arrived int
+	all     chan struct{}
+	n       int
+}
+
+func newRendezvous(n int) *rendezvous {
+	return &rendezvous{all: make(chan struct{}), n: n}
+}
+
+func (r *rendezvous) wait(timeout time.Duration) error {
+	r.mu.Lock()
+	r.arrived++
+	if r.arrived == r.n {
+		close(r.all)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.all:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("等待其他阶段超时")
+	}
+}
+
+func stageNames(stages []types.DetectionStage) []string {
+	names := make([]string, len(stages))
+	for i, stage := range stages {
+		names[i] = stage.Name()
+	}
+	return names
+}
+
+func TestRunExecutesIndependentStagesConcurrently(t *testing.T) {
+	meet := newRendezvous(3)
+
+	redirect := &fakeStage{
+		name:     "redirect",
+		priority: 2,
+		produces: []types.Artifact{types.ArtifactFinalDomain, types.ArtifactHTTPStatus},
+		execute: func(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+			if err := meet.wait(2 * time.Second); err != nil {
+				return nil, err
+			}
+			return &types.DetectionResult{Network: &types.NetworkResult{Accessible: true, StatusCode: 200, FinalDomain: "www.example.com"}}, nil
+		},
+	}
+	cdn := &fakeStage{
+		name:     "cdn",
+		priority: 8,
+		produces: []types.Artifact{types.ArtifactCDN},
+		consumes: []types.Artifact{types.ArtifactFinalDomain},
+		execute: func(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+			// 快照中应包含上游 redirect 的结果
+			if ctx.Result.Network == nil || ctx.Result.Network.FinalDomain != "www.example.com" {
+				return nil, errors.New("快照缺少上游结果")
+			}
+			return &types.DetectionResult{CDN: &types.CDNResult{IsCDN: true, CDNProvider: "Cloudflare"}}, nil
+		},
+	}
+	tlsStage := &fakeStage{
+		name:     "comprehensive_tls",
+		priority: 4,
+		produces: []types.Artifact{types.ArtifactTLS, types.ArtifactCertificate},
+		execute: func(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+			if err := meet.wait(2 * time.Second); err != nil {
+				return nil, err
+			}
+			return &types.DetectionResult{
+				TLS:         &types.TLSResult{SupportsTLS13: true},
+				Certificate: &types.CertificateResult{Valid: true},
+			}, nil
+		},
+	}
+	hot := &fakeStage{
+		name:     "hot_website",
+		priority: 9,
+		produces: []types.Artifact{types.ArtifactHotWebsite},
+		execute: func(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+			if err := meet.wait(2 * time.Second); err != nil {
+				return nil, err
+			}
+			return &types.DetectionResult{CDN: &types.CDNResult{IsHotWebsite: true}}, nil
+		},
+	}
+
+	plan, err := buildStagePlan([]types.DetectionStage{hot, cdn, tlsStage, redirect})
+	if err != nil {
+		t.Fatalf("buildStagePlan: %v", err)
+	}
+
+	pipelineCtx := newPipelineContext("example.com")
+	plan.run(context.Background(), pipelineCtx, true, time.Second)
+	result := pipelineCtx.Result
+
+	if len(result.StageErrors) > 0 {
+		t.Fatalf("阶段出错: %+v", result.StageErrors)
+	}
+	if result.Network == nil || result.TLS == nil || result.Certificate == nil {
+		t.Fatalf("结果未合并: %+v", result)
+	}
+	if result.CDN == nil || !result.CDN.IsCDN || result.CDN.CDNProvider != "Cloudflare" || !result.CDN.IsHotWebsite {
+		t.Fatalf("CDN结果合并错误: %+v", result.CDN)
+	}
+	if len(result.Stages) != 4 {
+		t.Fatalf("阶段记录数 = %d，期望 4", len(result.Stages))
+	}
+	for _, report := range result.Stages {
+		if !report.Ran || report.Outcome != types.StageOutcomePassed {
+			t.Errorf("阶段 %s: Ran=%v Outcome=%s", report.Name, report.Ran, report.Outcome)
+		}
+	}
+}
+
+func TestBuildStagePlanOrdersByDependencies(t *testing.T) {
+	stages := []types.DetectionStage{
+		&fakeStage{name: "hot_website", priority: 9, produces: []types.Artifact{types.ArtifactHotWebsite}, consumes: []types.Artifact{types.ArtifactCDN}},
+		&fakeStage{name: "cdn", priority: 8, produces: []types.Artifact{types.ArtifactCDN}, consumes: []types.Artifact{types.ArtifactFinalDomain}},
+		&fakeStage{name: "redirect", priority: 2, produces: []types.Artifact{types.ArtifactFinalDomain}},
+		&fakeStage{name: "comprehensive_tls", priority: 4, produces: []types.Artifact{types.ArtifactTLS}},
+	}
+
+	plan, err := buildStagePlan(stages)
+	if err != nil {
+		t.Fatalf("buildStagePlan: %v", err)
+	}
+	got := strings.Join(stageNames(plan.stages), ",")
+	want := "redirect,comprehensive_tls,cdn,hot_website"
+	if got != want {
+		t.Fatalf("拓扑顺序 = %s，期望 %s", got, want)
+	}
+
+	// hot_website 直接依赖 cdn，间接依赖 redirect
+	if len(plan.deps[3]) != 1 || plan.stages[plan.deps[3][0]].Name() != "cdn" {
+		t.Errorf("hot_website 的依赖 = %v", plan.deps[3])
+	}
+	if len(plan.ancestors[3]) != 2 {
+		t.Errorf("hot_website 的上游 = %v，期望 redirect 和 cdn", plan.ancestors[3])
+	}
+}
+
+func TestBuildStagePlanDetectsCycle(t *testing.T) {
+	stages := []types.DetectionStage{
+		&fakeStage{name: "a", produces: []types.Artifact{types.ArtifactTLS}, consumes: []types.Artifact{types.ArtifactCDN}},
+		&fakeStage{name: "b", produces: []types.Artifact{types.ArtifactCDN}, consumes: []types.Artifact{types.ArtifactTLS}},
+		&fakeStage{name: "c", produces: []types.Artifact{types.ArtifactBlocked}},
+	}
+
+	_, err := buildStagePlan(stages)
+	if err == nil {
+		t.Fatal("循环依赖未报错")
+	}
+	if !strings.Contains(err.Error(), "a, b") || strings.Contains(err.Error(), "c") {
+		t.Fatalf("错误信息 = %q，期望只列出 a 和 b", err)
+	}
+}
+
+func TestBuildStagePlanRejectsDuplicateNames(t *testing.T) {
+	stages := []types.DetectionStage{
+		&fakeStage{name: "redirect"},
+		&fakeStage{name: "redirect"},
+	}
+	if _, err := buildStagePlan(stages); err == nil {
+		t.Fatal("阶段名称重复未报错")
+	}
+}
+
+func TestBuildStagePlanMissingProducer(t *testing.T) {
+	// 没有阶段产出 resolved_ip，消费者视为没有依赖，立即执行
+	consumer := &fakeStage{
+		name:     "comprehensive_tls",
+		produces: []types.Artifact{types.ArtifactTLS},
+		consumes: []types.Artifact{types.ArtifactResolvedIP},
+		execute: func(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+			return &types.DetectionResult{TLS: &types.TLSResult{}}, nil
+		},
+	}
+	plan, err := buildStagePlan([]types.DetectionStage{consumer})
+	if err != nil {
+		t.Fatalf("buildStagePlan: %v", err)
+	}
+	if len(plan.deps[0]) != 0 {
+		t.Fatalf("依赖 = %v，期望为空", plan.deps[0])
+	}
+
+	pipelineCtx := newPipelineContext("example.com")
+	plan.run(context.Background(), pipelineCtx, true, 0)
+	if pipelineCtx.Result.TLS == nil || !pipelineCtx.Result.Stages[0].Ran {
+		t.Fatal("缺少生产者的阶段未执行")
+	}
+}
+
+func TestRunMergesInTopologicalOrder(t *testing.T) {
+	// redirect 拓扑顺序在前但后完成，其CDN结论仍然优先
+	redirect := &fakeStage{
+		name:     "redirect",
+		priority: 2,
+		produces: []types.Artifact{types.ArtifactCDN},
+		execute: func(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+			time.Sleep(50 * time.Millisecond)
+			return &types.DetectionResult{
+				CDN:      &types.CDNResult{IsCDN: true, CDNProvider: "Cloudflare", Confidence: "高"},
+				Location: &types.LocationResult{Country: "美国"},
+			}, nil
+		},
+	}
+	tlsStage := &fakeStage{
+		name:     "comprehensive_tls",
+		priority: 4,
+		produces: []types.Artifact{types.ArtifactCDN},
+		execute: func(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+			return &types.DetectionResult{
+				CDN:      &types.CDNResult{IsCDN: true, CDNProvider: "Akamai", Confidence: "中", IsHotWebsite: true},
+				Location: &types.LocationResult{CountryCode: "US", IsDomestic: false},
+			}, nil
+		},
+	}
+
+	for i := 0; i < 5; i++ {
+		plan, err := buildStagePlan([]types.DetectionStage{tlsStage, redirect})
+		if err != nil {
+			t.Fatalf("buildStagePlan: %v", err)
+		}
+		pipelineCtx := newPipelineContext("example.com")
+		plan.run(context.Background(), pipelineCtx, true, 0)
+		result := pipelineCtx.Result
+
+		if result.CDN == nil || result.CDN.CDNProvider != "Cloudflare" || result.CDN.Confidence != "高" || !result.CDN.IsHotWebsite {
+			t.Fatalf("CDN合并结果 = %+v，期望 Cloudflare 且带热门网站标记", result.CDN)
+		}
+		if result.Location == nil || result.Location.Country != "美国" || result.Location.CountryCode != "US" {
+			t.Fatalf("地理位置合并结果 = %+v", result.Location)
+		}
+		if names := result.Stages[0].Name + "," + result.Stages[1].Name; names != "redirect,comprehensive_tls" {
+			t.Fatalf("阶段记录顺序 = %s", names)
+		}
+	}
+}
+
+func TestMergeResultKeepsSnapshotsIntact(t *testing.T) {
+	base := &types.DetectionResult{
+		Location: &types.LocationResult{Country: "美国"},
+		CDN:      &types.CDNResult{IsCDN: true, CDNProvider: "Cloudflare"},
+	}
+	snapshot := *base
+
+	mergeResult(base, &types.DetectionResult{
+		Location: &types.LocationResult{City: "Los Angeles"},
+		CDN:      &types.CDNResult{IsCDN: true, CDNProvider: "Akamai", IsHotWebsite: true},
+	})
+
+	if snapshot.Location.City != "" || snapshot.CDN.IsHotWebsite {
+		t.Fatal("合并修改了已有的子结果")
+	}
+	if base.Location.Country != "美国" || base.Location.City != "Los Angeles" {
+		t.Errorf("地理位置 = %+v", base.Location)
+	}
+	if base.CDN.CDNProvider != "Cloudflare" || !base.CDN.IsHotWebsite {
+		t.Errorf("CDN = %+v", base.CDN)
+	}
+
+	mergeResult(base, nil)
+	if base.CDN.CDNProvider != "Cloudflare" {
+		t.Error("合并空的部分结果修改了结果")
+	}
+}
+
+func TestRunHaltsAfterEarlyExitStageFails(t *testing.T) {
+	blocked := &fakeStage{
+		name:      "blocked",
+		priority:  1,
+		earlyExit: true,
+		produces:  []types.Artifact{types.ArtifactBlocked},
+		execute: func(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+			return nil, errors.New("检测失败")
+		},
+	}
+	redirect := &fakeStage{
+		name:     "redirect",
+		priority: 2,
+		produces: []types.Artifact{types.ArtifactFinalDomain},
+		consumes: []types.Artifact{types.ArtifactBlocked},
+	}
+
+	plan, err := buildStagePlan([]types.DetectionStage{redirect, blocked})
+	if err != nil {
+		t.Fatalf("buildStagePlan: %v", err)
+	}
+	pipelineCtx := newPipelineContext("example.com")
+	plan.run(context.Background(), pipelineCtx, true, 0)
+	result := pipelineCtx.Result
+
+	if !result.EarlyExit || result.Error == nil {
+		t.Fatalf("EarlyExit=%v Error=%v", result.EarlyExit, result.Error)
+	}
+	if result.Stages[1].Ran || result.Stages[1].Outcome != types.StageOutcomeSkipped {
+		t.Fatalf("下游阶段 = %+v，期望跳过", result.Stages[1])
+	}
+}
+
+func TestRunMarksStageTimeout(t *testing.T) {
+	slow := &fakeStage{
+		name:     "comprehensive_tls",
+		produces: []types.Artifact{types.ArtifactTLS},
+		execute: func(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+			<-ctx.Context.Done()
+			return nil, ctx.Context.Err()
+		},
+	}
+	plan, err := buildStagePlan([]types.DetectionStage{slow})
+	if err != nil {
+		t.Fatalf("buildStagePlan: %v", err)
+	}
+	pipelineCtx := newPipelineContext("example.com")
+	plan.run(context.Background(), pipelineCtx, true, 20*time.Millisecond)
+
+	if !pipelineCtx.Result.TimedOut() {
+		t.Fatalf("阶段超时未标记: %+v", pipelineCtx.Result.StageErrors)
+	}
+}
@@ -0,0 +1,142 @@
+package detectors
+
+import (
+	"fmt"
+	"sync"
+
+	"RealityChecker/internal/network"
+	"RealityChecker/internal/types"
+)
+
+// maxAddressProbes 多地址检测同时进行的握手数
+const maxAddressProbes = 4
+
+// AddressStage 多地址检测阶段
+// 对域名的每个A/AAAA记录分别进行TLS和证书检测，SNI均为域名；
+// DNS轮询返回的地址可能位于不同国家或ASN，TLS表现也可能不同
+type AddressStage struct {
+	location *LocationStage
+	tls      *ComprehensiveTLSStage
+}
+
+// NewAddressStage 创建多地址检测阶段，复用地理位置和综合TLS阶段的检测实现
+func NewAddressStage(location *LocationStage, tls *ComprehensiveTLSStage) *AddressStage {
+	return &AddressStage{
+		location: location,
+		tls:      tls,
+	}
+}
+
+// Execute 执行多地址检测
+func (as *AddressStage) Execute(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+	domain := ctx.FinalDomain()
+	entry, err := network.PipelineRecords(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("IP解析失败: %v", err)
+	}
+
+	// 只检测一个地址族时不检测另一地址族的地址
+	var ips []string
+	if ctx.IPVersion() != types.IPVersion6 {
+		ips = append(ips, entry.A...)
+	}
+	if ctx.IPVersion() != types.IPVersion4 {
+		ips = append(ips, entry.AAAA...)
+	}
+	addresses := make([]types.AddressResult, len(ips))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxAddressProbes)
+	for i, ip := range ips {
+		// 选定的地址已由综合TLS阶段检测，直接使用其结果
+		if ip == ctx.ResolvedIP() && ctx.Result.TLS != nil {
+			addresses[i] = types.AddressResult{
+				IP:          ip,
+				Primary:     true,
+				Location:    ctx.Result.Location,
+				TLS:         ctx.Result.TLS,
+				Certificate: ctx.Result.Certificate,
+				SNI:         ctx.Result.SNI,
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, ip string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			addresses[i] = probeAddress(ctx, as.location, as.tls, domain, ip)
+		}(i, ip)
+	}
+	wg.Wait()
+
+	// 被取消或超时的握手不能作为地址的结论
+	if err := ctx.Context.Err(); err != nil {
+		return nil, fmt.Errorf("多地址检测中断: %v", err)
+	}
+
+	return &types.DetectionResult{Addresses: addresses}, nil
+}
+
+// probeAddress 检测单个地址：地理位置、TLS握手和证书，SNI为域名
+func probeAddress(ctx *types.PipelineContext, location *LocationStage, tls *ComprehensiveTLSStage, domain, ip string) types.AddressResult {
+	policy := ctx.Config.PolicyFor(ctx.Domain)
+	country, countryCode := location.getLocation(ip)
+	asn, isp := location.getASN(ip)
+
+	address := types.AddressResult{
+		IP: ip,
+		Location: &types.LocationResult{
+			Country:     country,
+			CountryCode: countryCode,
+			IsDomestic:  policy.IsDomesticCountry(countryCode, country),
+			IPAddress:   ip,
+			IPVersion:   network.IPVersion(ip),
+			ASN:         asn,
+			ISP:         isp,
+		},
+	}
+
+	result := tls.performComprehensiveTLSDetection(ctx, domain, ip)
+	if result.Err != nil {
+		address.Error = result.Err.Error()
+		return address
+	}
+	address.TLS = result.TLS
+	address.Certificate = result.Certificate
+	address.SNI = result.SNI
+	return address
+}
+
+// CanEarlyExit 是否可以早期退出
+func (as *AddressStage) CanEarlyExit() bool {
+	return false // 多地址检测只补充结论，不终止流水线
+}
+
+// Priority 优先级
+func (as *AddressStage) Priority() int {
+	return 5 // 在综合TLS检测之后
+}
+
+// Name 阶段名称
+func (as *AddressStage) Name() string {
+	return "addresses"
+}
+
+// Produces 产出的数据
+func (as *AddressStage) Produces() []types.Artifact {
+	return []types.Artifact{types.ArtifactAddresses}
+}
+
+// Consumes 依赖的数据
+// 选定地址的结果直接取自地理位置和综合TLS阶段
+func (as *AddressStage) Consumes() []types.Artifact {
+	return []types.Artifact{
+		types.ArtifactFinalDomain,
+		types.ArtifactResolvedIP,
+		types.ArtifactLocation,
+		types.ArtifactTLS,
+		types.ArtifactCertificate,
+	}
+}
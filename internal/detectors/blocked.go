@@ -24,21 +24,24 @@ func NewBlockedStage() *BlockedStage {
 }
 
 // Execute 执行被墙检测
-func (bs *BlockedStage) Execute(ctx *types.PipelineContext) error {
+func (bs *BlockedStage) Execute(ctx *types.PipelineContext) (*types.DetectionResult, error) {
 	// 检查是否被墙
 	isBlocked, reason := bs.checkBlocked(ctx.Domain)
 
-	ctx.Result.Blocked = &types.BlockedResult{
-		IsBlocked:      isBlocked,
-		BlockedReasons: []string{reason},
-		MatchType:      "gfwlist",
+	partial := &types.DetectionResult{
+		Blocked: &types.BlockedResult{
+			IsBlocked:      isBlocked,
+			BlockedReasons: []string{reason},
+			MatchType:      "gfwlist",
+		},
 	}
 
-	if isBlocked {
-		ctx.EarlyExit = true
-		return fmt.Errorf("域名被墙（%s）", reason)
+	// 被墙是检测结论而非错误，只请求早期退出，由流水线给出结论
+	// 策略不要求未被墙时继续检测
+	if isBlocked && ctx.Config.PolicyFor(ctx.Domain).Requires(types.RuleNotBlocked) {
+		partial.EarlyExit = true
 	}
-	return nil
+	return partial, nil
 }
 
 // checkBlocked 检查是否被墙
@@ -112,3 +115,13 @@ func (bs *BlockedStage) Priority() int {
 func (bs *BlockedStage) Name() string {
 	return "blocked"
 }
+
+// Produces 产出的数据
+func (bs *BlockedStage) Produces() []types.Artifact {
+	return []types.Artifact{types.ArtifactBlocked}
+}
+
+// Consumes 依赖的数据
+func (bs *BlockedStage) Consumes() []types.Artifact {
+	return nil
+}
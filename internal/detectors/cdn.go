@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"RealityChecker/internal/network"
 	"RealityChecker/internal/types"
 )
 
@@ -45,9 +46,9 @@ func NewCDNStage() *CDNStage {
 
 // Execute 执行CDN检测 (已废弃 - CDN检测已合并到ComprehensiveTLSStage)
 // 保留此方法以维持接口兼容性，但不再使用
-func (cs *CDNStage) Execute(ctx *types.PipelineContext) error {
+func (cs *CDNStage) Execute(ctx *types.PipelineContext) (*types.DetectionResult, error) {
 	// 此方法已废弃，CDN检测已合并到ComprehensiveTLSStage中
-	return nil
+	return nil, nil
 }
 
 // detectCDN 检测CDN
@@ -55,24 +56,25 @@ func (cs *CDNStage) Execute(ctx *types.PipelineContext) error {
 // 高置信度方法：CNAME记录、HTTP响应头、ASN查询等
 // 中等置信度方法：NS记录、通用HTTP头等
 // 低置信度方法：证书签发者等
-func (cs *CDNStage) detectCDN(domain string, networkResult *types.NetworkResult) (bool, string, string, string) {
+// DNS相关的检测使用流水线共享的记录集，records 为 nil 时跳过
+func (cs *CDNStage) detectCDN(ctx context.Context, dialer *network.Dialer, records *types.DNSEntry, domain, port string, networkResult *types.NetworkResult) (bool, string, string, string) {
 	// 高置信度检测方法（优先级顺序）
 	highConfidenceChecks := []func() (string, string){
-		func() (string, string) { return cs.checkCNAMEStrongSuffix(domain) },
+		func() (string, string) { return cs.checkCNAMEStrongSuffix(records) },
 		func() (string, string) { return cs.checkHTTPStrongHeader(networkResult) },
 		func() (string, string) { return cs.checkHTTPValueCdnDomains(networkResult) },
-		func() (string, string) { return cs.checkASNStrongExact(domain) },
+		func() (string, string) { return cs.checkASNStrongExact(records) },
 	}
 
 	// 中等置信度检测方法
 	mediumConfidenceChecks := []func() (string, string){
-		func() (string, string) { return cs.checkNSHintSuffix(domain) },
+		func() (string, string) { return cs.checkNSHintSuffix(records) },
 		func() (string, string) { return cs.checkHTTPMediumHeader(networkResult) },
 	}
 
 	// 低置信度检测方法
 	lowConfidenceChecks := []func() (string, string){
-		func() (string, string) { return cs.checkCertIssuerHint(domain) },
+		func() (string, string) { return cs.checkCertIssuerHint(ctx, dialer, domain, recordIP(records), port) },
 	}
 
 	// 按置信度顺序检测
@@ -97,27 +99,34 @@ func (cs *CDNStage) detectCDN(domain string, networkResult *types.NetworkResult)
 	return false, "", "", ""
 }
 
-// checkCNAMEStrongSuffix 检查CNAME强后缀特征
-func (cs *CDNStage) checkCNAMEStrongSuffix(domain string) (string, string) {
-	// 使用Go原生DNS解析器查询CNAME记录
-	cname, err := net.LookupCNAME(domain)
-	if err != nil {
-		return "", ""
+// recordIP 记录集选定的地址，没有记录集时返回空
+func recordIP(records *types.DNSEntry) string {
+	if records == nil {
+		return ""
 	}
+	return records.IP
+}
 
-	cnameLower := strings.ToLower(cname)
+// checkCNAMEStrongSuffix 检查CNAME强后缀特征，CNAME链中的每一跳都参与匹配
+func (cs *CDNStage) checkCNAMEStrongSuffix(records *types.DNSEntry) (string, string) {
+	if records == nil || len(records.CNAMEChain) < 2 {
+		return "", ""
+	}
 
-	// 检查CNAME记录是否包含CDN后缀
-	cnameClean := strings.TrimSuffix(cnameLower, ".")
+	// 链的第一项是查询的域名本身
+	for _, cname := range records.CNAMEChain[1:] {
+		// 检查CNAME记录是否包含CDN后缀
+		cnameClean := strings.TrimSuffix(strings.ToLower(cname), ".")
 
-	for suffix := range cs.cnameStrongSuffix {
-		// 移除注释部分
-		cleanSuffix := strings.Split(suffix, "#")[0]
-		cleanSuffix = strings.TrimSpace(cleanSuffix)
-		suffixLower := strings.ToLower(cleanSuffix)
-		if strings.Contains(cnameClean, suffixLower) {
-			provider := cs.getProviderFromSuffix(suffix)
-			return provider, fmt.Sprintf("CNAME记录特征: CNAME记录包含%s", cleanSuffix)
+		for suffix := range cs.cnameStrongSuffix {
+			// 移除注释部分
+			cleanSuffix := strings.Split(suffix, "#")[0]
+			cleanSuffix = strings.TrimSpace(cleanSuffix)
+			suffixLower := strings.ToLower(cleanSuffix)
+			if strings.Contains(cnameClean, suffixLower) {
+				provider := cs.getProviderFromSuffix(suffix)
+				return provider, fmt.Sprintf("CNAME记录特征: CNAME记录%s包含%s", cnameClean, cleanSuffix)
+			}
 		}
 	}
 
@@ -156,30 +165,16 @@ func (cs *CDNStage) checkHTTPStrongHeader(networkResult *types.NetworkResult) (s
 }
 
 // checkASNStrongExact 检查ASN强特征
-func (cs *CDNStage) checkASNStrongExact(domain string) (string, string) {
+func (cs *CDNStage) checkASNStrongExact(records *types.DNSEntry) (string, string) {
 	// TODO: 需要ASN查询功能
 	// 实际实现需要集成ASN查询库或API来查询真实的ASN信息
 	// 当前使用关键字库中的ASN列表，但需要真实的ASN查询功能
 
-	// 解析IP地址
-	ips, err := net.LookupIP(domain)
-	if err != nil || len(ips) == 0 {
+	// 使用记录集选定的地址进行ASN查询
+	if records == nil || records.IP == "" {
 		return "", ""
 	}
-
-	// 获取第一个IPv4地址
-	var ip net.IP
-	for _, i := range ips {
-		if i.To4() != nil {
-			ip = i
-			break
-		}
-	}
-	// 选择第一个IP进行ASN查询
-	_ = ips[0] // 暂时不使用，未来需要集成ASN查询库
-	if ip != nil {
-		_ = ip // 暂时不使用，未来需要集成ASN查询库
-	}
+	_ = records.IP // 暂时不使用，未来需要集成ASN查询库
 
 	// 这里需要真实的ASN查询，暂时返回空
 	// 未来需要集成ASN查询库，然后与cs.asnStrongExact中的关键字比较
@@ -213,19 +208,17 @@ func (cs *CDNStage) checkHTTPValueCdnDomains(networkResult *types.NetworkResult)
 }
 
 // checkNSHintSuffix 检查NS提示
-func (cs *CDNStage) checkNSHintSuffix(domain string) (string, string) {
-	// 查询NS记录
-	nsRecords, err := net.LookupNS(domain)
-	if err != nil {
+func (cs *CDNStage) checkNSHintSuffix(records *types.DNSEntry) (string, string) {
+	if records == nil {
 		return "", ""
 	}
 
-	for _, ns := range nsRecords {
-		nsHost := strings.ToLower(ns.Host)
+	for _, ns := range records.NS {
+		nsHost := strings.ToLower(ns)
 		for hint := range cs.nsHintSuffix {
 			if strings.Contains(nsHost, strings.ToLower(hint)) {
 				provider := cs.getProviderFromNShint(hint)
-				return provider, fmt.Sprintf("NS记录: %s", ns.Host)
+				return provider, fmt.Sprintf("NS记录: %s", ns)
 			}
 		}
 	}
@@ -233,23 +226,30 @@ func (cs *CDNStage) checkNSHintSuffix(domain string) (string, string) {
 	return "", ""
 }
 
-// checkCertIssuerHint 检查证书签发者提示
-func (cs *CDNStage) checkCertIssuerHint(domain string) (string, string) {
+// checkCertIssuerHint 检查证书签发者提示，ip 为空时按域名连接
+func (cs *CDNStage) checkCertIssuerHint(ctx context.Context, dialer *network.Dialer, domain, ip, port string) (string, string) {
 	const (
-		certPort    = ":443"
 		certTimeout = 6 * time.Second // 进一步增加CDN证书检测超时时间，减少误判
 	)
 
+	address := net.JoinHostPort(domain, port)
+	if ip != "" {
+		address = net.JoinHostPort(ip, port)
+	}
+
 	// 建立TLS连接获取证书
-	conn, err := tls.DialWithDialer(&net.Dialer{
-		Timeout: certTimeout,
-	}, "tcp", domain+certPort, &tls.Config{
-		ServerName: domain,
-	})
+	rawConn, err := dialer.WithTimeout(certTimeout).DialContext(ctx, "tcp", address)
 	if err != nil {
 		return "", ""
 	}
-	defer conn.Close()
+	defer rawConn.Close()
+
+	conn := tls.Client(rawConn, &tls.Config{ServerName: domain})
+	handshakeCtx, cancel := context.WithTimeout(ctx, certTimeout)
+	defer cancel()
+	if err := conn.HandshakeContext(handshakeCtx); err != nil {
+		return "", ""
+	}
 
 	// 获取证书
 	cert := conn.ConnectionState().PeerCertificates[0]
@@ -389,26 +389,45 @@ func (cs *CDNStage) Name() string {
 	return "cdn"
 }
 
+// Produces 产出的数据
+func (cs *CDNStage) Produces() []types.Artifact {
+	return []types.Artifact{types.ArtifactCDN}
+}
+
+// Consumes 依赖的数据
+func (cs *CDNStage) Consumes() []types.Artifact {
+	return []types.Artifact{types.ArtifactFinalDomain, types.ArtifactHeaders}
+}
+
 // detectCDNWithManager 使用连接管理器检测CDN
 func (cs *CDNStage) detectCDNWithManager(ctx *types.PipelineContext, domain string, networkResult *types.NetworkResult) (bool, string, string, string) {
+	dialer := network.NewDialer(ctx.Config)
+	port := ctx.FinalPort()
+
+	// 记录集查询失败时DNS相关的检测自动跳过
+	records, err := network.PipelineRecords(ctx, domain)
+	if err != nil {
+		records = nil
+	}
+
 	// 如果连接管理器不可用，回退到直接连接
 	if ctx.Connections == nil {
-		return cs.detectCDN(domain, networkResult)
+		return cs.detectCDN(ctx.Context, dialer, records, domain, port, networkResult)
 	}
 
 	// 使用连接管理器获取TLS连接
 	connMgr, ok := ctx.Connections.(interface {
-		GetTLSConnection(context.Context, string) (*tls.Conn, error)
+		GetTLSConnection(context.Context, string, string, string) (*tls.Conn, error)
 		ReturnConnection(string, net.Conn)
 	})
 	if !ok {
-		return cs.detectCDN(domain, networkResult)
+		return cs.detectCDN(ctx.Context, dialer, records, domain, port, networkResult)
 	}
 
-	tlsConn, err := connMgr.GetTLSConnection(ctx.Context, domain)
+	tlsConn, err := connMgr.GetTLSConnection(ctx.Context, domain, recordIP(records), port)
 	if err != nil {
 		// 如果连接失败，回退到原有逻辑
-		return cs.detectCDN(domain, networkResult)
+		return cs.detectCDN(ctx.Context, dialer, records, domain, port, networkResult)
 	}
 	defer connMgr.ReturnConnection(domain, tlsConn)
 
@@ -429,5 +448,5 @@ func (cs *CDNStage) detectCDNWithManager(ctx *types.PipelineContext, domain stri
 	}
 
 	// 使用增强的网络结果进行CDN检测
-	return cs.detectCDN(domain, enhancedNetworkResult)
+	return cs.detectCDN(ctx.Context, dialer, records, domain, port, enhancedNetworkResult)
 }
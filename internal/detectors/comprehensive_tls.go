@@ -8,6 +8,7 @@ import (
 	"strings"
 	"time"
 
+	"RealityChecker/internal/network"
 	"RealityChecker/internal/types"
 )
 
@@ -21,28 +22,36 @@ func NewComprehensiveTLSStage() *ComprehensiveTLSStage {
 }
 
 // Execute 执行综合TLS检测
-func (cts *ComprehensiveTLSStage) Execute(ctx *types.PipelineContext) error {
+func (cts *ComprehensiveTLSStage) Execute(ctx *types.PipelineContext) (*types.DetectionResult, error) {
 	// 使用最终域名进行TLS检测
-	finalDomain := ctx.Domain
-	if ctx.Result.Network != nil && ctx.Result.Network.FinalDomain != "" {
-		finalDomain = ctx.Result.Network.FinalDomain
+	finalDomain := ctx.FinalDomain()
+
+	// 执行综合TLS检测，连接地理位置检测所用的同一地址，SNI仍为域名
+	tlsResult := cts.performComprehensiveTLSDetection(ctx, finalDomain, ctx.ResolvedIP())
+
+	// 被取消或超时的握手不能作为协议支持情况的结论
+	if err := ctx.Context.Err(); err != nil {
+		return nil, fmt.Errorf("TLS检测中断: %v", err)
 	}
 
-	// 执行综合TLS检测
-	tlsResult := cts.performComprehensiveTLSDetection(ctx, finalDomain)
+	// 握手成功后多次采样测量延迟，采样被中断时保留已完成的样本
+	if tlsResult.Err == nil && tlsResult.TLS != nil {
+		tlsResult.TLS.Latency = cts.measureLatency(ctx, finalDomain, ctx.ResolvedIP(), ctx.FinalPort())
+	}
 
 	// 设置所有TLS相关结果
-	ctx.Result.TLS = tlsResult.TLS
-	ctx.Result.SNI = tlsResult.SNI
-	ctx.Result.Certificate = tlsResult.Certificate
+	partial := &types.DetectionResult{
+		TLS:         tlsResult.TLS,
+		SNI:         tlsResult.SNI,
+		Certificate: tlsResult.Certificate,
+	}
 
-	// 在TLS检测完成后，检查是否需要CDN检测
+	// 在TLS检测完成后，检查是否需要CDN检测（上游HTTP检测未发现CDN时）
 	if ctx.Result.CDN == nil {
-		cdnResult := cts.performCDNDetection(ctx, finalDomain)
-		ctx.Result.CDN = cdnResult
+		partial.CDN = cts.performCDNDetection(tlsResult.Certificate)
 	}
 
-	return nil
+	return partial, nil
 }
 
 // ComprehensiveTLSResult 综合TLS检测结果
@@ -50,14 +59,17 @@ type ComprehensiveTLSResult struct {
 	TLS         *types.TLSResult
 	SNI         *types.SNIResult
 	Certificate *types.CertificateResult
+	Err         error // 连接或握手失败的原因
 }
 
-// performComprehensiveTLSDetection 执行综合TLS检测
-func (cts *ComprehensiveTLSStage) performComprehensiveTLSDetection(ctx *types.PipelineContext, domain string) *ComprehensiveTLSResult {
+// performComprehensiveTLSDetection 执行综合TLS检测，连接最终目标的端口，ip 为空时按域名连接
+func (cts *ComprehensiveTLSStage) performComprehensiveTLSDetection(ctx *types.PipelineContext, domain, ip string) *ComprehensiveTLSResult {
+	port := ctx.FinalPort()
+
 	// 获取连接管理器
 	connMgr, ok := ctx.Connections.(interface {
-		GetTLSConnection(context.Context, string) (*tls.Conn, error)
-		GetX25519TLSConnection(context.Context, string) (*tls.Conn, error)
+		GetTLSConnection(context.Context, string, string, string) (*tls.Conn, error)
+		GetX25519TLSConnection(context.Context, string, string, string) (*tls.Conn, error)
 		CloseTLSConnection(*tls.Conn)
 	})
 	if !ok {
@@ -67,10 +79,10 @@ func (cts *ComprehensiveTLSStage) performComprehensiveTLSDetection(ctx *types.Pi
 
 	// 第一次握手：正常TLS握手，检测TLS1.3、HTTP/2、SNI、证书
 	startTime := time.Now()
-	normalConn, err := connMgr.GetTLSConnection(ctx.Context, domain)
+	normalConn, err := connMgr.GetTLSConnection(ctx.Context, domain, ip, port)
 	if err != nil {
 		// 连接失败时，normalConn可能为nil，不需要关闭
-		return cts.createFailedResult(startTime)
+		return cts.createFailedResult(startTime, err)
 	}
 
 	// 获取第一次握手的结果
@@ -80,6 +92,12 @@ func (cts *ComprehensiveTLSStage) performComprehensiveTLSDetection(ctx *types.Pi
 	// 分析第一次握手结果
 	firstResult := cts.analyzeTLSState(normalState, domain, handshakeTime)
 
+	// 记录实际使用的本地地址，多地址的机器上不同源地址的延迟和可达性可能不同
+	if host, _, err := net.SplitHostPort(normalConn.LocalAddr().String()); err == nil && firstResult.TLS != nil {
+		firstResult.TLS.LocalAddress = host
+	}
+	firstResult.TLS.IPVersion = network.IPVersion(ip)
+
 	// 关闭第一次握手的连接
 	connMgr.CloseTLSConnection(normalConn)
 
@@ -89,7 +107,10 @@ func (cts *ComprehensiveTLSStage) performComprehensiveTLSDetection(ctx *types.Pi
 	}
 
 	// 第二次握手：强制X25519握手，检测X25519支持
-	supportsX25519 := cts.checkX25519Support(domain, 3*time.Second)
+	// 强制曲线的握手只判断是否支持，耗时与正常握手不可比，不计入握手采样
+	// 连接和握手使用配置的连接超时
+	dialer := network.NewDialer(ctx.Config)
+	supportsX25519 := cts.checkX25519Support(ctx.Context, network.NewRetryPolicy(ctx.Config), dialer, domain, ip, port, dialer.Timeout())
 
 	// 更新TLS结果中的X25519支持
 	firstResult.TLS.SupportsX25519 = supportsX25519
@@ -146,12 +167,13 @@ func (cts *ComprehensiveTLSStage) analyzeTLSState(state tls.ConnectionState, dom
 
 	return &ComprehensiveTLSResult{
 		TLS: &types.TLSResult{
-			ProtocolVersion: fmt.Sprintf("TLS %d.%d", (state.Version>>8)&0xFF, state.Version&0xFF),
-			SupportsTLS13:   supportsTLS13,
-			SupportsX25519:  false, // 将在第二次握手后更新
-			SupportsHTTP2:   supportsHTTP2,
-			CipherSuite:     tls.CipherSuiteName(state.CipherSuite),
-			HandshakeTime:   handshakeTime,
+			ProtocolVersion:  fmt.Sprintf("TLS %d.%d", (state.Version>>8)&0xFF, state.Version&0xFF),
+			SupportsTLS13:    supportsTLS13,
+			SupportsX25519:   false, // 将在第二次握手后更新
+			SupportsHTTP2:    supportsHTTP2,
+			CipherSuite:      tls.CipherSuiteName(state.CipherSuite),
+			HandshakeTime:    handshakeTime,
+			HandshakeSamples: []time.Duration{handshakeTime},
 		},
 		SNI: &types.SNIResult{
 			SupportsSNI: supportsSNI,
@@ -184,7 +206,7 @@ func (cts *ComprehensiveTLSStage) performDirectTLSDetection(domain string) *Comp
 }
 
 // createFailedResult 创建失败结果
-func (cts *ComprehensiveTLSStage) createFailedResult(startTime time.Time) *ComprehensiveTLSResult {
+func (cts *ComprehensiveTLSStage) createFailedResult(startTime time.Time, err error) *ComprehensiveTLSResult {
 	return &ComprehensiveTLSResult{
 		TLS: &types.TLSResult{
 			ProtocolVersion: "",
@@ -200,14 +222,35 @@ func (cts *ComprehensiveTLSStage) createFailedResult(startTime time.Time) *Compr
 			ServerName:  "",
 		},
 		Certificate: nil,
+		Err:         err,
 	}
 }
 
 // checkX25519Support 检查X25519支持（正确的检测方法）
-func (cts *ComprehensiveTLSStage) checkX25519Support(domain string, timeout time.Duration) bool {
-	const port = ":443"
+// TCP连接和TLS握手分别记录到阶段记录器，便于区分重复握手的开销；ip 为空时按域名连接
+// 超时、连接重置等临时错误按重试策略重试，服务器拒绝握手是明确结论，不再重试
+func (cts *ComprehensiveTLSStage) checkX25519Support(ctx context.Context, retry *network.RetryPolicy, dialer *network.Dialer, domain, ip, port string, timeout time.Duration) bool {
+	address := net.JoinHostPort(domain, port)
+	if ip != "" {
+		address = net.JoinHostPort(ip, port)
+	}
+
+	var state tls.ConnectionState
+	_, err := retry.Do(ctx, func(ctx context.Context) (err error) {
+		state, err = cts.x25519Handshake(ctx, dialer, domain, address, timeout)
+		return err
+	})
+	if err != nil {
+		// X25519握手失败，说明不支持X25519
+		return false
+	}
 
-	// 专门做一次"仅X25519"的握手
+	// 握手成功且使用TLS1.3，说明支持X25519
+	return state.Version == tls.VersionTLS13
+}
+
+// x25519Handshake 进行一次"仅X25519"的握手，连接和握手共用同一个超时
+func (cts *ComprehensiveTLSStage) x25519Handshake(ctx context.Context, dialer *network.Dialer, domain, address string, timeout time.Duration) (tls.ConnectionState, error) {
 	x25519Config := &tls.Config{
 		ServerName:       domain,
 		CurvePreferences: []tls.CurveID{tls.X25519}, // 强制仅使用X25519
@@ -216,21 +259,26 @@ func (cts *ComprehensiveTLSStage) checkX25519Support(domain string, timeout time
 		MaxVersion:       tls.VersionTLS13,
 	}
 
-	conn, err := tls.DialWithDialer(&net.Dialer{
-		Timeout: timeout,
-	}, "tcp", domain+port, x25519Config)
+	deadline := time.Now().Add(timeout)
 
+	done := types.StartOperation(ctx, types.OperationTCP, address)
+	rawConn, err := dialer.WithTimeout(timeout).DialContext(ctx, "tcp", address)
+	done(err)
 	if err != nil {
-		// X25519握手失败，说明不支持X25519
-		return false
+		return tls.ConnectionState{}, err
 	}
-	defer conn.Close()
+	defer rawConn.Close()
 
-	// 检查连接状态
-	state := conn.ConnectionState()
+	rawConn.SetDeadline(deadline)
+	conn := tls.Client(rawConn, x25519Config)
 
-	// 握手成功且使用TLS1.3，说明支持X25519
-	return state.Version == tls.VersionTLS13
+	done = types.StartOperation(ctx, types.OperationTLS, domain+" @"+address+" (X25519)")
+	err = conn.HandshakeContext(ctx)
+	done(err)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return conn.ConnectionState(), nil
 }
 
 // CanEarlyExit 是否可以早期退出
@@ -248,6 +296,25 @@ func (cts *ComprehensiveTLSStage) Name() string {
 	return "comprehensive_tls"
 }
 
+// Produces 产出的数据
+func (cts *ComprehensiveTLSStage) Produces() []types.Artifact {
+	return []types.Artifact{
+		types.ArtifactTLS,
+		types.ArtifactCertificate,
+		types.ArtifactCDN,
+	}
+}
+
+// Consumes 依赖的数据
+// 已有HTTP CDN结论时跳过证书CDN检测
+func (cts *ComprehensiveTLSStage) Consumes() []types.Artifact {
+	return []types.Artifact{
+		types.ArtifactFinalDomain,
+		types.ArtifactResolvedIP,
+		types.ArtifactCDN,
+	}
+}
+
 // checkCriticalRequirements 检查关键要求
 func (cts *ComprehensiveTLSStage) checkCriticalRequirements(result *ComprehensiveTLSResult) bool {
 	// 检查TLS1.3支持
@@ -274,12 +341,12 @@ func (cts *ComprehensiveTLSStage) checkCriticalRequirements(result *Comprehensiv
 }
 
 // performCDNDetection 执行证书CDN检测
-func (cts *ComprehensiveTLSStage) performCDNDetection(ctx *types.PipelineContext, domain string) *types.CDNResult {
+func (cts *ComprehensiveTLSStage) performCDNDetection(certificate *types.CertificateResult) *types.CDNResult {
 	// 只执行证书相关的CDN检测（低置信度）
 	// 使用已有的证书信息，避免重复TLS连接
-	if ctx.Result.Certificate != nil {
+	if certificate != nil {
 		// 检查证书签发者
-		issuer := ctx.Result.Certificate.Issuer
+		issuer := certificate.Issuer
 		issuerLower := strings.ToLower(issuer)
 
 		// 检查是否包含CDN特征
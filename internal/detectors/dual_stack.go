@@ -0,0 +1,132 @@
+package detectors
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"RealityChecker/internal/network"
+	"RealityChecker/internal/types"
+)
+
+// DualStackStage 双栈检测阶段
+// 双栈模式下其他阶段以IPv4地址完成检测，本阶段另外对域名的IPv6地址进行
+// HTTP可达性和状态码、地理位置、TLS和证书检测，得出IPv6的单独结论
+type DualStackStage struct {
+	location *LocationStage
+	tls      *ComprehensiveTLSStage
+}
+
+// NewDualStackStage 创建双栈检测阶段，复用地理位置和综合TLS阶段的检测实现
+func NewDualStackStage(location *LocationStage, tls *ComprehensiveTLSStage) *DualStackStage {
+	return &DualStackStage{
+		location: location,
+		tls:      tls,
+	}
+}
+
+// Execute 执行IPv6检测
+func (ds *DualStackStage) Execute(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+	domain := ctx.FinalDomain()
+	entry, err := network.PipelineRecords(ctx, domain)
+	if err != nil {
+		return nil, fmt.Errorf("IP解析失败: %v", err)
+	}
+
+	// 没有IPv6地址是IPv6的结论，不是阶段错误
+	if len(entry.AAAA) == 0 {
+		return &types.DetectionResult{
+			IPv6: &types.AddressResult{Error: "未找到IPv6地址"},
+		}, nil
+	}
+
+	address := probeAddress(ctx, ds.location, ds.tls, domain, entry.AAAA[0])
+	if address.Error == "" {
+		address.Network = ds.probeHTTP(ctx, domain, entry.AAAA[0])
+	}
+
+	// 被取消或超时的握手不能作为IPv6的结论
+	if err := ctx.Context.Err(); err != nil {
+		return nil, fmt.Errorf("IPv6检测中断: %v", err)
+	}
+
+	return &types.DetectionResult{IPv6: &address}, nil
+}
+
+// probeHTTP 经指定地址请求最终URL（不跟随重定向），得出该地址的HTTP可达性和状态码
+func (ds *DualStackStage) probeHTTP(ctx *types.PipelineContext, domain, ip string) *types.NetworkResult {
+	port := ctx.FinalPort()
+	targetURL := "https://" + types.JoinTarget(domain, port) + "/"
+	if ctx.Result != nil && ctx.Result.Network != nil && ctx.Result.Network.Accessible && ctx.Result.Network.URL != "" {
+		targetURL = ctx.Result.Network.URL
+	}
+	result := &types.NetworkResult{FinalDomain: domain, URL: targetURL}
+
+	// 域名只用作SNI和Host，连接固定到该地址
+	address := net.JoinHostPort(ip, port)
+	dialer := network.NewDialer(ctx.Config).WithTimeout(3 * time.Second)
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(dialCtx context.Context, proto, _ string) (net.Conn, error) {
+				return dialer.DialContext(dialCtx, proto, address)
+			},
+			ForceAttemptHTTP2: true,
+			DisableKeepAlives: true,
+		},
+		Timeout: 3 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	req, err := http.NewRequestWithContext(network.WithHTTPTrace(ctx.Context), "GET", targetURL, nil)
+	if err != nil {
+		return result
+	}
+	setBrowserHeaders(req)
+
+	startTime := time.Now()
+	done := types.StartOperation(ctx.Context, types.OperationHTTP, targetURL+" @"+address)
+	resp, err := client.Do(req)
+	done(err)
+	if err != nil {
+		return result
+	}
+	resp.Body.Close()
+
+	result.Accessible = true
+	result.StatusCode = resp.StatusCode
+	result.ResponseTime = time.Since(startTime)
+	return result
+}
+
+// CanEarlyExit 是否可以早期退出
+func (ds *DualStackStage) CanEarlyExit() bool {
+	return false // IPv6结论只补充到结果中，不终止流水线
+}
+
+// Priority 优先级
+func (ds *DualStackStage) Priority() int {
+	return 4 // 与综合TLS检测并行
+}
+
+// Name 阶段名称
+func (ds *DualStackStage) Name() string {
+	return "ipv6"
+}
+
+// Produces 产出的数据
+func (ds *DualStackStage) Produces() []types.Artifact {
+	return []types.Artifact{types.ArtifactIPv6}
+}
+
+// Consumes 依赖的数据
+// 记录集由IP解析阶段写入流水线共享的DNS缓存
+func (ds *DualStackStage) Consumes() []types.Artifact {
+	return []types.Artifact{
+		types.ArtifactFinalDomain,
+		types.ArtifactResolvedIP,
+	}
+}
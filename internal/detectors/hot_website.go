@@ -23,30 +23,22 @@ func NewHotWebsiteStage() *HotWebsiteStage {
 }
 
 // Execute 执行热门网站检测
-func (hws *HotWebsiteStage) Execute(ctx *types.PipelineContext) error {
+func (hws *HotWebsiteStage) Execute(ctx *types.PipelineContext) (*types.DetectionResult, error) {
 
 	// 使用最终域名进行热门网站检测
-	finalDomain := ctx.Domain
-	if ctx.Result.Network != nil && ctx.Result.Network.FinalDomain != "" {
-		finalDomain = ctx.Result.Network.FinalDomain
-	}
+	finalDomain := ctx.FinalDomain()
 
 	// 检测是否为热门网站
 	isHotWebsite := hws.detectHotWebsite(finalDomain)
 
-	// 更新CDN结果
-	if ctx.Result.CDN != nil {
-		ctx.Result.CDN.IsHotWebsite = isHotWebsite
-	} else {
-		ctx.Result.CDN = &types.CDNResult{
-			IsHotWebsite: isHotWebsite,
-		}
-	}
-
 	// 热门网站检测只是信息性的，不影响适合性判断
 	// 热门网站只是建议不推荐，但不是硬性要求
-
-	return nil
+	// 热门标记写入CDN结果，由流水线与其他阶段的CDN结论合并
+	return &types.DetectionResult{
+		CDN: &types.CDNResult{
+			IsHotWebsite: isHotWebsite,
+		},
+	}, nil
 }
 
 // detectHotWebsite 检测热门网站
@@ -149,3 +141,13 @@ func (hws *HotWebsiteStage) Priority() int {
 func (hws *HotWebsiteStage) Name() string {
 	return "hot_website"
 }
+
+// Produces 产出的数据
+func (hws *HotWebsiteStage) Produces() []types.Artifact {
+	return []types.Artifact{types.ArtifactHotWebsite}
+}
+
+// Consumes 依赖的数据
+func (hws *HotWebsiteStage) Consumes() []types.Artifact {
+	return []types.Artifact{types.ArtifactFinalDomain, types.ArtifactCDN}
+}
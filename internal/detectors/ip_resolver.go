@@ -6,6 +6,7 @@ import (
 	"net"
 	"time"
 
+	"RealityChecker/internal/network"
 	"RealityChecker/internal/types"
 )
 
@@ -18,80 +19,64 @@ func NewIPResolverStage() *IPResolverStage {
 }
 
 // Execute 执行IP解析
-func (irs *IPResolverStage) Execute(ctx *types.PipelineContext) error {
+func (irs *IPResolverStage) Execute(ctx *types.PipelineContext) (*types.DetectionResult, error) {
 
 	// 解析IP地址
-	ip, err := irs.resolveIP(ctx.Domain)
+	ip, err := irs.resolveIP(ctx, ctx.FinalDomain())
 	if err != nil {
-		return fmt.Errorf("IP解析失败: %v", err)
+		return nil, fmt.Errorf("IP解析失败: %v", err)
 	}
 
 	// 快速连通性测试
-	if !irs.quickConnectivityTest(ip) {
-		return fmt.Errorf("网络不可达")
+	dialer := network.NewDialer(ctx.Config).WithTimeout(2 * time.Second)
+	if err := irs.quickConnectivityTest(ctx.Context, network.NewRetryPolicy(ctx.Config), dialer, ip, ctx.FinalPort()); err != nil {
+		return nil, fmt.Errorf("网络不可达: %w", err)
 	}
 
 	// 设置IP地址到Location结果中
-	if ctx.Result.Location == nil {
-		ctx.Result.Location = &types.LocationResult{}
-	}
-	ctx.Result.Location.IPAddress = ip
-
-	return nil
+	return &types.DetectionResult{
+		Location: &types.LocationResult{IPAddress: ip, IPVersion: network.IPVersion(ip)},
+	}, nil
 }
 
-// quickConnectivityTest 快速连通性测试
-func (irs *IPResolverStage) quickConnectivityTest(ip string) bool {
-	// 测试HTTPS端口443的连通性
-	conn, err := net.DialTimeout("tcp", ip+":443", 2*time.Second)
-	if err != nil {
-		// 如果HTTPS不可达，尝试HTTP端口80
-		conn, err = net.DialTimeout("tcp", ip+":80", 2*time.Second)
-		if err != nil {
-			return false
+// quickConnectivityTest 快速连通性测试，丢包等临时错误按重试策略重试，避免误判为不可达
+// 所有端口都不可达时返回最后一次连接的错误
+func (irs *IPResolverStage) quickConnectivityTest(ctx context.Context, retry *network.RetryPolicy, dialer *network.Dialer, ip, port string) error {
+	// 测试目标端口的连通性；默认的443端口不可达时，尝试HTTP端口80
+	ports := []string{port}
+	if port == types.DefaultPort {
+		ports = append(ports, "80")
+	}
+	var err error
+	for _, port := range ports {
+		var conn net.Conn
+		_, err = retry.Do(ctx, func(ctx context.Context) (err error) {
+			conn, err = irs.dial(ctx, dialer, net.JoinHostPort(ip, port))
+			return err
+		})
+		if err == nil {
+			conn.Close()
+			return nil
 		}
 	}
-	conn.Close()
-	return true
+	return err
 }
 
-// resolveIP 解析IP地址
-func (irs *IPResolverStage) resolveIP(domain string) (string, error) {
-	// 检查是否已经是IP地址
-	if net.ParseIP(domain) != nil {
-		return domain, nil
-	}
-
-	// 使用自定义DNS解析器，设置更短的超时
-	resolver := &net.Resolver{
-		PreferGo: true,
-		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-			d := net.Dialer{
-				Timeout: 2 * time.Second, // DNS查询超时2秒
-			}
-			return d.DialContext(ctx, network, address)
-		},
-	}
+// dial 建立TCP连接并记录耗时
+func (irs *IPResolverStage) dial(ctx context.Context, dialer *network.Dialer, address string) (net.Conn, error) {
+	done := types.StartOperation(ctx, types.OperationTCP, address)
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	done(err)
+	return conn, err
+}
 
-	// 解析域名
-	ips, err := resolver.LookupIPAddr(context.Background(), domain)
+// resolveIP 解析IP地址，记录集写入流水线共享的DNS缓存，后续阶段不再重复解析
+func (irs *IPResolverStage) resolveIP(ctx *types.PipelineContext, domain string) (string, error) {
+	entry, err := network.PipelineRecords(ctx, domain)
 	if err != nil {
 		return "", err
 	}
-
-	if len(ips) == 0 {
-		return "", fmt.Errorf("未找到IP地址")
-	}
-
-	// 优先选择IPv4地址
-	for _, ipAddr := range ips {
-		if ipAddr.IP.To4() != nil {
-			return ipAddr.IP.String(), nil
-		}
-	}
-
-	// 如果没有IPv4，使用IPv6
-	return ips[0].IP.String(), nil
+	return entry.IP, nil
 }
 
 // CanEarlyExit 是否可以早期退出
@@ -108,3 +93,13 @@ func (irs *IPResolverStage) Priority() int {
 func (irs *IPResolverStage) Name() string {
 	return "ip_resolver"
 }
+
+// Produces 产出的数据
+func (irs *IPResolverStage) Produces() []types.Artifact {
+	return []types.Artifact{types.ArtifactResolvedIP}
+}
+
+// Consumes 依赖的数据
+func (irs *IPResolverStage) Consumes() []types.Artifact {
+	return []types.Artifact{types.ArtifactFinalDomain}
+}
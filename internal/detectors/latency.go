@@ -0,0 +1,106 @@
+package detectors
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"RealityChecker/internal/network"
+	"RealityChecker/internal/types"
+)
+
+// latencySample 一次延迟采样，ttfb 为0表示未收到HTTP响应
+type latencySample struct {
+	tcp       time.Duration
+	handshake time.Duration
+	ttfb      time.Duration
+}
+
+// measureLatency 对同一地址多次采样，分别测量TCP连接、TLS握手和首字节时间
+// 每次采样使用新连接；失败的采样不计入统计，全部失败时返回nil；ip 为空时按域名连接
+func (cts *ComprehensiveTLSStage) measureLatency(ctx *types.PipelineContext, domain, ip, port string) *types.LatencyResult {
+	samples := ctx.Config.Network.LatencySamples
+	if samples <= 0 {
+		samples = types.DefaultLatencySamples
+	}
+
+	address := net.JoinHostPort(domain, port)
+	if ip != "" {
+		address = net.JoinHostPort(ip, port)
+	}
+	dialer := network.NewDialer(ctx.Config)
+	timeout := ctx.Config.Network.Timeout
+
+	result := &types.LatencyResult{}
+	var tcpTimes, handshakeTimes, ttfbTimes []time.Duration
+	for i := 0; i < samples && ctx.Context.Err() == nil; i++ {
+		result.Attempts++
+		sample, err := cts.sampleLatency(ctx.Context, dialer, domain, port, address, timeout)
+		if err != nil {
+			continue
+		}
+		result.Samples++
+		tcpTimes = append(tcpTimes, sample.tcp)
+		handshakeTimes = append(handshakeTimes, sample.handshake)
+		if sample.ttfb > 0 {
+			ttfbTimes = append(ttfbTimes, sample.ttfb)
+		}
+	}
+	if result.Samples == 0 {
+		return nil
+	}
+
+	result.TCP = types.NewLatencyStats(tcpTimes)
+	result.Handshake = types.NewLatencyStats(handshakeTimes)
+	result.TTFB = types.NewLatencyStats(ttfbTimes)
+	return result
+}
+
+// sampleLatency 进行一次采样：TCP连接、TLS握手，再发送HTTP/1.1请求等待响应首字节
+// 只测量耗时，协议和证书已由第一次握手检测，因此不校验证书；首字节失败不影响连接和握手的样本
+func (cts *ComprehensiveTLSStage) sampleLatency(ctx context.Context, dialer *network.Dialer, domain, port, address string, timeout time.Duration) (latencySample, error) {
+	var sample latencySample
+	deadline := time.Now().Add(timeout)
+
+	startTime := time.Now()
+	done := types.StartOperation(ctx, types.OperationTCP, address+" (延迟采样)")
+	rawConn, err := dialer.WithTimeout(timeout).DialContext(ctx, "tcp", address)
+	done(err)
+	if err != nil {
+		return sample, err
+	}
+	defer rawConn.Close()
+	sample.tcp = time.Since(startTime)
+
+	rawConn.SetDeadline(deadline)
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName:         domain,
+		NextProtos:         []string{"http/1.1"}, // 首字节测量使用HTTP/1.1
+		InsecureSkipVerify: true,
+	})
+
+	startTime = time.Now()
+	done = types.StartOperation(ctx, types.OperationTLS, domain+" @"+address+" (延迟采样)")
+	err = conn.HandshakeContext(ctx)
+	done(err)
+	if err != nil {
+		return sample, err
+	}
+	sample.handshake = time.Since(startTime)
+
+	host := types.JoinTarget(domain, port)
+	request := fmt.Sprintf("GET / HTTP/1.1\r\nHost: %s\r\nUser-Agent: Mozilla/5.0\r\nConnection: close\r\n\r\n", host)
+	startTime = time.Now()
+	done = types.StartOperation(ctx, types.OperationHTTP, "https://"+host+"/ (首字节)")
+	_, err = conn.Write([]byte(request))
+	if err == nil {
+		_, err = conn.Read(make([]byte, 1))
+	}
+	done(err)
+	if err == nil {
+		sample.ttfb = time.Since(startTime)
+	}
+	return sample, nil
+}
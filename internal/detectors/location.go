@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net"
 
+	"RealityChecker/internal/network"
 	"RealityChecker/internal/types"
 
 	"github.com/oschwald/geoip2-golang"
@@ -12,6 +13,7 @@ import (
 // LocationStage 地理位置检测阶段
 type LocationStage struct {
 	geoipDB *geoip2.Reader
+	asnDB   *geoip2.Reader // 可选的ASN数据库（GeoLite2-ASN格式）
 }
 
 // NewLocationStage 创建地理位置检测阶段
@@ -22,54 +24,55 @@ func NewLocationStage() *LocationStage {
 }
 
 // Execute 执行地理位置检测
-func (ls *LocationStage) Execute(ctx *types.PipelineContext) error {
+func (ls *LocationStage) Execute(ctx *types.PipelineContext) (*types.DetectionResult, error) {
 
 	// 解析IP地址
-	ip, err := ls.resolveIP(ctx.Domain)
+	ip, err := ls.resolveIP(ctx)
 	if err != nil {
-		return fmt.Errorf("IP解析失败: %v", err)
+		return nil, fmt.Errorf("IP解析失败: %v", err)
 	}
 
-	// 获取地理位置
-	country, isDomestic := ls.getLocation(ip)
-
-	ctx.Result.Location = &types.LocationResult{
-		Country:    country,
-		IsDomestic: isDomestic,
-		IPAddress:  ip,
+	// 获取地理位置，按策略判断是否国内
+	policy := ctx.Config.PolicyFor(ctx.Domain)
+	country, countryCode := ls.getLocation(ip)
+	isDomestic := policy.IsDomesticCountry(countryCode, country)
+
+	asn, isp := ls.getASN(ip)
+
+	partial := &types.DetectionResult{
+		Location: &types.LocationResult{
+			Country:     country,
+			CountryCode: countryCode,
+			IsDomestic:  isDomestic,
+			IPAddress:   ip,
+			IPVersion:   network.IPVersion(ip),
+			ASN:         asn,
+			ISP:         isp,
+		},
 	}
 
-	if isDomestic {
-		ctx.EarlyExit = true
-		return fmt.Errorf("国内网站（仅参考GeoIP）")
+	// 国内网站是检测结论而非错误，只请求早期退出，由流水线给出结论
+	if isDomestic && policy.Requires(types.RuleNotDomestic) {
+		partial.EarlyExit = true
 	}
 
-	return nil
+	return partial, nil
 }
 
-// resolveIP 解析IP地址
-func (ls *LocationStage) resolveIP(domain string) (string, error) {
-	ips, err := net.LookupIP(domain)
+// resolveIP 返回IP解析阶段选定的地址，确保定位的地址就是后续连接的地址
+func (ls *LocationStage) resolveIP(ctx *types.PipelineContext) (string, error) {
+	if ip := ctx.ResolvedIP(); ip != "" {
+		return ip, nil
+	}
+	entry, err := network.PipelineRecords(ctx, ctx.FinalDomain())
 	if err != nil {
 		return "", err
 	}
-
-	if len(ips) == 0 {
-		return "", fmt.Errorf("未找到IP地址")
-	}
-
-	// 优先选择IPv4地址
-	for _, ip := range ips {
-		if ip.To4() != nil {
-			return ip.String(), nil
-		}
-	}
-
-	return ips[0].String(), nil
+	return entry.IP, nil
 }
 
-// getLocation 获取地理位置
-func (ls *LocationStage) getLocation(ip string) (string, bool) {
+// getLocation 获取地理位置，返回国家名称和ISO代码
+func (ls *LocationStage) getLocation(ip string) (string, string) {
 	// 注意：这里传入的是IP地址，不是域名，所以不需要检查域名特征
 
 	// 使用GeoIP数据库
@@ -84,21 +87,35 @@ func (ls *LocationStage) getLocation(ip string) (string, bool) {
 				}
 			}
 
-			isDomestic := (country == "中国" || country == "CN")
-			return country, isDomestic
+			return country, record.Country.IsoCode
 		}
 	}
 
-	return "未知", false
+	return "未知", ""
+}
+
+// getASN 获取ASN和运营商，未提供ASN数据库时返回空
+func (ls *LocationStage) getASN(ip string) (string, string) {
+	if ls.asnDB == nil {
+		return "", ""
+	}
+	record, err := ls.asnDB.ASN(net.ParseIP(ip))
+	if err != nil || record.AutonomousSystemNumber == 0 {
+		return "", ""
+	}
+	return fmt.Sprintf("AS%d", record.AutonomousSystemNumber), record.AutonomousSystemOrganization
 }
 
 // loadGeoIPDatabase 加载GeoIP数据库
 func (ls *LocationStage) loadGeoIPDatabase() {
-	db, err := geoip2.Open("data/Country.mmdb")
-	if err != nil {
-		return
+	if db, err := geoip2.Open("data/Country.mmdb"); err == nil {
+		ls.geoipDB = db
+	}
+
+	// ASN数据库为可选文件，不存在时跳过
+	if asnDB, err := geoip2.Open("data/ASN.mmdb"); err == nil {
+		ls.asnDB = asnDB
 	}
-	ls.geoipDB = db
 }
 
 // CanEarlyExit 是否可以早期退出
@@ -115,3 +132,13 @@ func (ls *LocationStage) Priority() int {
 func (ls *LocationStage) Name() string {
 	return "location"
 }
+
+// Produces 产出的数据
+func (ls *LocationStage) Produces() []types.Artifact {
+	return []types.Artifact{types.ArtifactLocation}
+}
+
+// Consumes 依赖的数据
+func (ls *LocationStage) Consumes() []types.Artifact {
+	return []types.Artifact{types.ArtifactResolvedIP}
+}
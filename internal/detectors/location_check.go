@@ -14,10 +14,10 @@ func NewLocationCheckStage() *LocationCheckStage {
 }
 
 // Execute 执行地理位置检查
-func (lcs *LocationCheckStage) Execute(ctx *types.PipelineContext) error {
+func (lcs *LocationCheckStage) Execute(ctx *types.PipelineContext) (*types.DetectionResult, error) {
 	// 检查地理位置结果是否存在
 	if ctx.Result.Location == nil {
-		return nil
+		return nil, nil
 	}
 
 	// 检查是否为中国
@@ -26,7 +26,7 @@ func (lcs *LocationCheckStage) Execute(ctx *types.PipelineContext) error {
 		// 最终结果会在Batch Manager中处理
 	}
 
-	return nil
+	return nil, nil
 }
 
 // CanEarlyExit 是否可以早期退出
@@ -43,3 +43,13 @@ func (lcs *LocationCheckStage) Priority() int {
 func (lcs *LocationCheckStage) Name() string {
 	return "location_check"
 }
+
+// Produces 产出的数据
+func (lcs *LocationCheckStage) Produces() []types.Artifact {
+	return nil
+}
+
+// Consumes 依赖的数据
+func (lcs *LocationCheckStage) Consumes() []types.Artifact {
+	return []types.Artifact{types.ArtifactLocation}
+}
@@ -1,11 +1,14 @@
 package detectors
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"RealityChecker/internal/network"
 	"RealityChecker/internal/types"
 )
 
@@ -18,44 +21,48 @@ func NewRedirectStage() *RedirectStage {
 }
 
 // Execute 执行重定向检测
-func (rs *RedirectStage) Execute(ctx *types.PipelineContext) error {
+func (rs *RedirectStage) Execute(ctx *types.PipelineContext) (*types.DetectionResult, error) {
+
+	// 按流水线共享的记录集拨号，重定向经过的每个域名只解析一次
+	transport := network.NewRecordsTransport(ctx, network.NewDialer(ctx.Config).WithTimeout(3*time.Second))
+	defer transport.CloseIdleConnections()
 
 	// 创建HTTP客户端，禁用自动重定向
 	client := &http.Client{
-		Timeout: 3 * time.Second, // 减少HTTP客户端超时时间到3秒
+		Transport: transport,
+		Timeout:   3 * time.Second, // 减少HTTP客户端超时时间到3秒
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
 	}
 
 	// 跟踪重定向
-	result := rs.followRedirects(client, ctx.Domain)
-
-	// 设置网络结果
-	ctx.Result.Network = &types.NetworkResult{
-		Accessible:    result.Accessible,
-		StatusCode:    result.StatusCode,
-		FinalDomain:   result.FinalDomain,
-		RedirectChain: result.RedirectChain,
-		IsRedirected:  result.IsRedirected,
-		RedirectCount: result.RedirectCount,
-		URL:           result.URL,
-		ResponseTime:  time.Since(ctx.StartTime),
-		Headers:       result.Headers, // 保存HTTP响应头
-	}
+	result := rs.followRedirects(ctx.Context, client, ctx.Domain, ctx.Port)
 
-	// 在重定向检测阶段进行HTTP CDN检测
-	httpCDNResult := rs.performHTTPCDNDetection(ctx, result.FinalDomain, ctx.Result.Network)
-	if httpCDNResult != nil {
-		ctx.Result.CDN = httpCDNResult
+	// 被取消或超时导致的不可达不是检测结论
+	if err := ctx.Context.Err(); err != nil && !result.Accessible {
+		return nil, fmt.Errorf("重定向检测中断: %v", err)
 	}
 
-	// 更新域名
-	if result.IsRedirected {
-		ctx.Domain = result.FinalDomain
+	// 设置网络结果，最终域名通过 Network.FinalDomain 传递给下游阶段
+	partial := &types.DetectionResult{
+		Network: &types.NetworkResult{
+			Accessible:    result.Accessible,
+			StatusCode:    result.StatusCode,
+			FinalDomain:   result.FinalDomain,
+			RedirectChain: result.RedirectChain,
+			IsRedirected:  result.IsRedirected,
+			RedirectCount: result.RedirectCount,
+			URL:           result.URL,
+			ResponseTime:  time.Since(ctx.StartTime),
+			Headers:       result.Headers, // 保存HTTP响应头
+		},
 	}
 
-	return nil
+	// 在重定向检测阶段进行HTTP CDN检测
+	partial.CDN = rs.performHTTPCDNDetection(ctx, result.FinalDomain, partial.Network)
+
+	return partial, nil
 }
 
 // RedirectResult 重定向结果
@@ -70,8 +77,8 @@ type RedirectResult struct {
 	Headers       map[string]string // HTTP响应头
 }
 
-// followRedirects 跟踪重定向
-func (rs *RedirectStage) followRedirects(client *http.Client, domain string) *RedirectResult {
+// followRedirects 跟踪重定向，从目标端口开始请求
+func (rs *RedirectStage) followRedirects(ctx context.Context, client *http.Client, domain, port string) *RedirectResult {
 	const (
 		maxRedirects = 5
 		httpsScheme  = "https://"
@@ -84,29 +91,24 @@ func (rs *RedirectStage) followRedirects(client *http.Client, domain string) *Re
 		RedirectChain: []string{domain},
 		IsRedirected:  false,
 		RedirectCount: 0,
-		URL:           httpsScheme + domain,
+		URL:           httpsScheme + types.JoinTarget(domain, port),
 	}
 
-	currentURL := httpsScheme + domain
+	currentURL := result.URL
 
 	for i := 0; i < maxRedirects; i++ {
-		req, err := http.NewRequest("GET", currentURL, nil)
+		// 挂载httptrace，记录请求内的DNS、TCP、TLS耗时
+		req, err := http.NewRequestWithContext(network.WithHTTPTrace(ctx), "GET", currentURL, nil)
 		if err != nil {
 			break
 		}
 
 		// 添加浏览器头
-		const (
-			userAgent      = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36"
-			acceptHeader   = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
-			acceptLanguage = "en-US,en;q=0.9"
-		)
-
-		req.Header.Set("User-Agent", userAgent)
-		req.Header.Set("Accept", acceptHeader)
-		req.Header.Set("Accept-Language", acceptLanguage)
+		setBrowserHeaders(req)
 
+		done := types.StartOperation(ctx, types.OperationHTTP, currentURL)
 		resp, err := client.Do(req)
+		done(err)
 		if err != nil {
 			break
 		}
@@ -170,6 +172,19 @@ func (rs *RedirectStage) followRedirects(client *http.Client, domain string) *Re
 	return result
 }
 
+// setBrowserHeaders 添加浏览器请求头，部分网站拒绝没有浏览器头的请求
+func setBrowserHeaders(req *http.Request) {
+	const (
+		userAgent      = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36"
+		acceptHeader   = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+		acceptLanguage = "en-US,en;q=0.9"
+	)
+
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", acceptHeader)
+	req.Header.Set("Accept-Language", acceptLanguage)
+}
+
 // CanEarlyExit 是否可以早期退出
 func (rs *RedirectStage) CanEarlyExit() bool {
 	return true // 重定向检测必须在TLS检测之前执行
@@ -185,6 +200,22 @@ func (rs *RedirectStage) Name() string {
 	return "redirect"
 }
 
+// Produces 产出的数据
+func (rs *RedirectStage) Produces() []types.Artifact {
+	return []types.Artifact{
+		types.ArtifactFinalDomain,
+		types.ArtifactHTTPStatus,
+		types.ArtifactHeaders,
+		types.ArtifactCDN,
+	}
+}
+
+// Consumes 依赖的数据
+// 被墙域名无需发起网络请求，因此依赖被墙检测结论
+func (rs *RedirectStage) Consumes() []types.Artifact {
+	return []types.Artifact{types.ArtifactBlocked}
+}
+
 // performHTTPCDNDetection 执行HTTP CDN检测
 func (rs *RedirectStage) performHTTPCDNDetection(ctx *types.PipelineContext, domain string, networkResult *types.NetworkResult) *types.CDNResult {
 	// 创建CDN检测阶段
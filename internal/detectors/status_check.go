@@ -14,21 +14,20 @@ func NewStatusCheckStage() *StatusCheckStage {
 }
 
 // Execute 执行状态码检查
-func (scs *StatusCheckStage) Execute(ctx *types.PipelineContext) error {
+func (scs *StatusCheckStage) Execute(ctx *types.PipelineContext) (*types.DetectionResult, error) {
 	// 检查网络结果是否存在
 	if ctx.Result.Network == nil {
-		return nil
+		return nil, nil
 	}
 
 	// 获取状态码
 	statusCode := ctx.Result.Network.StatusCode
 	accessible := ctx.Result.Network.Accessible
 
-	// 分类状态码
-	category := types.ClassifyStatusCode(statusCode, accessible)
-	ctx.Result.StatusCodeCategory = category
+	// 按策略分类状态码
+	category := ctx.Config.PolicyFor(ctx.Domain).ClassifyStatusCode(statusCode, accessible)
 
-	return nil
+	return &types.DetectionResult{StatusCodeCategory: category}, nil
 }
 
 // CanEarlyExit 是否可以早期退出
@@ -45,3 +44,13 @@ func (scs *StatusCheckStage) Priority() int {
 func (scs *StatusCheckStage) Name() string {
 	return "status_check"
 }
+
+// Produces 产出的数据
+func (scs *StatusCheckStage) Produces() []types.Artifact {
+	return []types.Artifact{types.ArtifactStatusCategory}
+}
+
+// Consumes 依赖的数据
+func (scs *StatusCheckStage) Consumes() []types.Artifact {
+	return []types.Artifact{types.ArtifactHTTPStatus}
+}
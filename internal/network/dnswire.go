@@ -0,0 +1,161 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DNS报文常量
+const (
+	dnsHeaderLen     = 12
+	dnsTypeA         = 1
+	dnsTypeCNAME     = 5
+	dnsClassINET     = 1
+	dnsFlagRD        = 0x0100 // 期望递归
+	dnsFlagTC        = 0x0200 // 响应被截断
+	dnsRcodeNXDomain = 3
+	dnsMaxCNAMEHops  = 16 // CNAME链的最大长度，防止循环
+	dnsMaxPointers   = 32 // 名称压缩指针的最大跳转次数
+)
+
+// buildDNSQuery 构造单个问题的查询报文
+func buildDNSQuery(id uint16, name string, qtype uint16) ([]byte, error) {
+	msg := make([]byte, dnsHeaderLen, dnsHeaderLen+len(name)+6)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], dnsFlagRD)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("域名格式无效: %s", name)
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, dnsClassINET)
+	return msg, nil
+}
+
+// dnsResponse 解析后的响应中与CNAME链相关的部分
+type dnsResponse struct {
+	truncated bool
+	cnames    map[string]string // 别名 -> 目标，名称均为小写且不带末尾的点
+}
+
+// parseDNSResponse 解析响应报文的应答部分
+func parseDNSResponse(msg []byte, id uint16, host string) (*dnsResponse, error) {
+	if len(msg) < dnsHeaderLen {
+		return nil, fmt.Errorf("DNS响应过短")
+	}
+	if binary.BigEndian.Uint16(msg[0:]) != id {
+		return nil, fmt.Errorf("DNS响应ID不匹配")
+	}
+
+	flags := binary.BigEndian.Uint16(msg[2:])
+	response := &dnsResponse{truncated: flags&dnsFlagTC != 0, cnames: make(map[string]string)}
+	if response.truncated {
+		return response, nil
+	}
+	switch rcode := flags & 0x000f; rcode {
+	case 0:
+	case dnsRcodeNXDomain:
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	default:
+		return nil, &net.DNSError{Err: fmt.Sprintf("服务器返回错误码 %d", rcode), Name: host}
+	}
+
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+
+	offset := dnsHeaderLen
+	for i := 0; i < questions; i++ {
+		_, next, err := readDNSName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4
+	}
+
+	for i := 0; i < answers; i++ {
+		owner, next, err := readDNSName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, fmt.Errorf("DNS响应记录不完整")
+		}
+		rtype := binary.BigEndian.Uint16(msg[next:])
+		rdlen := int(binary.BigEndian.Uint16(msg[next+8:]))
+		rdata := next + 10
+		if rdata+rdlen > len(msg) {
+			return nil, fmt.Errorf("DNS响应记录不完整")
+		}
+		if rtype == dnsTypeCNAME {
+			target, _, err := readDNSName(msg, rdata)
+			if err != nil {
+				return nil, err
+			}
+			response.cnames[owner] = target
+		}
+		offset = rdata + rdlen
+	}
+	return response, nil
+}
+
+// readDNSName 读取可能带压缩指针的名称，返回小写名称和名称之后的偏移
+func readDNSName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, fmt.Errorf("DNS名称越界")
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.ToLower(strings.Join(labels, ".")), next, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) {
+				return "", 0, fmt.Errorf("DNS名称越界")
+			}
+			if jumps++; jumps > dnsMaxPointers {
+				return "", 0, fmt.Errorf("DNS名称压缩指针过多")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, fmt.Errorf("DNS名称越界")
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
+
+// cnameChain 从查询的域名开始沿CNAME记录构造链，没有CNAME时返回空
+func cnameChain(host string, cnames map[string]string) []string {
+	name := strings.ToLower(strings.TrimSuffix(host, "."))
+	var chain []string
+	for hops := 0; hops < dnsMaxCNAMEHops; hops++ {
+		target, ok := cnames[name]
+		if !ok {
+			break
+		}
+		if chain == nil {
+			chain = append(chain, name)
+		}
+		chain = append(chain, target)
+		name = target
+	}
+	return chain
+}
@@ -0,0 +1,150 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// dohMessageType DNS-over-HTTPS 报文类型（RFC 8484）
+const dohMessageType = "application/dns-message"
+
+// dohMaxResponse DNS报文的最大长度
+const dohMaxResponse = 65535
+
+// newDoHClient 创建DoH查询使用的HTTP客户端，复用与服务器的连接
+func newDoHClient(dialer *Dialer) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport}
+}
+
+// dohConn 将Go解析器的TCP格式DNS报文转换为DoH请求的连接
+// 解析器写入“2字节长度+报文”，首次读取时以POST发送报文，并以同样格式返回响应
+type dohConn struct {
+	ctx      context.Context
+	client   *http.Client
+	url      string
+	timeout  time.Duration
+	mu       sync.Mutex
+	query    bytes.Buffer
+	response *bytes.Reader
+	deadline time.Time
+}
+
+// newDoHConn 创建DoH连接
+func newDoHConn(ctx context.Context, client *http.Client, url string, timeout time.Duration) *dohConn {
+	return &dohConn{ctx: ctx, client: client, url: url, timeout: timeout}
+}
+
+// Write 缓存查询报文，上一次响应读完后开始新的查询
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.response != nil {
+		c.response = nil
+		c.query.Reset()
+	}
+	return c.query.Write(b)
+}
+
+// Read 读取响应，首次读取时发送查询
+func (c *dohConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.response == nil {
+		response, err := c.exchange()
+		if err != nil {
+			return 0, err
+		}
+		c.response = bytes.NewReader(response)
+	}
+	return c.response.Read(b)
+}
+
+// exchange 发送DoH请求，返回带长度前缀的响应
+func (c *dohConn) exchange() ([]byte, error) {
+	data := c.query.Bytes()
+	if len(data) < 2 || int(binary.BigEndian.Uint16(data)) != len(data)-2 {
+		return nil, fmt.Errorf("DoH查询报文不完整")
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, c.timeout)
+	defer cancel()
+	if !c.deadline.IsZero() {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithDeadline(ctx, c.deadline)
+		defer cancelDeadline()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(data[2:]))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohMessageType)
+	req.Header.Set("Accept", dohMessageType)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH服务器返回状态码 %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dohMaxResponse+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > dohMaxResponse {
+		return nil, fmt.Errorf("DoH响应过长")
+	}
+
+	response := make([]byte, 2+len(body))
+	binary.BigEndian.PutUint16(response, uint16(len(body)))
+	copy(response[2:], body)
+	return response, nil
+}
+
+// Close 关闭连接
+func (c *dohConn) Close() error { return nil }
+
+// LocalAddr 本地地址
+func (c *dohConn) LocalAddr() net.Addr { return dohAddr(c.url) }
+
+// RemoteAddr 远端地址
+func (c *dohConn) RemoteAddr() net.Addr { return dohAddr(c.url) }
+
+// SetDeadline 设置读写时限
+func (c *dohConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+// SetReadDeadline 设置读时限
+func (c *dohConn) SetReadDeadline(t time.Time) error { return c.SetDeadline(t) }
+
+// SetWriteDeadline 写操作只写入缓冲区，无需时限
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// dohAddr DoH端点地址
+type dohAddr string
+
+// Network 网络类型
+func (a dohAddr) Network() string { return dnsProtocolHTTPS }
+
+// String 地址描述
+func (a dohAddr) String() string { return string(a) }
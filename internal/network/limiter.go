@@ -0,0 +1,233 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// 网段限速的前缀长度
+const (
+	subnetBitsIPv4 = 24
+	subnetBitsIPv6 = 48
+)
+
+// Limiter 连接限速器：限制全局新建连接的速率，以及每个目标IP和每个网段同时打开的连接数
+// 连接关闭时释放占用的名额；目标为域名（经代理且未解析）时只受全局速率限制
+type Limiter struct {
+	interval  time.Duration // 两次新建连接的最小间隔，0为不限制
+	perIP     int
+	perSubnet int
+
+	mu      sync.Mutex
+	next    time.Time      // 下一个连接最早可以开始的时间
+	freed   []time.Time    // 等待中被取消、尚未到达的预约时间点，留给之后的连接
+	ips     map[string]int // 各目标IP打开的连接数
+	subnets map[string]int // 各网段打开的连接数
+	changed chan struct{}  // 有连接关闭时关闭并替换，唤醒等待名额的连接
+}
+
+var (
+	limitersMu sync.Mutex
+	limiters   = make(map[types.RateLimitConfig]*Limiter)
+)
+
+// sharedLimiter 返回限速配置对应的限速器，未配置限速时返回nil
+// 同一份配置的拨号器共用一个限速器，批量检测中各域名、各阶段的连接一起计数
+func sharedLimiter(config types.RateLimitConfig) *Limiter {
+	if config.ConnectionsPerSecond <= 0 && config.PerIP <= 0 && config.PerSubnet <= 0 {
+		return nil
+	}
+
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	if limiter, ok := limiters[config]; ok {
+		return limiter
+	}
+	limiter := &Limiter{
+		perIP:     config.PerIP,
+		perSubnet: config.PerSubnet,
+		ips:       make(map[string]int),
+		subnets:   make(map[string]int),
+		changed:   make(chan struct{}),
+	}
+	if config.ConnectionsPerSecond > 0 {
+		limiter.interval = time.Duration(float64(time.Second) / config.ConnectionsPerSecond)
+	}
+	limiters[config] = limiter
+	return limiter
+}
+
+// Acquire 等待连接名额，返回连接关闭时调用的释放函数
+// 先等待目标IP和网段的并发名额，再按全局速率排队；等待受context约束
+func (l *Limiter) Acquire(ctx context.Context, address string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	ipKey, subnetKey := limitKeys(address)
+	if err := l.acquireSlot(ctx, ipKey, subnetKey); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	release := func() {
+		once.Do(func() { l.releaseSlot(ipKey, subnetKey) })
+	}
+
+	if err := l.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// acquireSlot 占用目标IP和网段的并发名额，名额已满时等待其他连接关闭
+func (l *Limiter) acquireSlot(ctx context.Context, ipKey, subnetKey string) error {
+	if ipKey == "" {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		ipFree := l.perIP <= 0 || l.ips[ipKey] < l.perIP
+		subnetFree := l.perSubnet <= 0 || l.subnets[subnetKey] < l.perSubnet
+		if ipFree && subnetFree {
+			l.ips[ipKey]++
+			l.subnets[subnetKey]++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("等待连接名额中断（%s）: %w", ipKey, ctx.Err())
+		}
+	}
+}
+
+// releaseSlot 释放目标IP和网段的并发名额
+func (l *Limiter) releaseSlot(ipKey, subnetKey string) {
+	if ipKey == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ips[ipKey]--; l.ips[ipKey] <= 0 {
+		delete(l.ips, ipKey)
+	}
+	if l.subnets[subnetKey]--; l.subnets[subnetKey] <= 0 {
+		delete(l.subnets, subnetKey)
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// wait 按全局速率排队，预约下一个可用的时间点并等待到达，等待中被取消时归还预约
+func (l *Limiter) wait(ctx context.Context) error {
+	if l.interval <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	start := l.reserve(time.Now())
+	l.mu.Unlock()
+
+	delay := time.Until(start)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.cancel(start)
+		l.mu.Unlock()
+		return fmt.Errorf("等待连接限速中断: %w", ctx.Err())
+	}
+}
+
+// reserve 预约一个开始时间，优先使用被取消的预约，否则排在队尾；调用方持有锁
+func (l *Limiter) reserve(now time.Time) time.Time {
+	// 已经过去的空闲时间点不再使用，否则与之后的预约间隔不足
+	earliest := -1
+	kept := l.freed[:0]
+	for _, t := range l.freed {
+		if t.Before(now) {
+			continue
+		}
+		if earliest < 0 || t.Before(kept[earliest]) {
+			earliest = len(kept)
+		}
+		kept = append(kept, t)
+	}
+	l.freed = kept
+	if earliest >= 0 {
+		start := l.freed[earliest]
+		l.freed = append(l.freed[:earliest], l.freed[earliest+1:]...)
+		return start
+	}
+
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	return start
+}
+
+// cancel 归还未到达的预约，队尾空闲的预约直接撤销，其余的留给之后的连接；调用方持有锁
+func (l *Limiter) cancel(start time.Time) {
+	l.freed = append(l.freed, start)
+	for {
+		last := l.next.Add(-l.interval)
+		i := 0
+		for i < len(l.freed) && !l.freed[i].Equal(last) {
+			i++
+		}
+		if i == len(l.freed) {
+			return
+		}
+		l.freed = append(l.freed[:i], l.freed[i+1:]...)
+		l.next = last
+	}
+}
+
+// limitKeys 目标地址的IP和网段，目标不是IP时返回空
+func limitKeys(address string) (ipKey, subnetKey string) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", ""
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		mask := net.CIDRMask(subnetBitsIPv4, 32)
+		return ip4.String(), fmt.Sprintf("%s/%d", ip4.Mask(mask), subnetBitsIPv4)
+	}
+	mask := net.CIDRMask(subnetBitsIPv6, 128)
+	return ip.String(), fmt.Sprintf("%s/%d", ip.Mask(mask), subnetBitsIPv6)
+}
+
+// limitedConn 关闭时释放限速名额的连接
+type limitedConn struct {
+	net.Conn
+	release func()
+}
+
+// Close 关闭连接并释放名额
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.release()
+	return err
+}
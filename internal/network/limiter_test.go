@@ -0,0 +1,135 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// newRateLimiter 创建只限制全局速率的限速器，不与其他测试共用
+func newRateLimiter(interval time.Duration) *Limiter {
+	return &Limiter{
+		interval: interval,
+		ips:      make(map[string]int),
+		subnets:  make(map[string]int),
+		changed:  make(chan struct{}),
+	}
+}
+
+// acquireAfter 在 delay 之后申请名额，返回等到名额的时间
+func acquireAfter(t *testing.T, l *Limiter, delay time.Duration) <-chan time.Time {
+	acquired := make(chan time.Time, 1)
+	go func() {
+		time.Sleep(delay)
+		release, err := l.Acquire(context.Background(), "example.com:443")
+		if err != nil {
+			t.Errorf("Acquire: %v", err)
+			close(acquired)
+			return
+		}
+		release()
+		acquired <- time.Now()
+	}()
+	return acquired
+}
+
+func TestLimiterCanceledTailReservationIsReturned(t *testing.T) {
+	l := newRateLimiter(200 * time.Millisecond)
+	start := time.Now()
+	if _, err := l.Acquire(context.Background(), "example.com:443"); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	// 第二个连接预约 start+200ms，等待中被取消
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, "example.com:443"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("错误 = %v，期望 context.DeadlineExceeded", err)
+	}
+
+	// 归还后第三个连接使用 start+200ms，而不是排在被取消的预约之后
+	if elapsed := (<-acquireAfter(t, l, 0)).Sub(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("第三个连接等待到 %s，被取消的预约没有归还", elapsed)
+	}
+}
+
+func TestLimiterCanceledMiddleReservationIsReused(t *testing.T) {
+	l := newRateLimiter(200 * time.Millisecond)
+	start := time.Now()
+	if _, err := l.Acquire(context.Background(), "example.com:443"); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	// 第二个连接预约 start+200ms 后被取消，此时第三个连接已预约 start+400ms
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := l.Acquire(ctx, "example.com:443")
+		canceled <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	third := acquireAfter(t, l, 0)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-canceled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("错误 = %v，期望 context.Canceled", err)
+	}
+
+	// 之后的连接使用空出的 start+200ms
+	if elapsed := (<-acquireAfter(t, l, 0)).Sub(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("第四个连接等待到 %s，空出的预约没有被使用", elapsed)
+	}
+	if elapsed := (<-third).Sub(start); elapsed < 350*time.Millisecond {
+		t.Fatalf("第三个连接在 %s 开始，与前一个连接间隔不足", elapsed)
+	}
+
+	// 全部预约已用完，下一个连接排在 start+600ms
+	l.mu.Lock()
+	next, freed := l.next.Sub(start), len(l.freed)
+	l.mu.Unlock()
+	if freed != 0 || next < 550*time.Millisecond || next > 650*time.Millisecond {
+		t.Fatalf("队尾 = %s，空闲预约 %d 个", next, freed)
+	}
+}
+
+func TestRecordsTransportRedirectAtPerIPCap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Host, "www.") {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, "http://www."+r.Host+"/", http.StatusMovedPermanently)
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+
+	// 每个IP只允许一个连接：空闲连接占着名额时，重定向到同一IP上的 www 会等不到名额
+	config := &types.Config{Network: types.NetworkConfig{
+		Timeout:   time.Second,
+		RateLimit: types.RateLimitConfig{PerIP: 1, PerSubnet: 1000},
+	}}
+	ctx := &types.PipelineContext{Config: config, DNSCache: types.NewDNSCache(0), Context: context.Background()}
+	PinRecords(ctx, "example.com", "127.0.0.1")
+	PinRecords(ctx, "www.example.com", "127.0.0.1")
+
+	client := &http.Client{Transport: NewRecordsTransport(ctx, NewDialer(config)), Timeout: 2 * time.Second}
+	start := time.Now()
+	resp, err := client.Get("http://example.com:" + port + "/")
+	if err != nil {
+		t.Fatalf("跟随重定向失败: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Hostname() != "www.example.com" {
+		t.Fatalf("最终响应 %d %s，期望 200 www.example.com", resp.StatusCode, resp.Request.URL)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("重定向耗时 %s，等待了被空闲连接占用的名额", elapsed)
+	}
+}
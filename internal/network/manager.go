@@ -17,6 +17,8 @@ type ConnectionManager struct {
 	tlsConnections  map[string]*TLSConnectionPool  // TLS连接池
 	mu              sync.RWMutex
 	stats           *types.ConnectionStats
+	retry           *RetryPolicy
+	netDialer       *Dialer
 }
 
 // HTTPConnectionPool HTTP连接池
@@ -43,6 +45,8 @@ func NewConnectionManager(config *types.Config) *ConnectionManager {
 		config:          config,
 		httpConnections: make(map[string]*HTTPConnectionPool),
 		tlsConnections:  make(map[string]*TLSConnectionPool),
+		retry:           NewRetryPolicy(config),
+		netDialer:       NewDialer(config),
 		stats: &types.ConnectionStats{
 			ActiveConnections: 0,
 			TotalConnections:  0,
@@ -84,91 +88,104 @@ func (cm *ConnectionManager) Stop() error {
 	return nil
 }
 
-// GetHTTPConnection 获取HTTP连接
-func (cm *ConnectionManager) GetHTTPConnection(ctx context.Context, domain string) (net.Conn, error) {
-	// 总是创建新的HTTP连接
-	const httpPort = ":80"
-	conn, err := net.DialTimeout("tcp", domain+httpPort, cm.config.Network.Timeout)
-	if err != nil {
-		cm.mu.Lock()
-		cm.stats.FailedConnections++
-		cm.mu.Unlock()
-		return nil, err
+// dialer 拨号器，连接超时取网络配置，同时受调用方context约束，配置了上游代理时经代理连接
+func (cm *ConnectionManager) dialer() *Dialer {
+	return cm.netDialer
+}
+
+// dialAddress 连接地址，ip 为空时按域名连接
+func dialAddress(domain, ip, port string) string {
+	if ip == "" {
+		return net.JoinHostPort(domain, port)
 	}
-	cm.mu.Lock()
-	cm.stats.TotalConnections++
-	cm.stats.ActiveConnections++
-	cm.mu.Unlock()
-	return conn, nil
+	return net.JoinHostPort(ip, port)
 }
 
-// GetTLSConnection 获取TLS连接
-func (cm *ConnectionManager) GetTLSConnection(ctx context.Context, domain string) (*tls.Conn, error) {
-	// 总是创建新的TLS连接，确保ALPN协商正确
-	const tlsPort = ":443"
-	tcpConn, err := net.DialTimeout("tcp", domain+tlsPort, cm.config.Network.Timeout)
+// GetHTTPConnection 获取HTTP连接，ip 为流水线解析得到的地址，为空时按域名连接
+func (cm *ConnectionManager) GetHTTPConnection(ctx context.Context, domain, ip string) (net.Conn, error) {
+	// 总是创建新的HTTP连接，临时错误按重试策略重试
+	address := dialAddress(domain, ip, "80")
+	var conn net.Conn
+	_, err := cm.retry.Do(ctx, func(ctx context.Context) (err error) {
+		conn, err = cm.dialTCP(ctx, address)
+		return err
+	})
+	cm.recordConnection(err)
 	if err != nil {
-		cm.mu.Lock()
-		cm.stats.FailedConnections++
-		cm.mu.Unlock()
 		return nil, err
 	}
+	return conn, nil
+}
 
-	// 创建TLS连接
-	tlsConn := tls.Client(tcpConn, &tls.Config{
+// GetTLSConnection 获取TLS连接，ip 为流水线解析得到的地址，为空时按域名连接
+func (cm *ConnectionManager) GetTLSConnection(ctx context.Context, domain, ip, port string) (*tls.Conn, error) {
+	// 总是创建新的TLS连接，确保ALPN协商正确
+	return cm.getTLSConnection(ctx, domain, ip, port, &tls.Config{
 		ServerName: domain,
 		NextProtos: []string{"h2", "http/1.1"}, // h2优先
 	})
-
-	// 执行TLS握手
-	if err := tlsConn.Handshake(); err != nil {
-		tcpConn.Close()
-		cm.mu.Lock()
-		cm.stats.FailedConnections++
-		cm.mu.Unlock()
-		return nil, err
-	}
-
-	cm.mu.Lock()
-	cm.stats.TotalConnections++
-	cm.stats.ActiveConnections++
-	cm.mu.Unlock()
-	return tlsConn, nil
 }
 
-// GetX25519TLSConnection 获取强制X25519的TLS连接
-func (cm *ConnectionManager) GetX25519TLSConnection(ctx context.Context, domain string) (*tls.Conn, error) {
-	// 创建强制X25519的TLS连接
-	const tlsPort = ":443"
-	tcpConn, err := net.DialTimeout("tcp", domain+tlsPort, cm.config.Network.Timeout)
-	if err != nil {
-		cm.mu.Lock()
-		cm.stats.FailedConnections++
-		cm.mu.Unlock()
-		return nil, err
-	}
-
-	// 创建强制X25519的TLS连接
-	tlsConn := tls.Client(tcpConn, &tls.Config{
+// GetX25519TLSConnection 获取强制X25519的TLS连接，ip 为流水线解析得到的地址，为空时按域名连接
+func (cm *ConnectionManager) GetX25519TLSConnection(ctx context.Context, domain, ip, port string) (*tls.Conn, error) {
+	return cm.getTLSConnection(ctx, domain, ip, port, &tls.Config{
 		ServerName:       domain,
 		NextProtos:       []string{"h2", "http/1.1"},
 		CurvePreferences: []tls.CurveID{tls.X25519}, // 强制X25519
 	})
+}
 
-	// 执行TLS握手
-	if err := tlsConn.Handshake(); err != nil {
-		tcpConn.Close()
-		cm.mu.Lock()
-		cm.stats.FailedConnections++
-		cm.mu.Unlock()
+// getTLSConnection 建立TCP连接并完成TLS握手，临时错误按重试策略重试
+// 每次尝试的连接和握手共用网络超时，接受连接但不响应握手的服务器超时后重试，不会占满整个检测时限
+func (cm *ConnectionManager) getTLSConnection(ctx context.Context, domain, ip, port string, config *tls.Config) (*tls.Conn, error) {
+	address := dialAddress(domain, ip, port)
+	var tlsConn *tls.Conn
+	_, err := cm.retry.Do(ctx, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, cm.dialer().timeout)
+		defer cancel()
+
+		tcpConn, err := cm.dialTCP(ctx, address)
+		if err != nil {
+			return err
+		}
+
+		// 执行TLS握手
+		conn := tls.Client(tcpConn, config.Clone())
+		done := types.StartOperation(ctx, types.OperationTLS, domain+" @"+address)
+		err = conn.HandshakeContext(ctx)
+		done(err)
+		if err != nil {
+			tcpConn.Close()
+			return err
+		}
+		tlsConn = conn
+		return nil
+	})
+	cm.recordConnection(err)
+	if err != nil {
 		return nil, err
 	}
+	return tlsConn, nil
+}
 
+// dialTCP 建立一次TCP连接并记录耗时
+func (cm *ConnectionManager) dialTCP(ctx context.Context, address string) (net.Conn, error) {
+	done := types.StartOperation(ctx, types.OperationTCP, address)
+	conn, err := cm.dialer().DialContext(ctx, "tcp", address)
+	done(err)
+	return conn, err
+}
+
+// recordConnection 更新连接统计，重试后最终失败只计一次
+func (cm *ConnectionManager) recordConnection(err error) {
 	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if err != nil {
+		cm.stats.FailedConnections++
+		return
+	}
 	cm.stats.TotalConnections++
 	cm.stats.ActiveConnections++
-	cm.mu.Unlock()
-	return tlsConn, nil
 }
 
 // CloseConnection 关闭连接
@@ -0,0 +1,76 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// startStalledServer 启动一个接受连接但从不响应TLS握手的服务器，返回端口和已接受的连接数
+func startStalledServer(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	var accepted atomic.Int32
+	addr := startProxy(t, func(conn net.Conn) {
+		accepted.Add(1)
+		io.Copy(io.Discard, conn)
+	})
+	_, port, _ := net.SplitHostPort(addr)
+	return port, &accepted
+}
+
+func TestTLSConnectionAttemptTimeoutIsRetried(t *testing.T) {
+	port, accepted := startStalledServer(t)
+	cm := NewConnectionManager(&types.Config{Network: types.NetworkConfig{Timeout: 100 * time.Millisecond, Retries: 1}})
+
+	start := time.Now()
+	_, err := cm.GetTLSConnection(context.Background(), "example.com", "127.0.0.1", port)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("错误 = %v，期望 context.DeadlineExceeded", err)
+	}
+	if got := accepted.Load(); got != 2 {
+		t.Fatalf("尝试次数 = %d，期望 2", got)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("两次尝试耗时 %s，单次尝试没有受网络超时约束", elapsed)
+	}
+}
+
+func TestTLSConnectionParentDeadlineIsNotRetried(t *testing.T) {
+	port, accepted := startStalledServer(t)
+	cm := NewConnectionManager(&types.Config{Network: types.NetworkConfig{Timeout: 5 * time.Second, Retries: 2}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := cm.GetTLSConnection(ctx, "example.com", "127.0.0.1", port)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("错误 = %v，期望 context.DeadlineExceeded", err)
+	}
+	if got := accepted.Load(); got != 1 {
+		t.Fatalf("尝试次数 = %d，上层context超时后不应重试", got)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"单次尝试超时", context.DeadlineExceeded, true},
+		{"取消", context.Canceled, false},
+		{"连接中断", io.ErrUnexpectedEOF, true},
+		{"域名不存在", &net.DNSError{IsNotFound: true}, false},
+		{"其他错误", errors.New("其他错误"), false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryable = %v，期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// 上游代理协议
+const (
+	proxySOCKS5  = "socks5"  // SOCKS5，目标地址原样发送给代理
+	proxySOCKS5H = "socks5h" // 同 socks5，兼容常见写法
+	proxyHTTP    = "http"    // HTTP CONNECT
+)
+
+// Dialer 所有探测共用的拨号器，配置了上游代理时经代理建立TCP连接，配置了源地址时绑定本地地址，
+// 配置了连接限速时等待名额；代理只转发TCP，UDP拨号在配置代理时返回错误
+type Dialer struct {
+	proxy     *url.URL
+	proxyErr  error
+	source    *sourceAddrs
+	sourceErr error
+	limiter   *Limiter
+	timeout   time.Duration
+}
+
+// NewDialer 根据网络配置创建拨号器，连接超时取网络配置
+// 代理配置无效时拨号返回错误，不会绕过代理直接连接
+func NewDialer(config *types.Config) *Dialer {
+	dialer := &Dialer{timeout: 30 * time.Second}
+	if config == nil {
+		return dialer
+	}
+	if config.Network.Timeout > 0 {
+		dialer.timeout = config.Network.Timeout
+	}
+	dialer.proxy, dialer.proxyErr = parseProxy(config.Network.Proxy)
+	dialer.source, dialer.sourceErr = parseSource(config.Network)
+	dialer.limiter = sharedLimiter(config.Network.RateLimit)
+	return dialer
+}
+
+// Timeout 拨号器的连接超时
+func (d *Dialer) Timeout() time.Duration {
+	return d.timeout
+}
+
+// WithTimeout 返回使用指定连接超时的拨号器副本
+func (d *Dialer) WithTimeout(timeout time.Duration) *Dialer {
+	copied := *d
+	copied.timeout = timeout
+	return &copied
+}
+
+// WithoutLimit 返回不受连接限速的拨号器副本，用于DNS查询
+func (d *Dialer) WithoutLimit() *Dialer {
+	copied := *d
+	copied.limiter = nil
+	return &copied
+}
+
+// Proxied 是否经上游代理连接
+func (d *Dialer) Proxied() bool {
+	return d.proxy != nil || d.proxyErr != nil
+}
+
+// ValidateProxy 校验代理配置，为空表示不使用代理
+func ValidateProxy(spec string) error {
+	_, err := parseProxy(spec)
+	return err
+}
+
+// parseProxy 解析代理地址，支持 socks5://[user:pass@]host:port 和 http://[user:pass@]host:port
+func parseProxy(spec string) (*url.URL, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("代理地址无效 %s: %v", spec, err)
+	}
+	switch u.Scheme {
+	case proxySOCKS5, proxySOCKS5H, proxyHTTP:
+	default:
+		return nil, fmt.Errorf("不支持的代理协议 %s（可用: socks5, http）", u.Scheme)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return nil, fmt.Errorf("代理地址缺少主机或端口: %s", spec)
+	}
+	return u, nil
+}
+
+// DialContext 建立连接，配置了代理时经代理连接目标地址
+// 源地址或代理配置无效时返回错误，不会改用默认出口连接；配置了限速时先等待连接名额，连接关闭时释放
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.limiter == nil {
+		return d.dial(ctx, network, address)
+	}
+	release, err := d.limiter.Acquire(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.dial(ctx, network, address)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &limitedConn{Conn: conn, release: release}, nil
+}
+
+// dial 建立连接，不经过限速
+func (d *Dialer) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.sourceErr != nil {
+		return nil, d.sourceErr
+	}
+	if d.proxyErr != nil {
+		return nil, d.proxyErr
+	}
+
+	// 经代理时绑定的是连接代理的本地地址
+	firstHop := address
+	if d.proxy != nil {
+		firstHop = d.proxy.Host
+	}
+	localAddr, err := d.source.localAddr(network, firstHop)
+	if err != nil {
+		return nil, err
+	}
+	direct := &net.Dialer{Timeout: d.timeout}
+	if localAddr != nil {
+		direct.LocalAddr = localAddr
+	}
+
+	if d.proxy == nil {
+		return direct.DialContext(ctx, network, address)
+	}
+	if !strings.HasPrefix(network, "tcp") {
+		return nil, fmt.Errorf("代理不支持 %s 连接", network)
+	}
+
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+
+	conn, err := direct.DialContext(ctx, "tcp", d.proxy.Host)
+	if err != nil {
+		return nil, fmt.Errorf("连接代理失败: %w", err)
+	}
+
+	// 握手期间受context约束，context结束时才中断读写，保证返回的错误包含context的错误
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+
+	// 握手失败时关闭的是连接代理的原始连接
+	tunnel := conn
+	if d.proxy.Scheme == proxyHTTP {
+		tunnel, err = d.connectHTTP(conn, address)
+	} else {
+		err = d.connectSOCKS5(conn, address)
+	}
+
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("代理握手中断: %w", ctxErr)
+		}
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// connectHTTP 通过HTTP CONNECT建立隧道
+func (d *Dialer) connectHTTP(conn net.Conn, address string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user := d.proxy.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("发送CONNECT请求失败: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("读取代理响应失败: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("代理拒绝连接 %s: %s", address, resp.Status)
+	}
+
+	// 代理可能在响应后立即发送了目标的数据
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn 先读出缓冲区中剩余数据的连接
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read 读取数据
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// SOCKS5 协议常量（RFC 1928、RFC 1929）
+const (
+	socks5Version      = 0x05
+	socks5AuthNone     = 0x00
+	socks5AuthPassword = 0x02
+	socks5CmdConnect   = 0x01
+	socks5AddrIPv4     = 0x01
+	socks5AddrDomain   = 0x03
+	socks5AddrIPv6     = 0x04
+)
+
+// socks5Replies SOCKS5 错误回复说明
+var socks5Replies = map[byte]string{
+	0x01: "代理服务器故障",
+	0x02: "规则不允许连接",
+	0x03: "网络不可达",
+	0x04: "主机不可达",
+	0x05: "连接被拒绝",
+	0x06: "TTL过期",
+	0x07: "不支持的命令",
+	0x08: "不支持的地址类型",
+}
+
+// connectSOCKS5 通过SOCKS5 CONNECT建立隧道
+func (d *Dialer) connectSOCKS5(conn net.Conn, address string) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("端口无效: %s", portStr)
+	}
+
+	// 协商认证方式
+	methods := []byte{socks5AuthNone}
+	if d.proxy.User != nil {
+		methods = append(methods, socks5AuthPassword)
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return fmt.Errorf("SOCKS5握手失败: %w", err)
+	}
+	var choice [2]byte
+	if _, err := io.ReadFull(conn, choice[:]); err != nil {
+		return fmt.Errorf("SOCKS5握手失败: %w", err)
+	}
+	if choice[0] != socks5Version {
+		return fmt.Errorf("SOCKS5握手失败: 代理版本 %d", choice[0])
+	}
+	switch choice[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if err := d.authSOCKS5(conn); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("SOCKS5握手失败: 代理不接受可用的认证方式")
+	}
+
+	// 发送CONNECT请求
+	request := []byte{socks5Version, socks5CmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			request = append(append(request, socks5AddrIPv4), ip4...)
+		} else {
+			request = append(append(request, socks5AddrIPv6), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("域名过长: %s", host)
+		}
+		request = append(append(request, socks5AddrDomain, byte(len(host))), host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("SOCKS5请求失败: %w", err)
+	}
+
+	// 读取回复，跳过绑定地址
+	var reply [4]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return fmt.Errorf("SOCKS5请求失败: %w", err)
+	}
+	if reply[1] != 0x00 {
+		reason, ok := socks5Replies[reply[1]]
+		if !ok {
+			reason = fmt.Sprintf("错误码 %d", reply[1])
+		}
+		return fmt.Errorf("代理拒绝连接 %s: %s", address, reason)
+	}
+	var skip int
+	switch reply[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len
+	case socks5AddrIPv6:
+		skip = net.IPv6len
+	case socks5AddrDomain:
+		var length [1]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return fmt.Errorf("SOCKS5请求失败: %w", err)
+		}
+		skip = int(length[0])
+	default:
+		return fmt.Errorf("SOCKS5请求失败: 未知地址类型 %d", reply[3])
+	}
+	if _, err := io.CopyN(io.Discard, conn, int64(skip+2)); err != nil {
+		return fmt.Errorf("SOCKS5请求失败: %w", err)
+	}
+	return nil
+}
+
+// authSOCKS5 用户名密码认证
+func (d *Dialer) authSOCKS5(conn net.Conn) error {
+	username := d.proxy.User.Username()
+	password, _ := d.proxy.User.Password()
+	if len(username) > 255 || len(password) > 255 {
+		return fmt.Errorf("SOCKS5认证失败: 用户名或密码过长")
+	}
+	request := []byte{0x01, byte(len(username))}
+	request = append(request, username...)
+	request = append(request, byte(len(password)))
+	request = append(request, password...)
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("SOCKS5认证失败: %w", err)
+	}
+	var status [2]byte
+	if _, err := io.ReadFull(conn, status[:]); err != nil {
+		return fmt.Errorf("SOCKS5认证失败: %w", err)
+	}
+	if status[1] != 0x00 {
+		return fmt.Errorf("SOCKS5认证失败: 用户名或密码错误")
+	}
+	return nil
+}
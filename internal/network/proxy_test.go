@@ -0,0 +1,348 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// tunnelGreeting 代理建立隧道后立即发送的数据，模拟目标服务器先发言
+const tunnelGreeting = "hello"
+
+// startProxy 在本机启动一个代理替身，每个连接交给 handle 处理
+func startProxy(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// socks5Proxy SOCKS5 代理替身，username 非空时要求用户名密码认证
+type socks5Proxy struct {
+	username string
+	password string
+	reply    byte
+	targets  chan string // 收到的 CONNECT 目标
+}
+
+func (p *socks5Proxy) handle(conn net.Conn) {
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+
+	method := byte(socks5AuthNone)
+	if p.username != "" {
+		method = 0xff
+		for _, m := range methods {
+			if m == socks5AuthPassword {
+				method = socks5AuthPassword
+			}
+		}
+	}
+	conn.Write([]byte{socks5Version, method})
+	switch method {
+	case 0xff:
+		return
+	case socks5AuthPassword:
+		if !p.authenticate(conn) {
+			conn.Write([]byte{0x01, 0x01})
+			return
+		}
+		conn.Write([]byte{0x01, 0x00})
+	}
+
+	var request [4]byte
+	if _, err := io.ReadFull(conn, request[:]); err != nil {
+		return
+	}
+	var host string
+	switch request[3] {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if request[3] == socks5AddrIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return
+		}
+		host = ip.String()
+	case socks5AddrDomain:
+		var length [1]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return
+		}
+		host = string(name)
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return
+	}
+	p.targets <- net.JoinHostPort(host, fmt.Sprint(binary.BigEndian.Uint16(port[:])))
+
+	// 回复与隧道数据一次写出，检验客户端不会多读
+	response := []byte{socks5Version, p.reply, 0x00, socks5AddrDomain, 9}
+	response = append(response, "localhost"...)
+	response = append(response, 0x01, 0xbb)
+	if p.reply == 0x00 {
+		response = append(response, tunnelGreeting...)
+	}
+	conn.Write(response)
+	io.Copy(io.Discard, conn)
+}
+
+func (p *socks5Proxy) authenticate(conn net.Conn) bool {
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil || header[0] != 0x01 {
+		return false
+	}
+	username := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, username); err != nil {
+		return false
+	}
+	var length [1]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return false
+	}
+	password := make([]byte, length[0])
+	if _, err := io.ReadFull(conn, password); err != nil {
+		return false
+	}
+	return string(username) == p.username && string(password) == p.password
+}
+
+// httpProxy HTTP CONNECT 代理替身，status 非200时拒绝连接
+type httpProxy struct {
+	status  int
+	auth    chan string // 收到的 Proxy-Authorization
+	targets chan string // 收到的 CONNECT 目标
+}
+
+func (p *httpProxy) handle(conn net.Conn) {
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		return
+	}
+	p.auth <- req.Header.Get("Proxy-Authorization")
+	p.targets <- req.Host
+
+	response := fmt.Sprintf("HTTP/1.1 %d %s\r\n\r\n", p.status, http.StatusText(p.status))
+	if p.status == http.StatusOK {
+		response += tunnelGreeting
+	}
+	conn.Write([]byte(response))
+	io.Copy(io.Discard, conn)
+}
+
+// newProxyDialer 创建经指定代理连接的拨号器
+func newProxyDialer(proxy string) *Dialer {
+	return NewDialer(&types.Config{Network: types.NetworkConfig{Proxy: proxy, Timeout: 5 * time.Second}})
+}
+
+// readGreeting 读取隧道中代理替身发送的数据
+func readGreeting(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, len(tunnelGreeting))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("读取隧道数据失败: %v", err)
+	}
+	if string(buf) != tunnelGreeting {
+		t.Fatalf("隧道数据 = %q，期望 %q", buf, tunnelGreeting)
+	}
+}
+
+// receive 读取代理替身记录的值
+func receive(t *testing.T, ch chan string) string {
+	t.Helper()
+	select {
+	case value := <-ch:
+		return value
+	case <-time.After(2 * time.Second):
+		t.Fatal("代理替身未收到请求")
+		return ""
+	}
+}
+
+func TestSOCKS5ProxyConnect(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{"域名", "example.com:443"},
+		{"IPv4", "192.0.2.1:443"},
+		{"IPv6", "[2001:db8::1]:8443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy := &socks5Proxy{targets: make(chan string, 1)}
+			addr := startProxy(t, proxy.handle)
+
+			conn, err := newProxyDialer("socks5://"+addr).DialContext(context.Background(), "tcp", tt.target)
+			if err != nil {
+				t.Fatalf("DialContext: %v", err)
+			}
+			defer conn.Close()
+
+			if got := receive(t, proxy.targets); got != tt.target {
+				t.Errorf("代理收到的目标 = %s，期望 %s", got, tt.target)
+			}
+			readGreeting(t, conn)
+		})
+	}
+}
+
+func TestSOCKS5ProxyPasswordAuth(t *testing.T) {
+	proxy := &socks5Proxy{username: "user", password: "secret", targets: make(chan string, 1)}
+	addr := startProxy(t, proxy.handle)
+
+	conn, err := newProxyDialer("socks5h://user:secret@"+addr).DialContext(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatalf("DialContext: %v", err)
+	}
+	defer conn.Close()
+	receive(t, proxy.targets)
+	readGreeting(t, conn)
+}
+
+func TestSOCKS5ProxyAuthRejected(t *testing.T) {
+	proxy := &socks5Proxy{username: "user", password: "secret", targets: make(chan string, 1)}
+	addr := startProxy(t, proxy.handle)
+
+	_, err := newProxyDialer("socks5://user:wrong@"+addr).DialContext(context.Background(), "tcp", "example.com:443")
+	if err == nil || !strings.Contains(err.Error(), "用户名或密码错误") {
+		t.Fatalf("错误 = %v，期望认证失败", err)
+	}
+
+	// 未提供用户名时代理没有可接受的认证方式
+	_, err = newProxyDialer("socks5://"+addr).DialContext(context.Background(), "tcp", "example.com:443")
+	if err == nil || !strings.Contains(err.Error(), "认证方式") {
+		t.Fatalf("错误 = %v，期望认证方式不可用", err)
+	}
+}
+
+func TestSOCKS5ProxyReplyError(t *testing.T) {
+	tests := []struct {
+		reply byte
+		want  string
+	}{
+		{0x05, "连接被拒绝"},
+		{0x04, "主机不可达"},
+		{0x09, "错误码 9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			proxy := &socks5Proxy{reply: tt.reply, targets: make(chan string, 1)}
+			addr := startProxy(t, proxy.handle)
+
+			_, err := newProxyDialer("socks5://"+addr).DialContext(context.Background(), "tcp", "example.com:443")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("错误 = %v，期望包含 %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPProxyConnect(t *testing.T) {
+	proxy := &httpProxy{status: http.StatusOK, auth: make(chan string, 1), targets: make(chan string, 1)}
+	addr := startProxy(t, proxy.handle)
+
+	conn, err := newProxyDialer("http://user:secret@"+addr).DialContext(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatalf("DialContext: %v", err)
+	}
+	defer conn.Close()
+
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	if got := receive(t, proxy.auth); got != want {
+		t.Errorf("Proxy-Authorization = %q，期望 %q", got, want)
+	}
+	if got := receive(t, proxy.targets); got != "example.com:443" {
+		t.Errorf("代理收到的目标 = %s", got)
+	}
+
+	// 响应后紧跟的数据已被读入缓冲区，必须经 bufferedConn 读出
+	if _, ok := conn.(*bufferedConn); !ok {
+		t.Fatalf("连接类型 = %T，期望 *bufferedConn", conn)
+	}
+	readGreeting(t, conn)
+}
+
+func TestHTTPProxyRejected(t *testing.T) {
+	proxy := &httpProxy{status: http.StatusProxyAuthRequired, auth: make(chan string, 1), targets: make(chan string, 1)}
+	addr := startProxy(t, proxy.handle)
+
+	_, err := newProxyDialer("http://"+addr).DialContext(context.Background(), "tcp", "example.com:443")
+	if err == nil || !strings.Contains(err.Error(), "407") {
+		t.Fatalf("错误 = %v，期望代理拒绝连接", err)
+	}
+	if got := receive(t, proxy.auth); got != "" {
+		t.Errorf("未配置认证时发送了 Proxy-Authorization: %q", got)
+	}
+}
+
+func TestProxyHandshakeCanceled(t *testing.T) {
+	// 代理接受连接后不回复，握手只能由context结束
+	addr := startProxy(t, func(conn net.Conn) { io.Copy(io.Discard, conn) })
+
+	for _, scheme := range []string{"socks5", "http"} {
+		t.Run(scheme, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			start := time.Now()
+			_, err := newProxyDialer(scheme+"://"+addr).DialContext(ctx, "tcp", "example.com:443")
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("错误 = %v，期望 context.Canceled", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Fatalf("取消后 %s 才返回", elapsed)
+			}
+		})
+	}
+}
+
+func TestProxyHandshakeTimeout(t *testing.T) {
+	addr := startProxy(t, func(conn net.Conn) { io.Copy(io.Discard, conn) })
+
+	dialer := newProxyDialer("socks5://" + addr).WithTimeout(50 * time.Millisecond)
+	_, err := dialer.DialContext(context.Background(), "tcp", "example.com:443")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("错误 = %v，期望 context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,186 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"RealityChecker/internal/types"
+)
+
+// cnameChainResolver 能返回完整CNAME链的解析器
+type cnameChainResolver interface {
+	LookupCNAMEChain(ctx context.Context, host string) ([]string, error)
+}
+
+// LookupRecords 返回域名的DNS记录集（A、AAAA、CNAME链、NS），按 version 选定连接地址
+// 同一缓存中每个域名只解析一次，cache 为 nil 时直接解析；地址解析失败时返回条目中的错误
+func LookupRecords(ctx context.Context, resolver types.Resolver, cache *types.DNSCache, host, version string) (*types.DNSEntry, error) {
+	if cache == nil {
+		entry := resolveRecords(ctx, resolver, host, version)
+		return entry, entry.Err
+	}
+	entry := cache.Resolve(host, func() *types.DNSEntry {
+		return resolveRecords(ctx, resolver, host, version)
+	})
+	return entry, entry.Err
+}
+
+// PipelineRecords 使用流水线共享的解析器和记录集查询域名
+func PipelineRecords(ctx *types.PipelineContext, host string) (*types.DNSEntry, error) {
+	return LookupRecords(ctx.Context, ctx.DNS(), ctx.DNSCache, host, ctx.IPVersion())
+}
+
+// PinRecords 将域名的记录集固定为指定地址
+// 用于 IP@域名 形式的目标：之后各阶段和HTTP请求都连接该地址，域名只用作SNI和Host
+func PinRecords(ctx *types.PipelineContext, host, ip string) {
+	ctx.DNSCache.Resolve(host, func() *types.DNSEntry {
+		return resolveRecords(ctx.Context, ctx.DNS(), ip, ctx.IPVersion())
+	})
+}
+
+// ValidateIPVersion 校验地址族选项
+func ValidateIPVersion(version string) error {
+	switch version {
+	case types.IPVersionAuto, types.IPVersion4, types.IPVersion6, types.IPVersionBoth:
+		return nil
+	}
+	return fmt.Errorf("不支持的地址族: %s（可用: 4、6、both）", version)
+}
+
+// IPVersion 返回地址的地址族，4或6，无法解析时返回0
+func IPVersion(ip string) int {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return 0
+	case parsed.To4() != nil:
+		return 4
+	default:
+		return 6
+	}
+}
+
+// resolveRecords 并发查询地址、CNAME链和NS记录
+func resolveRecords(ctx context.Context, resolver types.Resolver, host, version string) *types.DNSEntry {
+	entry := &types.DNSEntry{}
+
+	// IP地址无需解析
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil {
+			entry.A = []string{ip.String()}
+		} else {
+			entry.AAAA = []string{ip.String()}
+		}
+		selectIP(entry, version)
+		return entry
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// CNAME和NS只作为辅助信息，查询失败不影响条目
+	go func() {
+		defer wg.Done()
+		if chainResolver, ok := resolver.(cnameChainResolver); ok {
+			entry.CNAMEChain, _ = chainResolver.LookupCNAMEChain(ctx, host)
+			return
+		}
+		cname, err := resolver.LookupCNAME(ctx, host)
+		name, canonical := strings.ToLower(strings.TrimSuffix(host, ".")), strings.ToLower(strings.TrimSuffix(cname, "."))
+		if err == nil && canonical != "" && name != canonical {
+			entry.CNAMEChain = []string{name, canonical}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		records, err := resolver.LookupNS(ctx, host)
+		if err != nil {
+			return
+		}
+		for _, ns := range records {
+			entry.NS = append(entry.NS, ns.Host)
+		}
+	}()
+
+	ips, err := resolver.LookupIP(ctx, "ip", host)
+	wg.Wait()
+
+	if err != nil {
+		entry.Err = err
+		return entry
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			entry.A = append(entry.A, ip.String())
+		} else {
+			entry.AAAA = append(entry.AAAA, ip.String())
+		}
+	}
+
+	selectIP(entry, version)
+	return entry
+}
+
+// selectIP 按地址族选项选定连接地址，默认优先IPv4；双栈模式以IPv4完成主要检测，
+// 只有IPv6地址时以IPv6完成，IPv4的结论为没有地址
+func selectIP(entry *types.DNSEntry, version string) {
+	switch version {
+	case types.IPVersion4:
+		if len(entry.A) == 0 {
+			entry.Err = fmt.Errorf("未找到IPv4地址")
+			return
+		}
+		entry.IP = entry.A[0]
+	case types.IPVersion6:
+		if len(entry.AAAA) == 0 {
+			entry.Err = fmt.Errorf("未找到IPv6地址")
+			return
+		}
+		entry.IP = entry.AAAA[0]
+	default: // IPVersionAuto、IPVersionBoth
+		switch {
+		case len(entry.A) > 0:
+			entry.IP = entry.A[0]
+		case len(entry.AAAA) > 0:
+			entry.IP = entry.AAAA[0]
+		default:
+			entry.Err = fmt.Errorf("未找到IP地址")
+		}
+	}
+}
+
+// NewRecordsTransport 创建按记录集拨号的HTTP传输，上游代理由拨号器处理
+// 不保留空闲连接：限速名额在连接关闭时才释放，空闲连接占着名额，重定向到同一IP上的其他域名时会等不到名额
+func NewRecordsTransport(ctx *types.PipelineContext, dialer *Dialer) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = DialRecords(ctx, dialer)
+	transport.DisableKeepAlives = true
+	return transport
+}
+
+// DialRecords 返回按记录集拨号的函数，域名替换为记录集中选定的地址
+// 用于HTTP客户端，使重定向跟踪与其他阶段连接同一地址；连接的临时错误按重试策略重试
+func DialRecords(ctx *types.PipelineContext, dialer *Dialer) func(context.Context, string, string) (net.Conn, error) {
+	retry := NewRetryPolicy(ctx.Config)
+	return func(dialCtx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := LookupRecords(dialCtx, ctx.DNS(), ctx.DNSCache, host, ctx.IPVersion())
+		if err != nil {
+			return nil, err
+		}
+		var conn net.Conn
+		_, err = retry.Do(dialCtx, func(dialCtx context.Context) (err error) {
+			conn, err = dialer.DialContext(dialCtx, network, net.JoinHostPort(entry.IP, port))
+			return err
+		})
+		return conn, err
+	}
+}
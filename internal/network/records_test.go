@@ -0,0 +1,56 @@
+package network
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"RealityChecker/internal/types"
+)
+
+// staticResolver 返回固定地址的解析器
+type staticResolver []net.IP
+
+func (r staticResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	return r, nil
+}
+
+func (r staticResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return host + ".", nil
+}
+
+func (r staticResolver) LookupNS(ctx context.Context, host string) ([]*net.NS, error) {
+	return nil, nil
+}
+
+func TestLookupRecordsSelectsByIPVersion(t *testing.T) {
+	dualStack := staticResolver{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")}
+	ipv6Only := staticResolver{net.ParseIP("2001:db8::1")}
+
+	tests := []struct {
+		name     string
+		resolver staticResolver
+		version  string
+		wantIP   string
+		wantErr  bool
+	}{
+		{"默认优先IPv4", dualStack, types.IPVersionAuto, "192.0.2.1", false},
+		{"默认只有IPv6", ipv6Only, types.IPVersionAuto, "2001:db8::1", false},
+		{"只用IPv4", dualStack, types.IPVersion4, "192.0.2.1", false},
+		{"只用IPv4但没有IPv4", ipv6Only, types.IPVersion4, "", true},
+		{"只用IPv6", dualStack, types.IPVersion6, "2001:db8::1", false},
+		{"双栈以IPv4为主", dualStack, types.IPVersionBoth, "192.0.2.1", false},
+		{"双栈只有IPv6", ipv6Only, types.IPVersionBoth, "2001:db8::1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := LookupRecords(context.Background(), tt.resolver, nil, "example.com", tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误 = %v，期望出错 %v", err, tt.wantErr)
+			}
+			if err == nil && entry.IP != tt.wantIP {
+				t.Fatalf("选定地址 = %s，期望 %s", entry.IP, tt.wantIP)
+			}
+		})
+	}
+}
@@ -0,0 +1,377 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// DNS服务器协议
+const (
+	dnsProtocolSystem = "system" // 系统解析器
+	dnsProtocolUDP    = "udp"    // 普通DNS（UDP，响应截断时由解析器自动改用TCP）
+	dnsProtocolTCP    = "tcp"    // 普通DNS（仅TCP）
+	dnsProtocolTLS    = "tls"    // DNS-over-TLS
+	dnsProtocolHTTPS  = "https"  // DNS-over-HTTPS
+)
+
+// 各协议的默认端口
+var dnsDefaultPorts = map[string]string{
+	dnsProtocolUDP: "53",
+	dnsProtocolTCP: "53",
+	dnsProtocolTLS: "853",
+}
+
+// dnsServer 一个上游DNS服务器
+type dnsServer struct {
+	protocol string
+	address  string // host:port，DoH为完整URL
+	host     string // DoT证书校验使用的主机名
+	resolver *net.Resolver
+}
+
+// String 服务器描述，用于记录网络操作
+func (s *dnsServer) String() string {
+	switch s.protocol {
+	case dnsProtocolSystem:
+		return dnsProtocolSystem
+	case dnsProtocolHTTPS:
+		return s.address
+	default:
+		return s.protocol + "://" + s.address
+	}
+}
+
+// Resolver 使用配置的上游服务器进行DNS解析
+// 支持 UDP/TCP、DNS-over-TLS 和 DNS-over-HTTPS，按顺序尝试服务器，
+// 服务器明确返回域名不存在时不再尝试后续服务器
+type Resolver struct {
+	servers []*dnsServer
+	timeout time.Duration
+	retry   *RetryPolicy
+	dialer  *Dialer
+	doh     *http.Client // DoH查询使用的HTTP客户端，经同一个拨号器连接
+}
+
+// NewResolver 根据网络配置创建解析器，未配置服务器时使用系统解析器
+//
+// 服务器格式：
+//
+//	8.8.8.8 / udp://8.8.8.8:53    普通DNS
+//	tcp://8.8.8.8                 仅TCP
+//	tls://1.1.1.1 / tls://dns.google:853   DNS-over-TLS
+//	https://1.1.1.1/dns-query     DNS-over-HTTPS
+//	system                        系统解析器
+func NewResolver(config *types.Config) (*Resolver, error) {
+	resolver := &Resolver{timeout: 5 * time.Second, retry: NewRetryPolicy(config)}
+
+	var servers []string
+	if config != nil {
+		servers = config.Network.DNSServers
+		if config.Network.Timeout > 0 {
+			resolver.timeout = config.Network.Timeout
+		}
+		if err := ValidateProxy(config.Network.Proxy); err != nil {
+			return nil, err
+		}
+	}
+	resolver.dialer = NewDialer(config).WithTimeout(resolver.timeout).WithoutLimit()
+	resolver.doh = newDoHClient(resolver.dialer)
+	if len(servers) == 0 {
+		servers = []string{dnsProtocolSystem}
+	}
+
+	for _, spec := range servers {
+		server, err := parseDNSServer(spec)
+		if err != nil {
+			return nil, err
+		}
+		server.resolver = resolver.newNetResolver(server)
+		resolver.servers = append(resolver.servers, server)
+	}
+
+	return resolver, nil
+}
+
+// ValidateDNSServers 校验DNS服务器配置
+func ValidateDNSServers(servers []string) error {
+	for _, spec := range servers {
+		if _, err := parseDNSServer(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseDNSServer 解析服务器配置
+func parseDNSServer(spec string) (*dnsServer, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("DNS服务器地址为空")
+	}
+	if spec == dnsProtocolSystem {
+		return &dnsServer{protocol: dnsProtocolSystem}, nil
+	}
+
+	// 不带协议的地址视为普通DNS
+	if !strings.Contains(spec, "://") {
+		spec = dnsProtocolUDP + "://" + spec
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("DNS服务器地址无效 %s: %v", spec, err)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("DNS服务器地址缺少主机: %s", spec)
+	}
+
+	switch u.Scheme {
+	case dnsProtocolHTTPS:
+		if u.Path == "" {
+			u.Path = "/dns-query"
+		}
+		return &dnsServer{protocol: dnsProtocolHTTPS, address: u.String(), host: u.Hostname()}, nil
+	case dnsProtocolUDP, dnsProtocolTCP, dnsProtocolTLS:
+		port := u.Port()
+		if port == "" {
+			port = dnsDefaultPorts[u.Scheme]
+		}
+		return &dnsServer{
+			protocol: u.Scheme,
+			address:  net.JoinHostPort(u.Hostname(), port),
+			host:     u.Hostname(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("不支持的DNS协议 %s（可用: udp, tcp, tls, https, system）", u.Scheme)
+	}
+}
+
+// newNetResolver 创建连接到指定服务器的Go解析器
+// Go解析器收到非PacketConn的连接时使用TCP报文格式，DoT和DoH借此复用标准库的报文编解码
+func (r *Resolver) newNetResolver(server *dnsServer) *net.Resolver {
+	if server.protocol == dnsProtocolSystem {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return r.dialServer(ctx, server, network)
+		},
+	}
+}
+
+// dialServer 建立到服务器的连接，network 为 udp 时普通DNS使用UDP，其余情况均为TCP报文格式
+// 配置了上游代理时所有查询都经代理以TCP发送
+func (r *Resolver) dialServer(ctx context.Context, server *dnsServer, network string) (net.Conn, error) {
+	switch server.protocol {
+	case dnsProtocolUDP:
+		// 解析器在响应截断时会以tcp重新拨号；代理只转发TCP
+		if r.dialer.Proxied() {
+			network = "tcp"
+		}
+		return r.dialer.DialContext(ctx, network, server.address)
+	case dnsProtocolTCP:
+		return r.dialer.DialContext(ctx, "tcp", server.address)
+	case dnsProtocolTLS:
+		conn, err := r.dialer.DialContext(ctx, "tcp", server.address)
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: server.host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	default:
+		return newDoHConn(ctx, r.doh, server.address, r.timeout), nil
+	}
+}
+
+// LookupIP 解析域名的IP地址，network 为 ip、ip4 或 ip6
+func (r *Resolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	var ips []net.IP
+	err := r.lookup(ctx, host, func(ctx context.Context, server *dnsServer) (err error) {
+		ips, err = server.resolver.LookupIP(ctx, network, host)
+		return err
+	})
+	return ips, err
+}
+
+// LookupCNAME 查询域名的规范名称
+func (r *Resolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	var cname string
+	err := r.lookup(ctx, host, func(ctx context.Context, server *dnsServer) (err error) {
+		cname, err = server.resolver.LookupCNAME(ctx, host)
+		return err
+	})
+	return cname, err
+}
+
+// LookupNS 查询域名的NS记录
+func (r *Resolver) LookupNS(ctx context.Context, host string) ([]*net.NS, error) {
+	var records []*net.NS
+	err := r.lookup(ctx, host, func(ctx context.Context, server *dnsServer) (err error) {
+		records, err = server.resolver.LookupNS(ctx, host)
+		return err
+	})
+	return records, err
+}
+
+// LookupCNAMEChain 查询域名完整的CNAME链，从查询的域名开始到规范名称结束，没有CNAME时返回空
+// Go解析器只返回最终的规范名称，因此直接发送查询并读取应答中的全部CNAME记录；
+// 系统解析器无法获取中间记录，链中只包含查询的域名和规范名称
+func (r *Resolver) LookupCNAMEChain(ctx context.Context, host string) ([]string, error) {
+	var chain []string
+	err := r.lookup(ctx, host, func(ctx context.Context, server *dnsServer) error {
+		if server.protocol == dnsProtocolSystem {
+			cname, err := server.resolver.LookupCNAME(ctx, host)
+			if err != nil {
+				return err
+			}
+			chain = nil
+			if name, canonical := strings.TrimSuffix(host, "."), strings.TrimSuffix(cname, "."); !strings.EqualFold(name, canonical) {
+				chain = []string{strings.ToLower(name), strings.ToLower(canonical)}
+			}
+			return nil
+		}
+
+		response, err := r.exchange(ctx, server, host, dnsTypeA)
+		if err != nil {
+			return err
+		}
+		chain = cnameChain(host, response.cnames)
+		return nil
+	})
+	return chain, err
+}
+
+// exchange 向服务器发送一次查询，UDP响应被截断时改用TCP
+func (r *Resolver) exchange(ctx context.Context, server *dnsServer, host string, qtype uint16) (*dnsResponse, error) {
+	id := uint16(time.Now().UnixNano())
+	query, err := buildDNSQuery(id, host, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	network := "tcp"
+	if server.protocol == dnsProtocolUDP {
+		network = "udp"
+	}
+	for {
+		msg, err := r.roundTrip(ctx, server, network, query)
+		if err != nil {
+			return nil, &net.DNSError{Err: err.Error(), Name: host, Server: server.String(), IsTimeout: IsTimeout(err)}
+		}
+		response, err := parseDNSResponse(msg, id, host)
+		if err != nil {
+			return nil, err
+		}
+		if response.truncated && network == "udp" {
+			network = "tcp"
+			continue
+		}
+		return response, nil
+	}
+}
+
+// roundTrip 发送查询报文并读取响应，流式连接使用2字节长度前缀
+func (r *Resolver) roundTrip(ctx context.Context, server *dnsServer, network string, query []byte) ([]byte, error) {
+	conn, err := r.dialServer(ctx, server, network)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, ok := conn.(net.PacketConn); ok {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, dohMaxResponse)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	framed := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	copy(framed[2:], query)
+	if _, err := conn.Write(framed); err != nil {
+		return nil, err
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// IsTimeout 错误是否为超时（网络超时或context超时）
+func IsTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout() || errors.Is(err, context.DeadlineExceeded)
+}
+
+// lookup 依次向各服务器查询，记录每次查询的耗时
+// 所有服务器都因临时错误失败时，按重试策略退避后重新从第一个服务器开始
+func (r *Resolver) lookup(ctx context.Context, host string, query func(context.Context, *dnsServer) error) error {
+	_, err := r.retry.Do(ctx, func(ctx context.Context) error {
+		return r.lookupOnce(ctx, host, query)
+	})
+	return err
+}
+
+// lookupOnce 依次向各服务器查询一次
+func (r *Resolver) lookupOnce(ctx context.Context, host string, query func(context.Context, *dnsServer) error) error {
+	var lastErr error
+	for _, server := range r.servers {
+		queryCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		done := types.StartOperation(ctx, types.OperationDNS, host+" @"+server.String())
+		err := query(queryCtx, server)
+		cancel()
+
+		// Go解析器报告的是系统配置的服务器，改为实际查询的服务器
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && server.protocol != dnsProtocolSystem {
+			dnsErr.Server = server.String()
+		}
+		done(err)
+
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		// 域名不存在是明确结论；上层context结束时不再尝试
+		if dnsErr != nil && dnsErr.IsNotFound {
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,127 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// 重试退避参数
+const (
+	retryBaseDelay = 200 * time.Millisecond
+	retryMaxDelay  = 2 * time.Second
+)
+
+// RetryPolicy 网络操作的重试策略
+// 只重试超时、连接重置等临时错误，证书错误、域名不存在等明确结论不重试；
+// 两次尝试之间按指数退避并加入随机抖动，等待期间受context约束
+type RetryPolicy struct {
+	Retries   int // 首次尝试之后最多重试的次数
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// NewRetryPolicy 根据网络配置创建重试策略
+func NewRetryPolicy(config *types.Config) *RetryPolicy {
+	policy := &RetryPolicy{BaseDelay: retryBaseDelay, MaxDelay: retryMaxDelay}
+	if config != nil && config.Network.Retries > 0 {
+		policy.Retries = config.Network.Retries
+	}
+	return policy
+}
+
+// Do 执行操作，遇到临时错误时重试，返回尝试次数和最后一次的错误
+// 每次尝试的context上带有尝试次数，网络操作记录据此标记重试
+func (p *RetryPolicy) Do(ctx context.Context, op func(ctx context.Context) error) (int, error) {
+	attempts := 1
+	if p != nil {
+		attempts += p.Retries
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			if !p.wait(ctx, attempt-1) {
+				return attempt - 1, err
+			}
+		}
+
+		err = op(types.WithAttempt(ctx, attempt))
+		if err == nil || !IsRetryable(err) || ctx.Err() != nil {
+			return attempt, err
+		}
+	}
+	return attempts, err
+}
+
+// wait 第n次重试前的退避等待，context结束时返回false
+func (p *RetryPolicy) wait(ctx context.Context, retry int) bool {
+	delay := p.BaseDelay << (retry - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	// 一半固定、一半随机，避免并发检测同时重试
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int63n(half))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// IsRetryable 错误是否为值得重试的临时错误
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// 取消不重试；上层context超时由 Do 检查，单次尝试自身的超时可以重试
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	// 明确结论：域名不存在、证书无效、服务器拒绝握手
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound && (dnsErr.IsTimeout || dnsErr.IsTemporary)
+	}
+	var (
+		certErr    *tls.CertificateVerificationError
+		hostErr    x509.HostnameError
+		authErr    x509.UnknownAuthorityError
+		invalidErr x509.CertificateInvalidError
+		alertErr   tls.AlertError
+		recordErr  tls.RecordHeaderError
+	)
+	if errors.As(err, &certErr) || errors.As(err, &hostErr) || errors.As(err, &authErr) ||
+		errors.As(err, &invalidErr) || errors.As(err, &alertErr) || errors.As(err, &recordErr) {
+		return false
+	}
+
+	// 临时错误：超时、连接被重置或中断
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
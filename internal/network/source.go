@@ -0,0 +1,104 @@
+package network
+
+import (
+	"fmt"
+	"net"
+
+	"RealityChecker/internal/types"
+)
+
+// sourceAddrs 探测使用的本地地址，按目标地址族选择
+type sourceAddrs struct {
+	name string // 配置的源地址或网卡名，用于错误信息
+	ipv4 net.IP
+	ipv6 net.IP
+}
+
+// ValidateSource 校验源地址配置
+func ValidateSource(config types.NetworkConfig) error {
+	_, err := parseSource(config)
+	return err
+}
+
+// parseSource 解析源地址配置，未配置时返回nil
+func parseSource(config types.NetworkConfig) (*sourceAddrs, error) {
+	if config.SourceAddress != "" && config.Interface != "" {
+		return nil, fmt.Errorf("source_address 和 interface 只能设置一个")
+	}
+
+	if config.SourceAddress != "" {
+		ip := net.ParseIP(config.SourceAddress)
+		if ip == nil {
+			return nil, fmt.Errorf("源地址不是有效的IP: %s", config.SourceAddress)
+		}
+		source := &sourceAddrs{name: config.SourceAddress}
+		if ip.To4() != nil {
+			source.ipv4 = ip
+		} else {
+			source.ipv6 = ip
+		}
+		return source, nil
+	}
+
+	if config.Interface != "" {
+		iface, err := net.InterfaceByName(config.Interface)
+		if err != nil {
+			return nil, fmt.Errorf("网卡不存在 %s: %v", config.Interface, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("读取网卡地址失败 %s: %v", config.Interface, err)
+		}
+
+		// 链路本地IPv6地址需要指定区域，不适合作为探测的源地址
+		source := &sourceAddrs{name: config.Interface}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			if ipNet.IP.To4() != nil {
+				if source.ipv4 == nil {
+					source.ipv4 = ipNet.IP
+				}
+			} else if source.ipv6 == nil {
+				source.ipv6 = ipNet.IP
+			}
+		}
+		if source.ipv4 == nil && source.ipv6 == nil {
+			return nil, fmt.Errorf("网卡 %s 没有可用的IP地址", config.Interface)
+		}
+		return source, nil
+	}
+
+	return nil, nil
+}
+
+// localAddr 连接目标地址时使用的本地地址
+// 目标为域名时优先使用IPv4源地址，拨号器只会连接与源地址同一地址族的解析结果
+func (s *sourceAddrs) localAddr(network, address string) (net.Addr, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	ip := s.ipv4
+	if ip == nil {
+		ip = s.ipv6
+	}
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		if target := net.ParseIP(host); target != nil {
+			ip = s.ipv4
+			if target.To4() == nil {
+				ip = s.ipv6
+			}
+		}
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("源地址 %s 没有与目标 %s 同一地址族的IP", s.name, address)
+	}
+
+	if network == "udp" || network == "udp4" || network == "udp6" {
+		return &net.UDPAddr{IP: ip}, nil
+	}
+	return &net.TCPAddr{IP: ip}, nil
+}
@@ -0,0 +1,65 @@
+package network
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// WithHTTPTrace 为HTTP请求挂载httptrace，将请求内的DNS查询、TCP连接和TLS握手记录到阶段记录器
+// context上没有阶段记录器时原样返回
+func WithHTTPTrace(ctx context.Context) context.Context {
+	trace := types.StageTraceFrom(ctx)
+	if trace == nil {
+		return ctx
+	}
+
+	var (
+		mu           sync.Mutex
+		dnsHost      string
+		dnsStart     time.Time
+		connectStart = make(map[string]time.Time)
+		tlsStart     time.Time
+	)
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsHost, dnsStart = info.Host, time.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			mu.Lock()
+			host, start := dnsHost, dnsStart
+			mu.Unlock()
+			trace.Record(types.OperationDNS, host, start, info.Err)
+		},
+		// 双栈拨号时可能并发连接多个地址，按地址分别计时
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			connectStart[addr] = time.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			start := connectStart[addr]
+			mu.Unlock()
+			trace.Record(types.OperationTCP, addr, start, err)
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsStart = time.Now()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			mu.Lock()
+			start := tlsStart
+			mu.Unlock()
+			trace.Record(types.OperationTLS, state.ServerName, start, err)
+		},
+	})
+}
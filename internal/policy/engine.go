@@ -0,0 +1,379 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"RealityChecker/internal/types"
+)
+
+// ruleFunc 规则检查函数，通过时返回nil
+type ruleFunc func(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict
+
+// rules 所有可用的规则
+var rules = map[string]ruleFunc{
+	types.RuleNotBlocked:  checkNotBlocked,
+	types.RuleNotDomestic: checkNotDomestic,
+	types.RuleReachable:   checkReachable,
+	types.RuleStatusCode:  checkStatusCode,
+	types.RuleTLS13:       checkTLS13,
+	types.RuleX25519:      checkX25519,
+	types.RuleH2:          checkH2,
+	types.RuleCertValid:   checkCertValid,
+	types.RuleCertExpiry:  checkCertExpiry,
+	types.RuleSNIMatch:    checkSNIMatch,
+	types.RuleHandshake:   checkHandshake,
+	types.RuleAddresses:   checkAddresses,
+	types.RuleIPv6:        checkIPv6,
+}
+
+// ruleArtifacts 各规则检查的检测数据，用于把规则结论对应到产出该数据的阶段
+var ruleArtifacts = map[string][]types.Artifact{
+	types.RuleNotBlocked:  {types.ArtifactBlocked},
+	types.RuleNotDomestic: {types.ArtifactLocation},
+	types.RuleStatusCode:  {types.ArtifactHTTPStatus, types.ArtifactStatusCategory},
+	types.RuleTLS13:       {types.ArtifactTLS},
+	types.RuleX25519:      {types.ArtifactTLS},
+	types.RuleH2:          {types.ArtifactTLS},
+	types.RuleCertValid:   {types.ArtifactCertificate},
+	types.RuleCertExpiry:  {types.ArtifactCertificate},
+	types.RuleSNIMatch:    {types.ArtifactTLS},
+	types.RuleHandshake:   {types.ArtifactTLS},
+	types.RuleAddresses:   {types.ArtifactAddresses},
+	types.RuleIPv6:        {types.ArtifactIPv6},
+}
+
+// addressRules 可以针对单个地址评估的规则，其余规则只与域名有关
+var addressRules = map[string]bool{
+	types.RuleNotDomestic: true,
+	types.RuleTLS13:       true,
+	types.RuleX25519:      true,
+	types.RuleH2:          true,
+	types.RuleCertValid:   true,
+	types.RuleCertExpiry:  true,
+	types.RuleSNIMatch:    true,
+	types.RuleHandshake:   true,
+}
+
+// RuleArtifacts 返回规则未通过时对应的检测数据
+// 可达性规则按原因区分：HTTP不可达归于HTTP状态，其余归于TLS握手
+func RuleArtifacts(rule string, result *types.DetectionResult) []types.Artifact {
+	if rule == types.RuleReachable {
+		if result.Network != nil && !result.Network.Accessible {
+			return []types.Artifact{types.ArtifactHTTPStatus}
+		}
+		return []types.Artifact{types.ArtifactTLS}
+	}
+	return ruleArtifacts[rule]
+}
+
+// Engine 适合性策略引擎
+type Engine struct {
+	config types.PolicyConfig
+}
+
+// NewEngine 创建策略引擎，规则名称未知时返回错误
+func NewEngine(config types.PolicyConfig) (*Engine, error) {
+	if err := Validate(config); err != nil {
+		return nil, err
+	}
+	return &Engine{config: config}, nil
+}
+
+// Validate 校验策略配置（含所有覆盖）中的规则名称
+func Validate(config types.PolicyConfig) error {
+	ruleSets := [][]string{config.Rules}
+	ratios := []float64{config.MinAddressRatio}
+	for _, override := range config.Overrides {
+		if len(override.Match) == 0 {
+			return fmt.Errorf("策略覆盖缺少 match")
+		}
+		ruleSets = append(ruleSets, override.Rules)
+		ratios = append(ratios, override.MinAddressRatio)
+	}
+
+	for _, ratio := range ratios {
+		if ratio < 0 || ratio > 1 {
+			return fmt.Errorf("min_address_ratio 应在 0 到 1 之间: %g", ratio)
+		}
+	}
+
+	for _, ruleSet := range ruleSets {
+		for _, rule := range ruleSet {
+			if _, ok := rules[rule]; !ok {
+				return fmt.Errorf("未知的策略规则: %s（可用规则: %s）", rule, strings.Join(RuleNames(), ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// RuleNames 返回所有可用规则名称（默认规则在前，按评估顺序排列）
+func RuleNames() []string {
+	names := append([]string{}, types.DefaultPolicyRules...)
+	return append(names, types.RuleHandshake)
+}
+
+// Policy 返回适用于指定域名的策略
+func (e *Engine) Policy(domain string) types.PolicyConfig {
+	return e.config.ForDomain(domain)
+}
+
+// EvaluateAll 评估全部规则（不在第一个未通过的规则处停止），按评估顺序返回每条规则的结果
+func (e *Engine) EvaluateAll(ctx context.Context, result *types.DetectionResult) []types.RuleOutcome {
+	policy := e.Policy(result.Domain)
+	ruleList := policy.RuleList()
+	outcomes := make([]types.RuleOutcome, 0, len(ruleList))
+	for _, rule := range ruleList {
+		verdict := e.evaluateRule(ctx, policy, rule, result)
+		outcomes = append(outcomes, types.RuleOutcome{
+			Rule:    rule,
+			Passed:  verdict == nil,
+			Verdict: verdict,
+		})
+	}
+	return outcomes
+}
+
+// EvaluateAddresses 按策略中针对单个地址的规则逐个评估多地址模式的各地址和双栈模式的IPv6地址，
+// 写入各地址的 Passed 和 Verdict
+func (e *Engine) EvaluateAddresses(ctx context.Context, result *types.DetectionResult) {
+	policy := e.Policy(result.Domain)
+	for i := range result.Addresses {
+		address := &result.Addresses[i]
+		address.Verdict = e.evaluateAddress(ctx, policy, result.Domain, address)
+		address.Passed = address.Verdict == nil
+	}
+	if result.IPv6 != nil {
+		result.IPv6.Verdict = e.evaluateAddress(ctx, policy, result.Domain, result.IPv6)
+		result.IPv6.Passed = result.IPv6.Verdict == nil
+	}
+}
+
+// evaluateAddress 评估单个地址，返回第一个未通过规则的结论
+func (e *Engine) evaluateAddress(ctx context.Context, policy types.PolicyConfig, domain string, address *types.AddressResult) *types.Verdict {
+	if address.Error != "" || address.TLS == nil {
+		verdict := types.NewVerdict(types.ReasonUnreachable, address.Error)
+		verdict.Rule = types.RuleReachable
+		return verdict
+	}
+
+	// 以该地址的检测数据构造结果，复用域名级别的规则实现
+	view := &types.DetectionResult{
+		Domain:      domain,
+		Network:     address.Network,
+		Location:    address.Location,
+		TLS:         address.TLS,
+		Certificate: address.Certificate,
+		SNI:         address.SNI,
+	}
+	for _, rule := range policy.RuleList() {
+		// 经该地址请求过时，可达性和状态码规则也针对该地址评估
+		httpRule := rule == types.RuleReachable || rule == types.RuleStatusCode
+		if !addressRules[rule] && !(httpRule && address.Network != nil) {
+			continue
+		}
+		if verdict := e.evaluateRule(ctx, policy, rule, view); verdict != nil {
+			return verdict
+		}
+	}
+	return nil
+}
+
+// evaluateRule 评估单条规则，未通过时在结论中记录规则名称
+func (e *Engine) evaluateRule(ctx context.Context, policy types.PolicyConfig, rule string, result *types.DetectionResult) *types.Verdict {
+	verdict := rules[rule](ctx, policy, result)
+	if verdict != nil {
+		verdict.Rule = rule
+	}
+	return verdict
+}
+
+// checkNotBlocked 未被墙
+func checkNotBlocked(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	if result.Blocked != nil && result.Blocked.IsBlocked {
+		return types.NewVerdict(types.ReasonBlocked, strings.Join(result.Blocked.BlockedReasons, ", "))
+	}
+	return nil
+}
+
+// checkNotDomestic 非国内网站
+func checkNotDomestic(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	if result.Location != nil && result.Location.IsDomestic {
+		return types.NewVerdict(types.ReasonDomestic, fmt.Sprintf("%s，仅参考GeoIP", result.Location.Country))
+	}
+	return nil
+}
+
+// checkReachable 网络可达且TLS检测已完成
+func checkReachable(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	if (result.Network != nil && !result.Network.Accessible) || result.TLS == nil {
+		return missingData(ctx, result)
+	}
+	return nil
+}
+
+// missingData 规则所需的检测数据缺失时的结论
+// 网络不可达、超时、取消或上游阶段失败时无法判断，不能视为通过；
+// 策略规则中没有 reachable 时，其他规则也会给出检测失败的结论
+func missingData(ctx context.Context, result *types.DetectionResult) *types.Verdict {
+	if result.Network != nil && !result.Network.Accessible {
+		return types.NewVerdict(types.ReasonUnreachable, "")
+	}
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return types.NewVerdict(types.ReasonTimeout, "")
+	case context.Canceled:
+		return types.NewVerdict(types.ReasonCanceled, "")
+	}
+	details := ""
+	if result.Error != nil {
+		details = result.Error.Error()
+	}
+	if result.TimedOut() {
+		return types.NewVerdict(types.ReasonTimeout, details)
+	}
+	return types.NewVerdict(types.ReasonUnreachable, details)
+}
+
+// checkStatusCode 状态码可接受
+func checkStatusCode(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	if result.Network == nil || !result.Network.Accessible {
+		return missingData(ctx, result)
+	}
+	if policy.ClassifyStatusCode(result.Network.StatusCode, true) == types.StatusCodeCategoryExcluded {
+		return types.NewVerdict(types.ReasonBadStatus, fmt.Sprintf("%d", result.Network.StatusCode))
+	}
+	return nil
+}
+
+// checkTLS13 支持TLS 1.3
+func checkTLS13(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	if result.TLS == nil {
+		return missingData(ctx, result)
+	}
+	if !result.TLS.SupportsTLS13 {
+		return types.NewVerdict(types.ReasonNoTLS13, result.TLS.ProtocolVersion)
+	}
+	return nil
+}
+
+// checkX25519 支持X25519
+func checkX25519(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	if result.TLS == nil {
+		return missingData(ctx, result)
+	}
+	if !result.TLS.SupportsX25519 {
+		return types.NewVerdict(types.ReasonNoX25519, "")
+	}
+	return nil
+}
+
+// checkH2 支持HTTP/2
+func checkH2(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	if result.TLS == nil {
+		return missingData(ctx, result)
+	}
+	if !result.TLS.SupportsHTTP2 {
+		return types.NewVerdict(types.ReasonNoH2, "")
+	}
+	return nil
+}
+
+// checkCertValid 证书有效
+func checkCertValid(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	if result.Certificate == nil {
+		return missingData(ctx, result)
+	}
+	if !result.Certificate.Valid {
+		return types.NewVerdict(types.ReasonCertInvalid, result.Certificate.Error)
+	}
+	return nil
+}
+
+// checkCertExpiry 证书剩余天数不少于阈值
+func checkCertExpiry(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	if result.Certificate == nil {
+		return missingData(ctx, result)
+	}
+	if !result.Certificate.Valid {
+		return nil // 由 cert_valid 规则判断
+	}
+	if result.Certificate.DaysUntilExpiry < policy.CertDaysThreshold() {
+		return types.NewVerdict(types.ReasonCertExpired,
+			fmt.Sprintf("剩余%d天，要求至少%d天", result.Certificate.DaysUntilExpiry, policy.CertDaysThreshold()))
+	}
+	return nil
+}
+
+// checkSNIMatch SNI匹配
+func checkSNIMatch(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	if result.SNI == nil {
+		return missingData(ctx, result)
+	}
+	if !result.SNI.SupportsSNI || !result.SNI.SNIMatch {
+		return types.NewVerdict(types.ReasonSNIMismatch, result.SNI.ServerName)
+	}
+	return nil
+}
+
+// checkHandshake 握手时间不超过阈值，有延迟采样时比较中位数
+func checkHandshake(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	if policy.MaxHandshake <= 0 {
+		return nil
+	}
+	if result.TLS == nil {
+		return missingData(ctx, result)
+	}
+	if result.TLS.Handshake() <= 0 {
+		return nil
+	}
+	if result.TLS.Handshake() > policy.MaxHandshake {
+		return types.NewVerdict(types.ReasonSlowHandshake,
+			fmt.Sprintf("%dms，上限%dms", result.TLS.Handshake().Milliseconds(), policy.MaxHandshake.Milliseconds()))
+	}
+	return nil
+}
+
+// checkAddresses 多地址模式下通过检测的地址不少于策略要求，未启用多地址模式时通过
+func checkAddresses(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	total := len(result.Addresses)
+	if total == 0 {
+		return nil
+	}
+	passed := 0
+	var firstFailed *types.AddressResult
+	for i := range result.Addresses {
+		if result.Addresses[i].Passed {
+			passed++
+		} else if firstFailed == nil {
+			firstFailed = &result.Addresses[i]
+		}
+	}
+
+	required := policy.RequiredAddresses(total)
+	if passed >= required {
+		return nil
+	}
+	details := fmt.Sprintf("%d/%d 个地址通过，要求至少 %d 个", passed, total, required)
+	if firstFailed != nil && firstFailed.Verdict != nil {
+		details += fmt.Sprintf("（%s: %s）", firstFailed.IP, firstFailed.Verdict.String())
+	}
+	return types.NewVerdict(types.ReasonAddresses, details)
+}
+
+// checkIPv6 双栈模式下IPv6地址也通过针对单个地址的规则，未启用双栈模式时通过
+func checkIPv6(ctx context.Context, policy types.PolicyConfig, result *types.DetectionResult) *types.Verdict {
+	if result.IPv6 == nil || result.IPv6.Passed {
+		return nil
+	}
+	details := ""
+	if result.IPv6.Verdict != nil {
+		details = result.IPv6.Verdict.String()
+	}
+	if result.IPv6.IP != "" {
+		details = fmt.Sprintf("%s: %s", result.IPv6.IP, details)
+	}
+	return types.NewVerdict(types.ReasonIPv6, details)
+}
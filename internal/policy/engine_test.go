@@ -0,0 +1,370 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// passingResult 通过全部默认规则的检测结果
+func passingResult() *types.DetectionResult {
+	return &types.DetectionResult{
+		Domain:      "example.com",
+		Network:     &types.NetworkResult{Accessible: true, StatusCode: 200},
+		Location:    &types.LocationResult{Country: "美国", CountryCode: "US"},
+		TLS:         &types.TLSResult{SupportsTLS13: true, SupportsX25519: true, SupportsHTTP2: true},
+		Certificate: &types.CertificateResult{Valid: true, DaysUntilExpiry: 90},
+		SNI:         &types.SNIResult{SupportsSNI: true, SNIMatch: true, ServerName: "example.com"},
+	}
+}
+
+// verdictCode 结论的原因代码，通过时为空
+func verdictCode(verdict *types.Verdict) types.ReasonCode {
+	if verdict == nil {
+		return ""
+	}
+	return verdict.Code
+}
+
+// expiredContext 已超过时限的context
+func expiredContext() context.Context {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	<-ctx.Done()
+	return ctx
+}
+
+// canceledContext 已取消的context
+func canceledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestMissingData(t *testing.T) {
+	stageTimeout := []types.StageError{{Stage: "comprehensive_tls", Err: fmt.Errorf("%w: 握手未完成", types.ErrStageTimeout)}}
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		result      *types.DetectionResult
+		wantCode    types.ReasonCode
+		wantDetails string
+	}{
+		{"HTTP不可达", context.Background(), &types.DetectionResult{Network: &types.NetworkResult{}}, types.ReasonUnreachable, ""},
+		{"HTTP不可达优先于整体超时", expiredContext(), &types.DetectionResult{Network: &types.NetworkResult{}}, types.ReasonUnreachable, ""},
+		{"整体超时", expiredContext(), &types.DetectionResult{}, types.ReasonTimeout, ""},
+		{"整体取消", canceledContext(), &types.DetectionResult{}, types.ReasonCanceled, ""},
+		{"阶段超时", context.Background(), &types.DetectionResult{StageErrors: stageTimeout}, types.ReasonTimeout, ""},
+		{"阶段超时并有错误", context.Background(), &types.DetectionResult{StageErrors: stageTimeout, Error: errors.New("TLS检测失败")}, types.ReasonTimeout, "TLS检测失败"},
+		{"上游阶段出错", context.Background(), &types.DetectionResult{Error: errors.New("IP解析失败")}, types.ReasonUnreachable, "IP解析失败"},
+		{"没有任何数据", context.Background(), &types.DetectionResult{}, types.ReasonUnreachable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict := missingData(tt.ctx, tt.result)
+			if verdict.Code != tt.wantCode || verdict.Details != tt.wantDetails {
+				t.Fatalf("结论 = %s（%q），期望 %s（%q）", verdict.Code, verdict.Details, tt.wantCode, tt.wantDetails)
+			}
+			if !verdict.Code.IsCheckFailure() {
+				t.Fatalf("数据缺失的结论 %s 应为检测失败", verdict.Code)
+			}
+		})
+	}
+}
+
+func TestMissingDataFailsEveryRule(t *testing.T) {
+	// 策略中没有 reachable 时，缺少数据的规则也给出检测失败的结论，而不是通过
+	tests := []struct {
+		rule   string
+		remove func(result *types.DetectionResult)
+	}{
+		{types.RuleReachable, func(r *types.DetectionResult) { r.TLS = nil }},
+		{types.RuleStatusCode, func(r *types.DetectionResult) { r.Network = nil }},
+		{types.RuleTLS13, func(r *types.DetectionResult) { r.TLS = nil }},
+		{types.RuleX25519, func(r *types.DetectionResult) { r.TLS = nil }},
+		{types.RuleH2, func(r *types.DetectionResult) { r.TLS = nil }},
+		{types.RuleCertValid, func(r *types.DetectionResult) { r.Certificate = nil }},
+		{types.RuleCertExpiry, func(r *types.DetectionResult) { r.Certificate = nil }},
+		{types.RuleSNIMatch, func(r *types.DetectionResult) { r.SNI = nil }},
+		{types.RuleHandshake, func(r *types.DetectionResult) { r.TLS = nil }},
+	}
+	for _, tt := range tests {
+		for _, ctx := range []struct {
+			name string
+			ctx  context.Context
+			want types.ReasonCode
+		}{
+			{"未完成", context.Background(), types.ReasonUnreachable},
+			{"超时", expiredContext(), types.ReasonTimeout},
+			{"取消", canceledContext(), types.ReasonCanceled},
+		} {
+			t.Run(tt.rule+"/"+ctx.name, func(t *testing.T) {
+				engine, err := NewEngine(types.PolicyConfig{Rules: []string{tt.rule}, MaxHandshake: time.Second})
+				if err != nil {
+					t.Fatalf("创建策略引擎失败: %v", err)
+				}
+				result := passingResult()
+				tt.remove(result)
+
+				outcomes := engine.EvaluateAll(ctx.ctx, result)
+				if len(outcomes) != 1 || outcomes[0].Passed || verdictCode(outcomes[0].Verdict) != ctx.want {
+					t.Fatalf("规则结果 = %+v，期望 %s", outcomes, ctx.want)
+				}
+				if outcomes[0].Verdict.Rule != tt.rule {
+					t.Fatalf("结论的规则 = %s，期望 %s", outcomes[0].Verdict.Rule, tt.rule)
+				}
+			})
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   string
+		policy types.PolicyConfig
+		modify func(result *types.DetectionResult)
+		want   types.ReasonCode
+	}{
+		{"未被墙", types.RuleNotBlocked, types.PolicyConfig{}, nil, ""},
+		{"被墙", types.RuleNotBlocked, types.PolicyConfig{}, func(r *types.DetectionResult) {
+			r.Blocked = &types.BlockedResult{IsBlocked: true, BlockedReasons: []string{"gfwlist"}}
+		}, types.ReasonBlocked},
+		{"非国内", types.RuleNotDomestic, types.PolicyConfig{}, nil, ""},
+		{"国内", types.RuleNotDomestic, types.PolicyConfig{}, func(r *types.DetectionResult) { r.Location.IsDomestic = true }, types.ReasonDomestic},
+		{"没有地理位置时不判为国内", types.RuleNotDomestic, types.PolicyConfig{}, func(r *types.DetectionResult) { r.Location = nil }, ""},
+		{"可达", types.RuleReachable, types.PolicyConfig{}, nil, ""},
+		{"HTTP不可达", types.RuleReachable, types.PolicyConfig{}, func(r *types.DetectionResult) { r.Network.Accessible = false }, types.ReasonUnreachable},
+		{"没有HTTP结果时按TLS判断", types.RuleReachable, types.PolicyConfig{}, func(r *types.DetectionResult) { r.Network = nil }, ""},
+		{"状态码可接受", types.RuleStatusCode, types.PolicyConfig{}, nil, ""},
+		{"状态码不可接受", types.RuleStatusCode, types.PolicyConfig{}, func(r *types.DetectionResult) { r.Network.StatusCode = 503 }, types.ReasonBadStatus},
+		{"策略允许的状态码", types.RuleStatusCode, types.PolicyConfig{AllowedStatusCodes: []int{503}}, func(r *types.DetectionResult) { r.Network.StatusCode = 503 }, ""},
+		{"策略不允许的默认状态码", types.RuleStatusCode, types.PolicyConfig{AllowedStatusCodes: []int{503}}, nil, types.ReasonBadStatus},
+		{"HTTP不可达时状态码未知", types.RuleStatusCode, types.PolicyConfig{}, func(r *types.DetectionResult) { r.Network.Accessible = false }, types.ReasonUnreachable},
+		{"支持TLS 1.3", types.RuleTLS13, types.PolicyConfig{}, nil, ""},
+		{"不支持TLS 1.3", types.RuleTLS13, types.PolicyConfig{}, func(r *types.DetectionResult) { r.TLS.SupportsTLS13 = false }, types.ReasonNoTLS13},
+		{"支持X25519", types.RuleX25519, types.PolicyConfig{}, nil, ""},
+		{"不支持X25519", types.RuleX25519, types.PolicyConfig{}, func(r *types.DetectionResult) { r.TLS.SupportsX25519 = false }, types.ReasonNoX25519},
+		{"支持HTTP/2", types.RuleH2, types.PolicyConfig{}, nil, ""},
+		{"不支持HTTP/2", types.RuleH2, types.PolicyConfig{}, func(r *types.DetectionResult) { r.TLS.SupportsHTTP2 = false }, types.ReasonNoH2},
+		{"证书有效", types.RuleCertValid, types.PolicyConfig{}, nil, ""},
+		{"证书无效", types.RuleCertValid, types.PolicyConfig{}, func(r *types.DetectionResult) { r.Certificate.Valid = false }, types.ReasonCertInvalid},
+		{"证书剩余天数充足", types.RuleCertExpiry, types.PolicyConfig{}, nil, ""},
+		{"证书已过期", types.RuleCertExpiry, types.PolicyConfig{}, func(r *types.DetectionResult) { r.Certificate.DaysUntilExpiry = 0 }, types.ReasonCertExpired},
+		{"证书剩余天数少于策略要求", types.RuleCertExpiry, types.PolicyConfig{MinCertDays: 120}, nil, types.ReasonCertExpired},
+		{"无效证书由 cert_valid 判断", types.RuleCertExpiry, types.PolicyConfig{}, func(r *types.DetectionResult) {
+			r.Certificate.Valid, r.Certificate.DaysUntilExpiry = false, -10
+		}, ""},
+		{"SNI匹配", types.RuleSNIMatch, types.PolicyConfig{}, nil, ""},
+		{"SNI不匹配", types.RuleSNIMatch, types.PolicyConfig{}, func(r *types.DetectionResult) { r.SNI.SNIMatch = false }, types.ReasonSNIMismatch},
+		{"不支持SNI", types.RuleSNIMatch, types.PolicyConfig{}, func(r *types.DetectionResult) { r.SNI.SupportsSNI = false }, types.ReasonSNIMismatch},
+		{"未限制握手时间", types.RuleHandshake, types.PolicyConfig{}, func(r *types.DetectionResult) { r.TLS = nil }, ""},
+		{"握手时间未超过上限", types.RuleHandshake, types.PolicyConfig{MaxHandshake: 300 * time.Millisecond}, func(r *types.DetectionResult) {
+			r.TLS.HandshakeTime = 200 * time.Millisecond
+		}, ""},
+		{"握手时间超过上限", types.RuleHandshake, types.PolicyConfig{MaxHandshake: 300 * time.Millisecond}, func(r *types.DetectionResult) {
+			r.TLS.HandshakeTime = 400 * time.Millisecond
+		}, types.ReasonSlowHandshake},
+		{"有延迟采样时比较中位数", types.RuleHandshake, types.PolicyConfig{MaxHandshake: 300 * time.Millisecond}, func(r *types.DetectionResult) {
+			r.TLS.HandshakeTime = 400 * time.Millisecond
+			r.TLS.Latency = &types.LatencyResult{Handshake: types.LatencyStats{Median: 200 * time.Millisecond}}
+		}, ""},
+		{"未测得握手时间", types.RuleHandshake, types.PolicyConfig{MaxHandshake: 300 * time.Millisecond}, nil, ""},
+		{"未启用多地址模式", types.RuleAddresses, types.PolicyConfig{}, nil, ""},
+		{"全部地址通过", types.RuleAddresses, types.PolicyConfig{}, func(r *types.DetectionResult) {
+			r.Addresses = []types.AddressResult{{IP: "192.0.2.1", Passed: true}, {IP: "192.0.2.2", Passed: true}}
+		}, ""},
+		{"部分地址未通过", types.RuleAddresses, types.PolicyConfig{}, func(r *types.DetectionResult) {
+			r.Addresses = []types.AddressResult{{IP: "192.0.2.1", Passed: true}, {IP: "192.0.2.2", Verdict: types.NewVerdict(types.ReasonNoH2, "")}}
+		}, types.ReasonAddresses},
+		{"通过比例满足策略要求", types.RuleAddresses, types.PolicyConfig{MinAddressRatio: 0.5}, func(r *types.DetectionResult) {
+			r.Addresses = []types.AddressResult{{IP: "192.0.2.1", Passed: true}, {IP: "192.0.2.2"}}
+		}, ""},
+		{"未启用双栈模式", types.RuleIPv6, types.PolicyConfig{}, nil, ""},
+		{"IPv6通过", types.RuleIPv6, types.PolicyConfig{}, func(r *types.DetectionResult) {
+			r.IPv6 = &types.AddressResult{IP: "2001:db8::1", Passed: true}
+		}, ""},
+		{"IPv6未通过", types.RuleIPv6, types.PolicyConfig{}, func(r *types.DetectionResult) {
+			r.IPv6 = &types.AddressResult{Error: "未找到IPv6地址"}
+		}, types.ReasonIPv6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule+"/"+tt.name, func(t *testing.T) {
+			policy := tt.policy
+			policy.Rules = []string{tt.rule}
+			engine, err := NewEngine(policy)
+			if err != nil {
+				t.Fatalf("创建策略引擎失败: %v", err)
+			}
+			result := passingResult()
+			if tt.modify != nil {
+				tt.modify(result)
+			}
+
+			outcomes := engine.EvaluateAll(context.Background(), result)
+			if len(outcomes) != 1 || outcomes[0].Rule != tt.rule {
+				t.Fatalf("规则结果 = %+v，期望只有规则 %s", outcomes, tt.rule)
+			}
+			outcome := outcomes[0]
+			if got := verdictCode(outcome.Verdict); got != tt.want || outcome.Passed != (tt.want == "") {
+				t.Fatalf("结论 = %q（通过 %v），期望 %q", got, outcome.Passed, tt.want)
+			}
+			if outcome.Verdict != nil && outcome.Verdict.Rule != tt.rule {
+				t.Fatalf("结论的规则 = %s，期望 %s", outcome.Verdict.Rule, tt.rule)
+			}
+		})
+	}
+}
+
+func TestEvaluateAll(t *testing.T) {
+	engine, err := NewEngine(types.PolicyConfig{
+		Overrides: []types.PolicyOverride{{Match: []string{"*.example.org"}, Rules: []string{types.RuleH2, types.RuleTLS13}}},
+	})
+	if err != nil {
+		t.Fatalf("创建策略引擎失败: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		domain     string
+		wantRules  []string
+		wantFailed []string
+	}{
+		{"默认规则全部评估，不在第一个未通过的规则处停止", "example.com", types.DefaultPolicyRules, []string{types.RuleNotDomestic, types.RuleH2}},
+		{"匹配覆盖时按覆盖的规则和顺序评估", "www.example.org", []string{types.RuleH2, types.RuleTLS13}, []string{types.RuleH2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := passingResult()
+			result.Domain = tt.domain
+			result.Location.IsDomestic = true
+			result.TLS.SupportsHTTP2 = false
+
+			outcomes := engine.EvaluateAll(context.Background(), result)
+			if len(outcomes) != len(tt.wantRules) {
+				t.Fatalf("评估了 %d 条规则，期望 %d 条", len(outcomes), len(tt.wantRules))
+			}
+			var failed []string
+			for i, outcome := range outcomes {
+				if outcome.Rule != tt.wantRules[i] {
+					t.Fatalf("第 %d 条规则 = %s，期望 %s", i, outcome.Rule, tt.wantRules[i])
+				}
+				if !outcome.Passed {
+					failed = append(failed, outcome.Rule)
+				}
+			}
+			if fmt.Sprint(failed) != fmt.Sprint(tt.wantFailed) {
+				t.Fatalf("未通过的规则 = %v，期望 %v", failed, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestEvaluateAddresses(t *testing.T) {
+	// passingAddress 通过全部针对单个地址的规则的地址
+	passingAddress := func() types.AddressResult {
+		result := passingResult()
+		return types.AddressResult{IP: "2001:db8::1", Location: result.Location, TLS: result.TLS, Certificate: result.Certificate, SNI: result.SNI}
+	}
+
+	tests := []struct {
+		name     string
+		policy   types.PolicyConfig
+		modify   func(address *types.AddressResult)
+		want     types.ReasonCode
+		wantRule string
+	}{
+		{"通过", types.PolicyConfig{}, nil, "", ""},
+		{"连接失败", types.PolicyConfig{}, func(a *types.AddressResult) { a.Error = "connection refused" }, types.ReasonUnreachable, types.RuleReachable},
+		{"没有TLS结果", types.PolicyConfig{}, func(a *types.AddressResult) { a.TLS = nil }, types.ReasonUnreachable, types.RuleReachable},
+		{"国内地址", types.PolicyConfig{}, func(a *types.AddressResult) { a.Location = &types.LocationResult{CountryCode: "CN", IsDomestic: true} }, types.ReasonDomestic, types.RuleNotDomestic},
+		{"不支持HTTP/2", types.PolicyConfig{}, func(a *types.AddressResult) { a.TLS.SupportsHTTP2 = false }, types.ReasonNoH2, types.RuleH2},
+		{"策略不要求HTTP/2", types.PolicyConfig{Rules: []string{types.RuleTLS13}}, func(a *types.AddressResult) { a.TLS.SupportsHTTP2 = false }, "", ""},
+		{"没有证书结果", types.PolicyConfig{}, func(a *types.AddressResult) { a.Certificate = nil }, types.ReasonUnreachable, types.RuleCertValid},
+		{"经该地址请求的状态码可接受", types.PolicyConfig{}, func(a *types.AddressResult) {
+			a.Network = &types.NetworkResult{Accessible: true, StatusCode: 301}
+		}, "", ""},
+		{"经该地址请求的状态码不可接受", types.PolicyConfig{}, func(a *types.AddressResult) {
+			a.Network = &types.NetworkResult{Accessible: true, StatusCode: 503}
+		}, types.ReasonBadStatus, types.RuleStatusCode},
+		{"经该地址HTTP不可达", types.PolicyConfig{}, func(a *types.AddressResult) {
+			a.Network = &types.NetworkResult{}
+		}, types.ReasonUnreachable, types.RuleReachable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := NewEngine(tt.policy)
+			if err != nil {
+				t.Fatalf("创建策略引擎失败: %v", err)
+			}
+
+			// 同一地址分别作为多地址模式的地址和双栈模式的IPv6地址评估，结论相同
+			address := passingAddress()
+			if tt.modify != nil {
+				tt.modify(&address)
+			}
+			ipv6 := address
+			result := passingResult()
+			result.Addresses = []types.AddressResult{address}
+			result.IPv6 = &ipv6
+
+			engine.EvaluateAddresses(context.Background(), result)
+			for _, evaluated := range []*types.AddressResult{&result.Addresses[0], result.IPv6} {
+				if got := verdictCode(evaluated.Verdict); got != tt.want || evaluated.Passed != (tt.want == "") {
+					t.Fatalf("地址结论 = %q（通过 %v），期望 %q", got, evaluated.Passed, tt.want)
+				}
+				if evaluated.Verdict != nil && evaluated.Verdict.Rule != tt.wantRule {
+					t.Fatalf("地址结论的规则 = %s，期望 %s", evaluated.Verdict.Rule, tt.wantRule)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateAddressesIgnoresDomainRules(t *testing.T) {
+	engine, err := NewEngine(types.PolicyConfig{})
+	if err != nil {
+		t.Fatalf("创建策略引擎失败: %v", err)
+	}
+
+	// 被墙、HTTP状态码等域名级别的结论不影响各地址的评估
+	result := passingResult()
+	result.Blocked = &types.BlockedResult{IsBlocked: true}
+	result.Network.StatusCode = 503
+	address := passingResult()
+	result.IPv6 = &types.AddressResult{IP: "2001:db8::1", TLS: address.TLS, Certificate: address.Certificate, SNI: address.SNI}
+
+	engine.EvaluateAddresses(context.Background(), result)
+	if !result.IPv6.Passed {
+		t.Fatalf("IPv6地址结论 = %s，期望通过", result.IPv6.Verdict)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  types.PolicyConfig
+		wantErr bool
+	}{
+		{"默认策略", types.PolicyConfig{}, false},
+		{"全部规则", types.PolicyConfig{Rules: RuleNames()}, false},
+		{"未知规则", types.PolicyConfig{Rules: []string{"tls12"}}, true},
+		{"覆盖中的未知规则", types.PolicyConfig{Overrides: []types.PolicyOverride{{Match: []string{"a.com"}, Rules: []string{"tls12"}}}}, true},
+		{"覆盖缺少 match", types.PolicyConfig{Overrides: []types.PolicyOverride{{Rules: []string{types.RuleH2}}}}, true},
+		{"地址比例超出范围", types.PolicyConfig{MinAddressRatio: 1.5}, true},
+		{"覆盖中的地址比例为负", types.PolicyConfig{Overrides: []types.PolicyOverride{{Match: []string{"a.com"}, MinAddressRatio: -0.1}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEngine(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误 = %v，期望出错 %v", err, tt.wantErr)
+			}
+		})
+	}
+}
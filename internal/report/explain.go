@@ -0,0 +1,323 @@
+package report
+
+import (
+	"fmt"
+	"strings"
+
+	"RealityChecker/internal/types"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// FormatExplain 格式化单个域名的检测过程说明
+// 按流水线阶段顺序列出每个阶段的执行情况，再列出策略规则和评分因子
+func (f *Formatter) FormatExplain(result *types.DetectionResult, stages []types.DetectionStage) string {
+	var output strings.Builder
+
+	output.WriteString(fmt.Sprintf("检测过程: %s（总耗时 %s）\n", result.Target(), f.formatDuration(result.Duration)))
+	if source := f.formatSource(result); source != "" {
+		output.WriteString(source + "\n")
+	}
+	output.WriteString("\n")
+
+	// 检测阶段
+	output.WriteString("检测阶段:\n")
+	output.WriteString(f.formatStageTable(result, stages))
+	output.WriteString("\n")
+
+	// 网络操作
+	if operations := f.formatOperationTable(result); operations != "" {
+		output.WriteString("网络操作:\n")
+		output.WriteString(operations)
+		output.WriteString("\n")
+	}
+
+	// 延迟采样
+	if latency := f.formatLatencyTable(result.TLS); latency != "" {
+		output.WriteString(fmt.Sprintf("延迟采样（%d/%d次成功）:\n", result.TLS.Latency.Samples, result.TLS.Latency.Attempts))
+		output.WriteString(latency)
+		output.WriteString("\n")
+	}
+
+	// 各地址
+	if len(result.Addresses) > 0 {
+		output.WriteString("各地址检测:\n")
+		output.WriteString(f.formatAddressTable(result.Addresses))
+		output.WriteString("\n")
+	}
+
+	// 双栈模式下的IPv6检测
+	if result.IPv6 != nil {
+		output.WriteString("IPv6检测:\n")
+		output.WriteString(f.formatAddressTable([]types.AddressResult{*result.IPv6}))
+		if network := result.IPv6.Network; network != nil {
+			if network.Accessible {
+				output.WriteString(fmt.Sprintf("IPv6 HTTP状态: %d\n", network.StatusCode))
+			} else {
+				output.WriteString("IPv6 HTTP状态: 不可达\n")
+			}
+		}
+		if families := f.formatFamilies(result); families != "" {
+			output.WriteString(families + "\n")
+		}
+		output.WriteString("\n")
+	}
+
+	// 策略规则
+	if len(result.Rules) > 0 {
+		output.WriteString("策略规则:\n")
+		output.WriteString(f.formatRuleTable(result.Rules))
+		output.WriteString("\n")
+	}
+
+	// 评分因子
+	if result.Score != nil {
+		output.WriteString("评分因子:\n")
+		output.WriteString(f.formatFactorTable(result.Score))
+		output.WriteString(fmt.Sprintf("总分: %.1f，推荐星级: %d\n\n", result.Score.Total, result.Score.Stars))
+	}
+
+	// 结论
+	if result.Suitable {
+		output.WriteString(text.FgGreen.Sprint("结论: 适合") + "\n")
+	} else {
+		output.WriteString(text.FgRed.Sprintf("结论: 不适合（%s）", result.Reason()) + "\n")
+	}
+
+	return output.String()
+}
+
+// formatStageTable 格式化检测阶段表格
+func (f *Formatter) formatStageTable(result *types.DetectionResult, stages []types.DetectionStage) string {
+	reports := make(map[string]types.StageReport)
+	for _, report := range result.Stages {
+		reports[report.Name] = report
+	}
+
+	t := newExplainTable()
+	t.AppendHeader(table.Row{"阶段", "执行", "耗时", "观察结果", "结论"})
+
+	for _, stage := range stages {
+		report, ok := reports[stage.Name()]
+		if !ok || !report.Ran {
+			t.AppendRow(table.Row{stage.Name(), "否", "-", "-", formatStageOutcome(types.StageOutcomeSkipped)})
+			continue
+		}
+
+		observed := report.Observed
+		if report.Error != "" {
+			observed = strings.TrimPrefix(observed+"，错误: "+report.Error, "，")
+		}
+		if report.EarlyExit {
+			observed = strings.TrimPrefix(observed+"，请求早期退出", "，")
+		}
+		if observed == "" {
+			observed = "-"
+		}
+
+		t.AppendRow(table.Row{stage.Name(), "是", f.formatDuration(report.Duration), observed, formatStageOutcome(report.Outcome)})
+	}
+
+	t.Render()
+	return t.buf.String()
+}
+
+// formatOperationTable 格式化各阶段的网络操作表格，没有任何操作时返回空字符串
+func (f *Formatter) formatOperationTable(result *types.DetectionResult) string {
+	t := newExplainTable()
+	t.AppendHeader(table.Row{"阶段", "类型", "目标", "尝试", "耗时", "错误"})
+
+	count := 0
+	for _, report := range result.Stages {
+		for _, operation := range report.Operations {
+			errText := "-"
+			if operation.Error != "" {
+				errText = text.FgRed.Sprint(operation.Error)
+			}
+			attempt := 1
+			if operation.Attempt > 1 {
+				attempt = operation.Attempt
+			}
+			t.AppendRow(table.Row{report.Name, operation.Kind, operation.Target, attempt, f.formatDuration(operation.Duration), errText})
+			count++
+		}
+	}
+	if count == 0 {
+		return ""
+	}
+
+	t.Render()
+	return t.buf.String()
+}
+
+// formatAddressTable 格式化多地址模式下各地址的检测结果表格
+func (f *Formatter) formatAddressTable(addresses []types.AddressResult) string {
+	t := newExplainTable()
+	t.AppendHeader(table.Row{"地址", "位置", "ASN", "TLS", "X25519", "H2", "证书", "握手", "结果"})
+
+	for _, address := range addresses {
+		ip := address.IP
+		if ip == "" {
+			ip = "-"
+		}
+		if address.Primary {
+			ip += "（选定）"
+		}
+		country, asn := "-", "-"
+		if address.Location != nil {
+			country = address.Location.Country
+			if address.Location.ASN != "" {
+				asn = address.Location.ASN
+			}
+		}
+
+		outcome := text.FgGreen.Sprint("通过")
+		if !address.Passed {
+			outcome = text.FgRed.Sprint("未通过")
+			if address.Verdict != nil {
+				outcome = text.FgRed.Sprintf("未通过（%s）", address.Verdict.String())
+			}
+		}
+
+		if address.TLS == nil {
+			t.AppendRow(table.Row{ip, country, asn, "-", "-", "-", "-", "-", outcome})
+			continue
+		}
+		cert := "无效"
+		if address.Certificate != nil && address.Certificate.Valid {
+			cert = fmt.Sprintf("有效（%d天）", address.Certificate.DaysUntilExpiry)
+		}
+		t.AppendRow(table.Row{
+			ip, country, asn, address.TLS.ProtocolVersion,
+			formatBool(address.TLS.SupportsX25519), formatBool(address.TLS.SupportsHTTP2),
+			cert, f.formatDuration(address.TLS.HandshakeTime), outcome,
+		})
+	}
+
+	t.Render()
+	return t.buf.String()
+}
+
+// formatBool 格式化是否支持
+func formatBool(ok bool) string {
+	if ok {
+		return "是"
+	}
+	return "否"
+}
+
+// formatLatencyTable 格式化延迟采样的统计表格，没有采样时返回空字符串
+func (f *Formatter) formatLatencyTable(tls *types.TLSResult) string {
+	if tls == nil || tls.Latency == nil {
+		return ""
+	}
+	t := newExplainTable()
+	t.AppendHeader(table.Row{"阶段", "样本", "最小", "中位数", "P95", "抖动"})
+	rows := []struct {
+		name  string
+		stats types.LatencyStats
+	}{
+		{"TCP连接", tls.Latency.TCP},
+		{"TLS握手", tls.Latency.Handshake},
+		{"首字节", tls.Latency.TTFB},
+	}
+	for _, row := range rows {
+		if len(row.stats.Samples) == 0 {
+			t.AppendRow(table.Row{row.name, 0, "-", "-", "-", "-"})
+			continue
+		}
+		t.AppendRow(table.Row{
+			row.name, len(row.stats.Samples), f.formatDuration(row.stats.Min), f.formatDuration(row.stats.Median),
+			f.formatDuration(row.stats.P95), f.formatDuration(row.stats.Jitter),
+		})
+	}
+
+	t.Render()
+	return t.buf.String()
+}
+
+// formatRuleTable 格式化策略规则表格
+func (f *Formatter) formatRuleTable(rules []types.RuleOutcome) string {
+	t := newExplainTable()
+	t.AppendHeader(table.Row{"规则", "结果", "说明"})
+
+	for _, rule := range rules {
+		if rule.Passed {
+			t.AppendRow(table.Row{rule.Rule, text.FgGreen.Sprint("通过"), "-"})
+			continue
+		}
+		t.AppendRow(table.Row{rule.Rule, text.FgRed.Sprint("未通过"), rule.Verdict.String()})
+	}
+
+	t.Render()
+	return t.buf.String()
+}
+
+// formatFactorTable 格式化评分因子表格
+func (f *Formatter) formatFactorTable(score *types.ScoreResult) string {
+	t := newExplainTable()
+	t.AppendHeader(table.Row{"因子", "说明", "权重", "观察值", "结果", "贡献"})
+
+	for _, factor := range score.Factors {
+		observed := factor.Observed
+		if observed == "" {
+			observed = "-"
+		}
+
+		var outcome string
+		switch {
+		case !factor.Available:
+			outcome = text.FgHiBlack.Sprint("无数据")
+		case factor.Passed:
+			outcome = text.FgGreen.Sprint("通过")
+		default:
+			outcome = text.FgRed.Sprint("未通过")
+		}
+
+		t.AppendRow(table.Row{
+			factor.Name, factor.Description, fmt.Sprintf("%g", factor.Weight),
+			observed, outcome, fmt.Sprintf("%.1f", factor.Contribution),
+		})
+	}
+
+	t.Render()
+	return t.buf.String()
+}
+
+// formatStageOutcome 格式化阶段结论
+func formatStageOutcome(outcome types.StageOutcome) string {
+	switch outcome {
+	case types.StageOutcomePassed:
+		return text.FgGreen.Sprint("通过")
+	case types.StageOutcomeFailed:
+		return text.FgRed.Sprint("未通过")
+	default:
+		return text.FgYellow.Sprint("跳过")
+	}
+}
+
+// explainTable 输出到缓冲区的表格
+type explainTable struct {
+	table.Writer
+	buf *strings.Builder
+}
+
+// newExplainTable 创建与检测结果表格风格一致的表格
+func newExplainTable() *explainTable {
+	buf := &strings.Builder{}
+	t := table.NewWriter()
+	t.SetOutputMirror(buf)
+
+	t.SetStyle(table.StyleDefault)
+	t.Style().Options.SeparateRows = true
+	t.Style().Options.SeparateColumns = true
+	t.Style().Options.DrawBorder = true
+	t.Style().Options.SeparateHeader = true
+
+	t.Style().Color.Header = []text.Color{text.FgHiWhite, text.Bold}
+	t.Style().Color.Row = []text.Color{text.FgWhite}
+	t.Style().Color.Border = []text.Color{text.FgWhite}
+
+	return &explainTable{Writer: t, buf: buf}
+}
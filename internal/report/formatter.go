@@ -29,19 +29,81 @@ func (f *Formatter) FormatSingleResult(result *types.DetectionResult) string {
 
 	// 显示域名检测结果表格（无论适合与否）
 	output.WriteString("检测结果:\n\n")
+	if result.Cached {
+		output.WriteString(fmt.Sprintf("缓存结果，检测于 %s（使用 --refresh 重新检测）\n\n", result.StartTime.Format("2006-01-02 15:04:05")))
+	}
 	output.WriteString(tableFormatter.FormatSuitableTable([]*types.DetectionResult{result}))
 	output.WriteString("\n")
+	if source := f.formatSource(result); source != "" {
+		output.WriteString(source + "\n\n")
+	}
+	if latency := f.formatLatencyTable(result.TLS); latency != "" {
+		output.WriteString(fmt.Sprintf("延迟采样（%d/%d次成功）:\n", result.TLS.Latency.Samples, result.TLS.Latency.Attempts))
+		output.WriteString(latency)
+		output.WriteString("\n")
+	}
+	if len(result.Addresses) > 0 {
+		output.WriteString("各地址检测:\n")
+		output.WriteString(f.formatAddressTable(result.Addresses))
+		output.WriteString("\n")
+	}
+	if families := f.formatFamilies(result); families != "" {
+		output.WriteString(families + "\n\n")
+	}
 
 	// 如果不适合，显示不适合的原因
-	if !result.Suitable || result.Error != nil {
-		var unsuitableResults []*types.DetectionResult
-		unsuitableResults = append(unsuitableResults, result)
-		output.WriteString(tableFormatter.FormatUnsuitableSummary(unsuitableResults))
+	if !result.Suitable {
+		output.WriteString(fmt.Sprintf("不适合: %s\n", result.Reason()))
+		if result.Verdict != nil {
+			output.WriteString(fmt.Sprintf("原因代码: %s\n", result.Verdict.Code))
+		}
+		output.WriteString("\n")
 	}
 
 	return output.String()
 }
 
+// formatSource 配置了源地址或网卡时说明本次检测实际使用的本地地址
+func (f *Formatter) formatSource(result *types.DetectionResult) string {
+	if f.config == nil {
+		return ""
+	}
+	configured := f.config.Network.SourceAddress
+	if f.config.Network.Interface != "" {
+		configured = "网卡 " + f.config.Network.Interface
+	}
+	if configured == "" {
+		return ""
+	}
+	if result.TLS == nil || result.TLS.LocalAddress == "" {
+		return fmt.Sprintf("源地址: %s", configured)
+	}
+	return fmt.Sprintf("源地址: %s（%s）", result.TLS.LocalAddress, configured)
+}
+
+// formatFamilies 双栈模式下各地址族的结论，未启用双栈模式时返回空字符串
+func (f *Formatter) formatFamilies(result *types.DetectionResult) string {
+	if len(result.Families) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(result.Families))
+	for _, family := range result.Families {
+		name := family.Family
+		if family.IP != "" {
+			name = fmt.Sprintf("%s %s", family.Family, family.IP)
+		}
+		switch {
+		case family.Passed:
+			parts = append(parts, fmt.Sprintf("%s 适合", name))
+		case family.Verdict != nil:
+			parts = append(parts, fmt.Sprintf("%s 不适合（%s）", name, family.Verdict.String()))
+		default:
+			parts = append(parts, fmt.Sprintf("%s 不适合", name))
+		}
+	}
+	return "地址族结论: " + strings.Join(parts, "；")
+}
+
 // FormatBatchResult 格式化批量检测结果
 func (f *Formatter) FormatBatchResult(results []*types.DetectionResult, totalDuration time.Duration) string {
 	var output strings.Builder
@@ -51,7 +113,7 @@ func (f *Formatter) FormatBatchResult(results []*types.DetectionResult, totalDur
 	successCount := 0
 
 	for _, result := range results {
-		if result.Error == nil {
+		if !result.CheckFailed() {
 			successCount++
 		}
 		if result.Suitable {
@@ -76,13 +138,13 @@ func (f *Formatter) FormatBatchResult(results []*types.DetectionResult, totalDur
 	// 详细结果
 	output.WriteString("详细结果:\n")
 	for i, result := range results {
-		output.WriteString(fmt.Sprintf("%d. %s: 适合=%t", i+1, result.Domain, result.Suitable))
+		output.WriteString(fmt.Sprintf("%d. %s: 适合=%t", i+1, result.Target(), result.Suitable))
 
 		// 网络信息
 		if result.Network != nil {
 			if result.Network.IsRedirected {
 				output.WriteString(fmt.Sprintf(", 重定向: %s->%s, 状态码=%d",
-					result.Domain, result.Network.FinalDomain, result.Network.StatusCode))
+					result.Target(), result.FinalTarget(), result.Network.StatusCode))
 			} else {
 				output.WriteString(fmt.Sprintf(", 状态码=%d", result.Network.StatusCode))
 			}
@@ -93,8 +155,8 @@ func (f *Formatter) FormatBatchResult(results []*types.DetectionResult, totalDur
 			output.WriteString(fmt.Sprintf(", TLS1.3=%t, X25519=%t, HTTP2=%t",
 				result.TLS.SupportsTLS13, result.TLS.SupportsX25519, result.TLS.SupportsHTTP2))
 
-			if result.TLS.HandshakeTime > 0 {
-				handshakeMs := int(result.TLS.HandshakeTime.Milliseconds())
+			if result.TLS.Handshake() > 0 {
+				handshakeMs := int(result.TLS.Handshake().Milliseconds())
 				output.WriteString(fmt.Sprintf(", 握手时间=%dms", handshakeMs))
 			}
 		}
@@ -114,11 +176,32 @@ func (f *Formatter) FormatBatchResult(results []*types.DetectionResult, totalDur
 			output.WriteString(fmt.Sprintf(", 位置=%s", result.Location.Country))
 		}
 
+		// 多地址模式下通过检测的地址数
+		if len(result.Addresses) > 0 {
+			passed := 0
+			for _, address := range result.Addresses {
+				if address.Passed {
+					passed++
+				}
+			}
+			output.WriteString(fmt.Sprintf(", 地址通过=%d/%d", passed, len(result.Addresses)))
+		}
+
+		// 双栈模式下各地址族的结论
+		for _, family := range result.Families {
+			output.WriteString(fmt.Sprintf(", %s适合=%t", family.Family, family.Passed))
+		}
+
 		// CDN信息（批量检测中不显示详细特征）
 		if result.CDN != nil && result.CDN.IsCDN {
 			output.WriteString(fmt.Sprintf(", CDN=%s(%s)", result.CDN.CDNProvider, result.CDN.Confidence))
 		}
 
+		// 不适合原因
+		if result.Verdict != nil {
+			output.WriteString(fmt.Sprintf(", 原因=%s(%s)", result.Verdict.Code, result.Verdict.String()))
+		}
+
 		// 错误信息
 		if result.Error != nil {
 			output.WriteString(fmt.Sprintf(", 错误=%v", result.Error))
@@ -0,0 +1,23 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"RealityChecker/internal/types"
+)
+
+// WriteJSONReport 将批量报告以JSON格式写入文件
+func WriteJSONReport(path string, report *types.BatchReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化报告失败: %v", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("写入报告文件失败: %v", err)
+	}
+
+	return nil
+}
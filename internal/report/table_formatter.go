@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"RealityChecker/internal/scoring"
 	"RealityChecker/internal/types"
 
 	"github.com/jedib0t/go-pretty/v6/table"
@@ -13,12 +14,14 @@ import (
 // TableFormatter 表格格式化器
 type TableFormatter struct {
 	config *types.Config
+	scorer *scoring.Scorer
 }
 
 // NewTableFormatter 创建表格格式化器
 func NewTableFormatter(config *types.Config) *TableFormatter {
 	return &TableFormatter{
 		config: config,
+		scorer: scoring.NewScorer(config),
 	}
 }
 
@@ -61,11 +64,8 @@ func (tf *TableFormatter) FormatSuitableTable(results []*types.DetectionResult)
 
 	// 添加数据行
 	for _, result := range results {
-		// 最终域名
-		finalDomain := result.Domain
-		if result.Network != nil && result.Network.FinalDomain != "" {
-			finalDomain = result.Network.FinalDomain
-		}
+		// 最终域名，非默认端口时带端口
+		finalDomain := result.FinalTarget()
 
 		// 基础条件（TLS1.3 + X25519 + H2 + SNI匹配）
 		var basicConditionsText string
@@ -86,12 +86,12 @@ func (tf *TableFormatter) FormatSuitableTable(results []*types.DetectionResult)
 
 		// 握手时间
 		var handshakeText string
-		if result.TLS != nil && result.TLS.HandshakeTime > 0 {
-			handshakeMs := int(result.TLS.HandshakeTime.Milliseconds())
+		if result.TLS != nil && result.TLS.Handshake() > 0 {
+			handshakeMs := int(result.TLS.Handshake().Milliseconds())
 			handshakeText = fmt.Sprintf("%dms", handshakeMs)
 
-			// 根据时间设置颜色
-			if handshakeMs <= 200 {
+			// 根据时间设置颜色（绿色阈值与评分一致）
+			if result.TLS.Handshake() <= tf.scorer.MaxHandshake() {
 				handshakeText = text.FgGreen.Sprint(handshakeText)
 			} else if handshakeMs <= 500 {
 				handshakeText = text.FgYellow.Sprint(handshakeText)
@@ -108,8 +108,8 @@ func (tf *TableFormatter) FormatSuitableTable(results []*types.DetectionResult)
 			days := result.Certificate.DaysUntilExpiry
 			certText = fmt.Sprintf("%d天", days)
 
-			// 根据剩余天数设置颜色
-			if days >= 60 {
+			// 根据剩余天数设置颜色（绿色阈值与评分一致）
+			if days >= tf.scorer.MinCertDays() {
 				certText = text.FgGreen.Sprint(certText)
 			} else if days >= 30 {
 				certText = text.FgYellow.Sprint(certText)
@@ -194,19 +194,30 @@ func (tf *TableFormatter) FormatUnsuitableSummary(results []*types.DetectionResu
 	var buf strings.Builder
 	buf.WriteString(fmt.Sprintf("不适合的域名 (%d个):\n", len(results)))
 
-	// 统计各种不适合的原因
-	reasonCounts := make(map[string]int)
+	// 按原因代码统计，文案变化不影响分组
+	reasonCounts := make(map[types.ReasonCode]int)
+	var reasonOrder []types.ReasonCode
+	otherCount := 0
 
 	for _, result := range results {
-		if result.Error != nil {
-			reason := result.Error.Error()
-			reasonCounts[reason]++
+		if result.Verdict == nil {
+			if result.Error != nil {
+				otherCount++
+			}
+			continue
 		}
+		if reasonCounts[result.Verdict.Code] == 0 {
+			reasonOrder = append(reasonOrder, result.Verdict.Code)
+		}
+		reasonCounts[result.Verdict.Code]++
 	}
 
 	// 显示统计信息，按原因分组
-	for reason, count := range reasonCounts {
-		buf.WriteString(fmt.Sprintf("   - %d个%s\n", count, reason))
+	for _, code := range reasonOrder {
+		buf.WriteString(fmt.Sprintf("   - %d个%s\n", reasonCounts[code], code.Message()))
+	}
+	if otherCount > 0 {
+		buf.WriteString(fmt.Sprintf("   - %d个检测错误\n", otherCount))
 	}
 
 	// 添加空行，与后续输出拉开距离
@@ -222,43 +233,14 @@ func (tf *TableFormatter) calculateRecommendationStars(result *types.DetectionRe
 		return text.FgRed.Sprint("无效")
 	}
 
-	stars := 0
-
-	// 1. TLS硬性条件检查 (TLS1.3 + X25519 + H2 + SNI匹配)
-	if result.TLS != nil && result.TLS.SupportsTLS13 &&
-		result.TLS.SupportsX25519 && result.TLS.SupportsHTTP2 &&
-		result.SNI != nil && result.SNI.SNIMatch {
-		stars++
-	}
-
-	// 2. 握手时间延迟小 (<= 200ms)
-	if result.TLS != nil && result.TLS.HandshakeTime > 0 {
-		handshakeMs := int(result.TLS.HandshakeTime.Milliseconds())
-		if handshakeMs <= 200 {
-			stars++
-		}
-	}
-
-	// 3. 没有CDN (不使用CDN更安全)
-	if result.CDN == nil || !result.CDN.IsCDN {
-		stars++
-	}
-
-	// 4. 不是热门网站 (热门网站不推荐作为Reality目标)
-	if result.CDN != nil && !result.CDN.IsHotWebsite {
-		stars++
-	}
-
-	// 5. 证书时间长 (>= 60天)
-	if result.Certificate != nil && result.Certificate.Valid {
-		if result.Certificate.DaysUntilExpiry >= 60 {
-			stars++
-		}
+	score := result.Score
+	if score == nil {
+		score = tf.scorer.Score(result)
 	}
 
 	// 生成星级显示 - 只显示实际获得的星级
 	var starsText string
-	for i := 0; i < stars; i++ {
+	for i := 0; i < score.Stars; i++ {
 		starsText += text.FgYellow.Sprint("*")
 	}
 
@@ -0,0 +1,307 @@
+package scoring
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"RealityChecker/internal/types"
+)
+
+// 评分因子名称
+const (
+	FactorBasicTLS      = "basic_tls"      // TLS1.3 + X25519 + H2 + SNI匹配
+	FactorHandshake     = "handshake"      // 握手时间
+	FactorNoCDN         = "no_cdn"         // 未使用CDN
+	FactorNotHot        = "not_hot"        // 非热门网站
+	FactorCertDays      = "cert_days"      // 证书剩余天数
+	FactorJitter        = "jitter"         // 握手抖动
+	FactorSameASN       = "same_asn"       // 与VPS同ASN
+	FactorCertIssuer    = "cert_issuer"    // 偏好的证书签发者
+	FactorRedirectCount = "redirect_count" // 重定向次数
+)
+
+// 默认阈值
+const (
+	DefaultMaxHandshake = 200 * time.Millisecond
+	DefaultMinCertDays  = 60
+	DefaultMaxJitter    = 50 * time.Millisecond
+	DefaultMaxRedirects = 0
+)
+
+// DefaultWeights 默认权重：原有五项各占一星，新增因子默认不参与评分
+var DefaultWeights = map[string]float64{
+	FactorBasicTLS:      1,
+	FactorHandshake:     1,
+	FactorNoCDN:         1,
+	FactorNotHot:        1,
+	FactorCertDays:      1,
+	FactorJitter:        0,
+	FactorSameASN:       0,
+	FactorCertIssuer:    0,
+	FactorRedirectCount: 0,
+}
+
+// factorOrder 因子的显示顺序
+var factorOrder = []string{
+	FactorBasicTLS,
+	FactorHandshake,
+	FactorNoCDN,
+	FactorNotHot,
+	FactorCertDays,
+	FactorJitter,
+	FactorSameASN,
+	FactorCertIssuer,
+	FactorRedirectCount,
+}
+
+// maxStars 满分对应的星级
+const maxStars = 5
+
+// factorOutcome 单个因子的评估结果
+type factorOutcome struct {
+	available bool
+	passed    bool
+	observed  string
+}
+
+// Scorer 推荐评分器
+type Scorer struct {
+	weights          map[string]float64
+	maxHandshake     time.Duration
+	minCertDays      int
+	maxJitter        time.Duration
+	maxRedirects     int
+	preferredIssuers []string
+	vpsASN           string
+}
+
+// NewScorer 创建评分器，未配置的权重和阈值使用默认值
+func NewScorer(config *types.Config) *Scorer {
+	scorer := &Scorer{
+		weights:      make(map[string]float64),
+		maxHandshake: DefaultMaxHandshake,
+		minCertDays:  DefaultMinCertDays,
+		maxJitter:    DefaultMaxJitter,
+		maxRedirects: DefaultMaxRedirects,
+	}
+	for name, weight := range DefaultWeights {
+		scorer.weights[name] = weight
+	}
+
+	if config == nil {
+		return scorer
+	}
+
+	cfg := config.Scoring
+	for name, weight := range cfg.Weights {
+		if weight >= 0 {
+			scorer.weights[name] = weight
+		}
+	}
+	if cfg.MaxHandshake > 0 {
+		scorer.maxHandshake = cfg.MaxHandshake
+	}
+	if cfg.MinCertDays > 0 {
+		scorer.minCertDays = cfg.MinCertDays
+	}
+	if cfg.MaxJitter > 0 {
+		scorer.maxJitter = cfg.MaxJitter
+	}
+	if cfg.MaxRedirects >= 0 {
+		scorer.maxRedirects = cfg.MaxRedirects
+	}
+	scorer.preferredIssuers = cfg.PreferredIssuers
+	scorer.vpsASN = normalizeASN(cfg.VPSASN)
+
+	return scorer
+}
+
+// MaxHandshake 握手时间阈值
+func (s *Scorer) MaxHandshake() time.Duration {
+	return s.maxHandshake
+}
+
+// MinCertDays 证书剩余天数阈值
+func (s *Scorer) MinCertDays() int {
+	return s.minCertDays
+}
+
+// Score 计算推荐评分
+// 总分 = Σ(权重 × 是否通过) / Σ(有数据的因子权重) × 100，星级按总分等比折算
+func (s *Scorer) Score(result *types.DetectionResult) *types.ScoreResult {
+	score := &types.ScoreResult{}
+
+	var totalWeight float64
+	outcomes := make(map[string]factorOutcome)
+	for _, name := range factorOrder {
+		outcome := s.evaluate(name, result)
+		outcomes[name] = outcome
+		if outcome.available {
+			totalWeight += s.weights[name]
+		}
+	}
+
+	for _, name := range factorOrder {
+		outcome := outcomes[name]
+		factor := types.ScoreFactor{
+			Name:        name,
+			Description: factorDescriptions[name],
+			Weight:      s.weights[name],
+			Available:   outcome.available,
+			Passed:      outcome.passed,
+			Observed:    outcome.observed,
+		}
+		if outcome.available && outcome.passed && totalWeight > 0 {
+			factor.Contribution = factor.Weight / totalWeight * 100
+		}
+		score.Total += factor.Contribution
+		score.Factors = append(score.Factors, factor)
+	}
+
+	score.Stars = int(math.Round(score.Total / 100 * maxStars))
+	return score
+}
+
+// factorDescriptions 因子说明
+var factorDescriptions = map[string]string{
+	FactorBasicTLS:      "TLS1.3、X25519、H2、SNI匹配",
+	FactorHandshake:     "握手时间",
+	FactorNoCDN:         "未使用CDN",
+	FactorNotHot:        "非热门网站",
+	FactorCertDays:      "证书剩余天数",
+	FactorJitter:        "握手抖动",
+	FactorSameASN:       "与VPS同ASN",
+	FactorCertIssuer:    "偏好的证书签发者",
+	FactorRedirectCount: "重定向次数",
+}
+
+// evaluate 评估单个因子
+func (s *Scorer) evaluate(name string, result *types.DetectionResult) factorOutcome {
+	switch name {
+	case FactorBasicTLS:
+		passed := result.TLS != nil && result.TLS.SupportsTLS13 &&
+			result.TLS.SupportsX25519 && result.TLS.SupportsHTTP2 &&
+			result.SNI != nil && result.SNI.SNIMatch
+		return factorOutcome{available: true, passed: passed}
+
+	case FactorHandshake:
+		if result.TLS == nil || result.TLS.Handshake() <= 0 {
+			return factorOutcome{available: true, observed: "N/A"}
+		}
+		observed := fmt.Sprintf("%dms（阈值%dms）", result.TLS.Handshake().Milliseconds(), s.maxHandshake.Milliseconds())
+		if result.TLS.Latency != nil {
+			observed = fmt.Sprintf("中位数%dms（%d次采样，阈值%dms）", result.TLS.Handshake().Milliseconds(), result.TLS.Latency.Samples, s.maxHandshake.Milliseconds())
+		}
+		return factorOutcome{
+			available: true,
+			passed:    result.TLS.Handshake() <= s.maxHandshake,
+			observed:  observed,
+		}
+
+	case FactorNoCDN:
+		if result.CDN != nil && result.CDN.IsCDN {
+			return factorOutcome{available: true, observed: fmt.Sprintf("%s(%s)", result.CDN.CDNProvider, result.CDN.Confidence)}
+		}
+		return factorOutcome{available: true, passed: true}
+
+	case FactorNotHot:
+		// 未执行热门网站检测时不得分
+		if result.CDN == nil {
+			return factorOutcome{available: true, observed: "未检测"}
+		}
+		return factorOutcome{available: true, passed: !result.CDN.IsHotWebsite}
+
+	case FactorCertDays:
+		if result.Certificate == nil || !result.Certificate.Valid {
+			return factorOutcome{available: true, observed: "证书无效"}
+		}
+		return factorOutcome{
+			available: true,
+			passed:    result.Certificate.DaysUntilExpiry >= s.minCertDays,
+			observed:  fmt.Sprintf("%d天（阈值%d天）", result.Certificate.DaysUntilExpiry, s.minCertDays),
+		}
+
+	case FactorJitter:
+		jitter, ok := handshakeJitter(result)
+		if !ok {
+			return factorOutcome{}
+		}
+		return factorOutcome{
+			available: true,
+			passed:    jitter <= s.maxJitter,
+			observed:  fmt.Sprintf("%dms（阈值%dms）", jitter.Milliseconds(), s.maxJitter.Milliseconds()),
+		}
+
+	case FactorSameASN:
+		if s.vpsASN == "" || result.Location == nil || result.Location.ASN == "" {
+			return factorOutcome{}
+		}
+		return factorOutcome{
+			available: true,
+			passed:    normalizeASN(result.Location.ASN) == s.vpsASN,
+			observed:  result.Location.ASN,
+		}
+
+	case FactorCertIssuer:
+		if len(s.preferredIssuers) == 0 || result.Certificate == nil {
+			return factorOutcome{}
+		}
+		issuer := strings.ToLower(result.Certificate.Issuer)
+		for _, preferred := range s.preferredIssuers {
+			if preferred != "" && strings.Contains(issuer, strings.ToLower(preferred)) {
+				return factorOutcome{available: true, passed: true, observed: result.Certificate.Issuer}
+			}
+		}
+		return factorOutcome{available: true, observed: result.Certificate.Issuer}
+
+	case FactorRedirectCount:
+		if result.Network == nil {
+			return factorOutcome{}
+		}
+		return factorOutcome{
+			available: true,
+			passed:    result.Network.RedirectCount <= s.maxRedirects,
+			observed:  fmt.Sprintf("%d次（上限%d次）", result.Network.RedirectCount, s.maxRedirects),
+		}
+	}
+
+	return factorOutcome{}
+}
+
+// handshakeJitter 计算握手抖动，样本不足时返回false
+// 有延迟采样时使用TLS握手的抖动，否则为各次握手中最大与最小耗时之差
+func handshakeJitter(result *types.DetectionResult) (time.Duration, bool) {
+	if result.TLS == nil {
+		return 0, false
+	}
+	if latency := result.TLS.Latency; latency != nil && len(latency.Handshake.Samples) >= 2 {
+		return latency.Handshake.Jitter, true
+	}
+	if len(result.TLS.HandshakeSamples) < 2 {
+		return 0, false
+	}
+	minTime, maxTime := result.TLS.HandshakeSamples[0], result.TLS.HandshakeSamples[0]
+	for _, sample := range result.TLS.HandshakeSamples[1:] {
+		if sample < minTime {
+			minTime = sample
+		}
+		if sample > maxTime {
+			maxTime = sample
+		}
+	}
+	return maxTime - minTime, true
+}
+
+// normalizeASN 统一ASN格式为 AS12345
+func normalizeASN(asn string) string {
+	asn = strings.ToUpper(strings.TrimSpace(asn))
+	if asn == "" {
+		return ""
+	}
+	if !strings.HasPrefix(asn, "AS") {
+		asn = "AS" + asn
+	}
+	return asn
+}
@@ -2,20 +2,36 @@ package types
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 // DetectionResult 检测结果
 type DetectionResult struct {
 	Domain              string        `json:"domain"`
+	Port                int           `json:"port,omitempty"`       // 检测的端口，0表示默认端口443
+	ConnectIP           string        `json:"connect_ip,omitempty"` // 指定的连接地址，为空时解析域名
 	Index               int           `json:"index"`
 	StartTime           time.Time     `json:"start_time"`
 	Duration            time.Duration `json:"duration"`
 	Suitable            bool          `json:"suitable"`
-	Error               error         `json:"error,omitempty"`
+	Verdict             *Verdict      `json:"verdict,omitempty"` // 不适合的结论，适合时为空
+	Error               error         `json:"-"`                 // 技术错误，详情见 StageErrors
 	HardRequirementsMet bool          `json:"hard_requirements_met"`
 	EarlyExit           bool          `json:"early_exit"`                     // 是否早期退出
 	StatusCodeCategory  string        `json:"status_code_category,omitempty"` // 状态码分类
+	StageErrors         []StageError  `json:"stage_errors,omitempty"`         // 各检测阶段的错误
+	Stages              []StageReport `json:"stages,omitempty"`               // 各检测阶段的执行记录
+	Rules               []RuleOutcome `json:"rules,omitempty"`                // 各策略规则的评估结果
+	Cached              bool          `json:"cached,omitempty"`               // 结果来自缓存，StartTime 为实际检测时间
 
 	// 检测结果
 	Network     *NetworkResult     `json:"network,omitempty"`
@@ -26,7 +42,359 @@ type DetectionResult struct {
 	PageStatus  *PageStatusResult  `json:"page_status,omitempty"`
 	Blocked     *BlockedResult     `json:"blocked,omitempty"`
 	Location    *LocationResult    `json:"location,omitempty"`
+	Addresses   []AddressResult    `json:"addresses,omitempty"` // 多地址模式下每个A/AAAA记录的检测结果
+	IPv6        *AddressResult     `json:"ipv6,omitempty"`      // 双栈模式下IPv6地址的检测结果
+	Families    []FamilyResult     `json:"families,omitempty"`  // 双栈模式下各地址族的结论
 	Summary     *DetectionSummary  `json:"summary,omitempty"`
+	Score       *ScoreResult       `json:"score,omitempty"`
+}
+
+// DefaultPort 检测目标未指定端口时使用的端口
+const DefaultPort = "443"
+
+// SplitTarget 拆分 host:port 形式的检测目标，未指定端口时使用 DefaultPort
+// IPv6地址带端口时需写成 [2001:db8::1]:8443
+func SplitTarget(target string) (host, port string) {
+	if host, port, err := net.SplitHostPort(target); err == nil {
+		return host, port
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(target, "["), "]"), DefaultPort
+}
+
+// JoinTarget 组合检测目标，默认端口省略
+func JoinTarget(host, port string) string {
+	if port == "" || port == DefaultPort {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// Target 检测目标：连接地址和SNI
+// 一般只指定域名，连接地址由域名解析得到；指定IP时直接连接该地址，域名只用作SNI和Host
+type Target struct {
+	Domain string // 域名，用作SNI和HTTP Host
+	Port   string // 端口
+	IP     string // 指定的连接地址，为空时解析域名
+}
+
+// ParseTarget 解析检测目标
+// 支持 example.com、example.com:8443、1.2.3.4@example.com、1.2.3.4:8443@example.com
+// 和 [2001:db8::1]:8443@example.com；指定IP时端口也可写在域名一侧
+func ParseTarget(target string) Target {
+	at := strings.LastIndex(target, "@")
+	if at < 0 {
+		domain, port := SplitTarget(target)
+		return Target{Domain: domain, Port: port}
+	}
+
+	ip, port := SplitTarget(target[:at])
+	domain, domainPort := SplitTarget(target[at+1:])
+	if port == DefaultPort {
+		port = domainPort
+	}
+	return Target{Domain: domain, Port: port, IP: ip}
+}
+
+// String 检测目标的规范写法，默认端口省略
+func (t Target) String() string {
+	if t.IP == "" {
+		return JoinTarget(t.Domain, t.Port)
+	}
+	return JoinTarget(t.IP, t.Port) + "@" + t.Domain
+}
+
+// NewTargetResult 创建检测目标的结果，target 的写法见 ParseTarget
+func NewTargetResult(target string) *DetectionResult {
+	parsed := ParseTarget(target)
+	number, _ := strconv.Atoi(parsed.Port)
+	return &DetectionResult{Domain: parsed.Domain, Port: number, ConnectIP: parsed.IP}
+}
+
+// Target 检测目标，非默认端口时带端口，指定连接地址时带地址
+func (r *DetectionResult) Target() string {
+	port := DefaultPort
+	if r.Port != 0 {
+		port = strconv.Itoa(r.Port)
+	}
+	return Target{Domain: r.Domain, Port: port, IP: r.ConnectIP}.String()
+}
+
+// FinalTarget 重定向后的最终目标，未重定向时与 Target 相同
+// 指定连接地址时TLS检测始终针对该地址和域名，也与 Target 相同
+func (r *DetectionResult) FinalTarget() string {
+	if r.ConnectIP != "" || r.Network == nil || r.Network.FinalDomain == "" || !r.Network.IsRedirected {
+		return r.Target()
+	}
+	return JoinTarget(r.Network.FinalDomain, r.Network.FinalPort())
+}
+
+// ReasonCode 不适合原因代码（机器可读，不随本地化文案变化）
+type ReasonCode string
+
+// ReasonCode 常量
+const (
+	ReasonBlocked       ReasonCode = "BLOCKED"        // 域名被墙
+	ReasonDomestic      ReasonCode = "DOMESTIC"       // 国内网站
+	ReasonNoTLS13       ReasonCode = "NO_TLS13"       // 不支持TLS 1.3
+	ReasonNoX25519      ReasonCode = "NO_X25519"      // 不支持X25519
+	ReasonNoH2          ReasonCode = "NO_H2"          // 不支持HTTP/2
+	ReasonSNIMismatch   ReasonCode = "SNI_MISMATCH"   // SNI不匹配
+	ReasonCertInvalid   ReasonCode = "CERT_INVALID"   // 证书无效
+	ReasonCertExpired   ReasonCode = "CERT_EXPIRED"   // 证书已过期
+	ReasonBadStatus     ReasonCode = "BAD_STATUS"     // 状态码不自然
+	ReasonUnreachable   ReasonCode = "UNREACHABLE"    // 网络不可达
+	ReasonTimeout       ReasonCode = "TIMEOUT"        // 检测超时
+	ReasonCanceled      ReasonCode = "CANCELED"       // 检测被取消
+	ReasonSkipped       ReasonCode = "SKIPPED"        // 时间预算用完，未检测
+	ReasonSlowHandshake ReasonCode = "SLOW_HANDSHAKE" // 握手时间过长
+	ReasonAddresses     ReasonCode = "ADDRESSES"      // 通过检测的地址不足
+	ReasonIPv6          ReasonCode = "IPV6"           // IPv6地址不适合
+)
+
+// reasonMessages 原因代码对应的说明文案
+var reasonMessages = map[ReasonCode]string{
+	ReasonBlocked:       "域名被墙",
+	ReasonDomestic:      "国内网站",
+	ReasonNoTLS13:       "不支持TLS 1.3",
+	ReasonNoX25519:      "不支持X25519密钥交换",
+	ReasonNoH2:          "不支持HTTP/2",
+	ReasonSNIMismatch:   "SNI不匹配",
+	ReasonCertInvalid:   "证书无效",
+	ReasonCertExpired:   "证书已过期",
+	ReasonBadStatus:     "状态码不自然",
+	ReasonUnreachable:   "网络不可达",
+	ReasonTimeout:       "检测超时",
+	ReasonCanceled:      "检测被取消",
+	ReasonSkipped:       "未检测（时间预算已用完）",
+	ReasonSlowHandshake: "握手时间过长",
+	ReasonAddresses:     "通过检测的地址不足",
+	ReasonIPv6:          "IPv6地址不适合",
+}
+
+// Message 原因代码的说明文案
+func (c ReasonCode) Message() string {
+	if message, ok := reasonMessages[c]; ok {
+		return message
+	}
+	return string(c)
+}
+
+// IsCheckFailure 是否属于检测未完成（技术失败），而不是对目标的明确结论
+func (c ReasonCode) IsCheckFailure() bool {
+	return c == ReasonUnreachable || c == ReasonTimeout || c == ReasonCanceled || c == ReasonSkipped
+}
+
+// Verdict 不适合的结论
+type Verdict struct {
+	Code    ReasonCode `json:"code"`
+	Message string     `json:"message"`
+	Details string     `json:"details,omitempty"`
+	Rule    string     `json:"rule,omitempty"` // 未通过的策略规则
+}
+
+// NewVerdict 创建结论，说明文案由原因代码决定
+func NewVerdict(code ReasonCode, details string) *Verdict {
+	return &Verdict{
+		Code:    code,
+		Message: code.Message(),
+		Details: details,
+	}
+}
+
+// String 结论的完整描述
+func (v *Verdict) String() string {
+	if v.Details == "" {
+		return v.Message
+	}
+	return fmt.Sprintf("%s: %s", v.Message, v.Details)
+}
+
+// CheckFailed 检测是否未能完成（技术错误、不可达或超时）
+func (r *DetectionResult) CheckFailed() bool {
+	if r.Error != nil {
+		return true
+	}
+	return r.Verdict != nil && r.Verdict.Code.IsCheckFailure()
+}
+
+// Reason 不适合原因的描述，供进度和报告显示
+func (r *DetectionResult) Reason() string {
+	if r.Verdict != nil {
+		return r.Verdict.String()
+	}
+	if r.Error != nil {
+		return r.Error.Error()
+	}
+	return ""
+}
+
+// StageError 检测阶段错误
+type StageError struct {
+	Stage   string `json:"stage"`
+	Message string `json:"message"`
+	Err     error  `json:"-"`
+}
+
+// ErrStageTimeout 检测阶段超过单阶段时限
+var ErrStageTimeout = errors.New("检测阶段超时")
+
+// TimedOut 是否有检测阶段因超过单阶段时限而中断
+func (r *DetectionResult) TimedOut() bool {
+	for _, stageErr := range r.StageErrors {
+		if errors.Is(stageErr.Err, ErrStageTimeout) {
+			return true
+		}
+	}
+	return false
+}
+
+// StageOutcome 阶段结论
+type StageOutcome string
+
+// StageOutcome 常量
+const (
+	StageOutcomePassed  StageOutcome = "passed"  // 执行完成且相关规则通过
+	StageOutcomeFailed  StageOutcome = "failed"  // 出错、请求早期退出或相关规则未通过
+	StageOutcomeSkipped StageOutcome = "skipped" // 因早期退出或取消未执行
+)
+
+// StageReport 检测阶段执行记录
+type StageReport struct {
+	Name       string             `json:"name"`
+	Ran        bool               `json:"ran"`
+	StartTime  time.Time          `json:"start_time"`
+	EndTime    time.Time          `json:"end_time"`
+	Duration   time.Duration      `json:"duration"`
+	Outcome    StageOutcome       `json:"outcome"`
+	Observed   string             `json:"observed,omitempty"`
+	EarlyExit  bool               `json:"early_exit,omitempty"` // 该阶段请求了早期退出
+	Error      string             `json:"error,omitempty"`
+	Retries    int                `json:"retries,omitempty"`    // 阶段内因临时错误重试的网络操作次数
+	Operations []NetworkOperation `json:"operations,omitempty"` // 阶段内的网络操作
+}
+
+// OperationKind 网络操作类型
+type OperationKind string
+
+// OperationKind 常量
+const (
+	OperationDNS  OperationKind = "dns"  // DNS查询
+	OperationTCP  OperationKind = "tcp"  // TCP连接
+	OperationTLS  OperationKind = "tls"  // TLS握手
+	OperationHTTP OperationKind = "http" // HTTP请求
+)
+
+// NetworkOperation 单次网络操作记录
+type NetworkOperation struct {
+	Kind      OperationKind `json:"kind"`
+	Target    string        `json:"target"`
+	StartTime time.Time     `json:"start_time"`
+	Duration  time.Duration `json:"duration"`
+	Attempt   int           `json:"attempt,omitempty"` // 重试时的尝试次数（从2开始），首次尝试为空
+	Error     string        `json:"error,omitempty"`
+}
+
+// StageTrace 阶段的网络操作记录器，可被阶段内的多个协程并发写入
+type StageTrace struct {
+	mu         sync.Mutex
+	operations []NetworkOperation
+}
+
+// Record 记录一次网络操作
+func (t *StageTrace) Record(kind OperationKind, target string, start time.Time, err error) {
+	t.record(kind, target, start, 0, err)
+}
+
+// record 记录一次网络操作及其尝试次数
+func (t *StageTrace) record(kind OperationKind, target string, start time.Time, attempt int, err error) {
+	if t == nil {
+		return
+	}
+	operation := NetworkOperation{
+		Kind:      kind,
+		Target:    target,
+		StartTime: start,
+		Duration:  time.Since(start),
+	}
+	if attempt > 1 {
+		operation.Attempt = attempt
+	}
+	if err != nil {
+		operation.Error = err.Error()
+	}
+
+	t.mu.Lock()
+	t.operations = append(t.operations, operation)
+	t.mu.Unlock()
+}
+
+// Operations 按开始时间返回已记录的网络操作
+func (t *StageTrace) Operations() []NetworkOperation {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	operations := append([]NetworkOperation(nil), t.operations...)
+	sort.SliceStable(operations, func(i, j int) bool {
+		return operations[i].StartTime.Before(operations[j].StartTime)
+	})
+	return operations
+}
+
+// stageTraceKey context中保存阶段记录器的键
+type stageTraceKey struct{}
+
+// WithStageTrace 将阶段记录器挂到context上，网络层据此记录操作
+func WithStageTrace(ctx context.Context, trace *StageTrace) context.Context {
+	return context.WithValue(ctx, stageTraceKey{}, trace)
+}
+
+// StageTraceFrom 取出context上的阶段记录器，没有时返回nil
+func StageTraceFrom(ctx context.Context) *StageTrace {
+	if ctx == nil {
+		return nil
+	}
+	trace, _ := ctx.Value(stageTraceKey{}).(*StageTrace)
+	return trace
+}
+
+// StartOperation 开始记录一次网络操作，返回的函数在操作结束时调用
+func StartOperation(ctx context.Context, kind OperationKind, target string) func(error) {
+	trace := StageTraceFrom(ctx)
+	attempt := AttemptFrom(ctx)
+	start := time.Now()
+	return func(err error) {
+		trace.record(kind, target, start, attempt, err)
+	}
+}
+
+// attemptKey context中保存尝试次数的键
+type attemptKey struct{}
+
+// WithAttempt 在context上标记当前的尝试次数（从1开始），网络操作记录会带上该次数
+func WithAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// AttemptFrom 取出context上的尝试次数，不在重试中时返回0
+func AttemptFrom(ctx context.Context) int {
+	if ctx == nil {
+		return 0
+	}
+	attempt, _ := ctx.Value(attemptKey{}).(int)
+	return attempt
+}
+
+// RuleOutcome 策略规则评估结果
+type RuleOutcome struct {
+	Rule    string   `json:"rule"`
+	Passed  bool     `json:"passed"`
+	Verdict *Verdict `json:"verdict,omitempty"`
 }
 
 // StatusCodeCategory 状态码分类常量
@@ -36,30 +404,29 @@ const (
 	StatusCodeCategoryNetwork  = "network"  // 网络不可达
 )
 
-// ClassifyStatusCode 分类状态码
+// DefaultSafeStatusCodes 默认的安全状态码
+var DefaultSafeStatusCodes = []int{200, 301, 302, 404}
+
+// ClassifyStatusCode 分类状态码（使用默认安全状态码）
 func ClassifyStatusCode(statusCode int, accessible bool) string {
+	return ClassifyStatusCodeWith(statusCode, accessible, DefaultSafeStatusCodes)
+}
+
+// ClassifyStatusCodeWith 按给定的安全状态码列表分类状态码
+// 不在列表中的状态码（401、403、407、408、429、5xx等）均归类为排除
+func ClassifyStatusCodeWith(statusCode int, accessible bool, safeCodes []int) string {
 	if !accessible {
 		return StatusCodeCategoryNetwork
 	}
 
 	// 安全的状态码
-	switch statusCode {
-	case 200, 301, 302, 404:
-		return StatusCodeCategorySafe
-	}
-
-	// 排除的状态码
-	switch statusCode {
-	case 401, 403, 407, 408, 429:
-		return StatusCodeCategoryExcluded
+	for _, code := range safeCodes {
+		if statusCode == code {
+			return StatusCodeCategorySafe
+		}
 	}
 
-	// 5xx 系列
-	if statusCode >= 500 && statusCode < 600 {
-		return StatusCodeCategoryExcluded
-	}
-
-	// 其他状态码也归类为排除
+	// 其他状态码归类为排除
 	return StatusCodeCategoryExcluded
 }
 
@@ -89,6 +456,14 @@ type NetworkResult struct {
 	CertificateSubject string            `json:"certificate_subject,omitempty"` // 证书主题
 }
 
+// FinalPort 最终URL的端口，URL未指定端口时为默认端口
+func (n *NetworkResult) FinalPort() string {
+	if parsed, err := url.Parse(n.URL); err == nil && parsed.Port() != "" {
+		return parsed.Port()
+	}
+	return DefaultPort
+}
+
 // TLSResult TLS检测结果
 type TLSResult struct {
 	ProtocolVersion string        `json:"protocol_version"`
@@ -97,6 +472,72 @@ type TLSResult struct {
 	SupportsHTTP2   bool          `json:"supports_http2"`
 	CipherSuite     string        `json:"cipher_suite"`
 	HandshakeTime   time.Duration `json:"handshake_time"`
+	// HandshakeSamples 各次成功握手的耗时，用于计算抖动
+	HandshakeSamples []time.Duration `json:"handshake_samples,omitempty"`
+	// LocalAddress 握手连接实际使用的本地地址（经代理时为连接代理的本地地址）
+	LocalAddress string `json:"local_address,omitempty"`
+	IPVersion    int    `json:"ip_version,omitempty"` // 握手连接的目标地址族，4或6
+	// Latency 多次采样的延迟测量，握手失败时为空
+	Latency *LatencyResult `json:"latency,omitempty"`
+}
+
+// Handshake 用于评分、策略和报告的握手时间
+// 有延迟采样时为TLS握手耗时的中位数（不含DNS和TCP连接），否则为单次握手的总耗时
+func (t *TLSResult) Handshake() time.Duration {
+	if t.Latency != nil && t.Latency.Handshake.Median > 0 {
+		return t.Latency.Handshake.Median
+	}
+	return t.HandshakeTime
+}
+
+// LatencyResult 多次采样的延迟测量结果，TCP连接、TLS握手和首字节时间分别统计
+type LatencyResult struct {
+	Samples   int          `json:"samples"`   // 成功的采样次数
+	Attempts  int          `json:"attempts"`  // 采样次数，包括失败的采样
+	TCP       LatencyStats `json:"tcp"`       // TCP连接RTT
+	Handshake LatencyStats `json:"handshake"` // TLS握手，不含TCP连接
+	TTFB      LatencyStats `json:"ttfb"`      // 发出HTTP请求到收到响应首字节
+}
+
+// LatencyStats 一组延迟样本的统计
+type LatencyStats struct {
+	Samples []time.Duration `json:"samples,omitempty"`
+	Min     time.Duration   `json:"min"`
+	Median  time.Duration   `json:"median"`
+	P95     time.Duration   `json:"p95"`
+	Jitter  time.Duration   `json:"jitter"` // 相邻两次采样之差的平均值
+}
+
+// NewLatencyStats 按采样顺序的样本计算统计值，没有样本时各项为0
+func NewLatencyStats(samples []time.Duration) LatencyStats {
+	stats := LatencyStats{Samples: samples}
+	if len(samples) == 0 {
+		return stats
+	}
+
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	stats.Min = sorted[0]
+	if n := len(sorted); n%2 == 1 {
+		stats.Median = sorted[n/2]
+	} else {
+		stats.Median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	// 最近秩法：不小于95%样本的最小样本
+	stats.P95 = sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]
+
+	if len(samples) > 1 {
+		var total time.Duration
+		for i := 1; i < len(samples); i++ {
+			diff := samples[i] - samples[i-1]
+			if diff < 0 {
+				diff = -diff
+			}
+			total += diff
+		}
+		stats.Jitter = total / time.Duration(len(samples)-1)
+	}
+	return stats
 }
 
 // CertificateResult 证书检测结果
@@ -125,7 +566,7 @@ type CDNResult struct {
 	Confidence   string `json:"confidence"`
 	Evidence     string `json:"evidence"`
 	IsHotWebsite bool   `json:"is_hot_website"`
-	Error        error  `json:"error,omitempty"`
+	Error        error  `json:"-"`
 }
 
 // BlockedResult 被墙检测结果
@@ -145,13 +586,56 @@ type PageStatusResult struct {
 
 // LocationResult 地理位置检测结果
 type LocationResult struct {
-	Country    string `json:"country"`
-	IsDomestic bool   `json:"is_domestic"`
-	IPAddress  string `json:"ip_address"`
-	ISP        string `json:"isp"`
-	ASN        string `json:"asn"`
-	City       string `json:"city"`
-	Region     string `json:"region"`
+	Country     string `json:"country"`
+	CountryCode string `json:"country_code,omitempty"`
+	IsDomestic  bool   `json:"is_domestic"`
+	IPAddress   string `json:"ip_address"`
+	ISP         string `json:"isp"`
+	ASN         string `json:"asn"`
+	City        string `json:"city"`
+	Region      string `json:"region"`
+	IPVersion   int    `json:"ip_version,omitempty"` // IPAddress 的地址族，4或6
+}
+
+// AddressResult 多地址模式下单个地址的检测结果
+// 每个地址独立完成TLS和证书检测，SNI均为域名
+type AddressResult struct {
+	IP          string             `json:"ip"`
+	Primary     bool               `json:"primary,omitempty"` // 是否为流水线其他阶段使用的地址
+	Network     *NetworkResult     `json:"network,omitempty"` // 经该地址请求的可达性和状态码，双栈模式的IPv6地址检测
+	Location    *LocationResult    `json:"location,omitempty"`
+	TLS         *TLSResult         `json:"tls,omitempty"`
+	Certificate *CertificateResult `json:"certificate,omitempty"`
+	SNI         *SNIResult         `json:"sni,omitempty"`
+	Error       string             `json:"error,omitempty"`   // 连接或握手失败的原因
+	Passed      bool               `json:"passed"`            // 是否通过策略中针对单个地址的规则
+	Verdict     *Verdict           `json:"verdict,omitempty"` // 未通过的结论
+}
+
+// FamilyResult 双栈模式下单个地址族的结论
+type FamilyResult struct {
+	Family  string   `json:"family"` // IPv4 或 IPv6
+	IP      string   `json:"ip,omitempty"`
+	Passed  bool     `json:"passed"`
+	Verdict *Verdict `json:"verdict,omitempty"`
+}
+
+// ScoreResult 推荐评分结果
+type ScoreResult struct {
+	Total   float64       `json:"total"` // 0-100分
+	Stars   int           `json:"stars"` // 0-5星
+	Factors []ScoreFactor `json:"factors"`
+}
+
+// ScoreFactor 评分因子及其贡献
+type ScoreFactor struct {
+	Name         string  `json:"name"`
+	Description  string  `json:"description"`
+	Weight       float64 `json:"weight"`
+	Available    bool    `json:"available"` // 缺少数据的因子不计入总分
+	Passed       bool    `json:"passed"`
+	Observed     string  `json:"observed,omitempty"`
+	Contribution float64 `json:"contribution"` // 对总分的贡献（分）
 }
 
 // DetectionSummary 检测摘要
@@ -176,6 +660,19 @@ type BatchReport struct {
 	TLSStats         *TLSStats          `json:"tls_stats"`
 	CertificateStats *CertificateStats  `json:"certificate_stats"`
 	Summary          *BatchSummary      `json:"summary"`
+	Concurrency      *ConcurrencyStats  `json:"concurrency,omitempty"` // 实际使用的并发数
+}
+
+// ConcurrencyStats 批量检测实际使用的并发数
+type ConcurrencyStats struct {
+	Adaptive    bool    `json:"adaptive"`    // 是否自适应调整并发数
+	Initial     int     `json:"initial"`     // 初始并发上限
+	Final       int     `json:"final"`       // 结束时的并发上限
+	Lowest      int     `json:"lowest"`      // 并发上限的最小值
+	Highest     int     `json:"highest"`     // 并发上限的最大值
+	Peak        int     `json:"peak"`        // 同时进行的检测数的峰值
+	Average     float64 `json:"average"`     // 同时进行的检测数按时间的平均值
+	Adjustments int     `json:"adjustments"` // 调整并发上限的次数
 }
 
 // Statistics 统计信息
@@ -186,6 +683,11 @@ type Statistics struct {
 	SuitableDomains  int `json:"suitable_domains"`
 	BlockedDomains   int `json:"blocked_domains"`
 	ErrorDomains     int `json:"error_domains"`
+	CachedResults    int `json:"cached_results"`
+	TimedOutDomains  int `json:"timed_out_domains"` // 检测超时的域名数
+	SkippedDomains   int `json:"skipped_domains"`   // 时间预算用完时尚未开始检测的域名数
+	ResumedResults   int `json:"resumed_results"`   // 从检查点文件恢复的结果数
+	CanceledDomains  int `json:"canceled_domains"`  // 中断时未开始或被取消的域名数
 }
 
 // PerformanceStats 性能统计
@@ -238,27 +740,105 @@ type BatchSummary struct {
 	Warnings        []string `json:"warnings"`
 }
 
+// Artifact 检测阶段之间传递的数据
+type Artifact string
+
+// Artifact 常量
+const (
+	ArtifactBlocked        Artifact = "blocked"         // 被墙检测结论
+	ArtifactFinalDomain    Artifact = "final_domain"    // 重定向后的最终域名
+	ArtifactHTTPStatus     Artifact = "http_status"     // HTTP状态码及可达性
+	ArtifactHeaders        Artifact = "headers"         // HTTP响应头
+	ArtifactStatusCategory Artifact = "status_category" // 状态码分类
+	ArtifactResolvedIP     Artifact = "resolved_ip"     // 解析得到的IP
+	ArtifactLocation       Artifact = "location"        // 地理位置
+	ArtifactTLS            Artifact = "tls"             // TLS握手结果
+	ArtifactCertificate    Artifact = "certificate"     // 证书信息
+	ArtifactCDN            Artifact = "cdn"             // CDN检测结论
+	ArtifactHotWebsite     Artifact = "hot_website"     // 热门网站标记
+	ArtifactAddresses      Artifact = "addresses"       // 各地址的检测结果
+	ArtifactIPv6           Artifact = "ipv6"            // 双栈模式下IPv6地址的检测结果
+)
+
 // DetectionStage 检测阶段接口
+// 每个阶段声明自己产出和依赖的数据，流水线据此构建依赖图并调度
+// Execute 中 ctx.Result 是上游阶段结果的只读快照，阶段只通过返回的部分结果输出数据，
+// 需要终止流水线时在部分结果中设置 EarlyExit
 type DetectionStage interface {
-	Execute(ctx *PipelineContext) error
-	CanEarlyExit() bool
-	Priority() int
+	Execute(ctx *PipelineContext) (*DetectionResult, error)
+	CanEarlyExit() bool // 出错或标记早期退出时是否终止后续阶段
+	Priority() int      // 仅用于同层阶段的稳定排序
 	Name() string
+	Produces() []Artifact
+	Consumes() []Artifact
 }
 
 // PipelineContext 流水线上下文
 type PipelineContext struct {
 	Domain      string
+	Port        string // 检测的端口，为空时使用 DefaultPort
+	ConnectIP   string // 指定的连接地址，为空时解析域名
 	StartTime   time.Time
 	Result      *DetectionResult
 	Connections interface{} // 使用interface{}来支持不同的连接管理器类型
-	Cache       interface{} // 使用interface{}来支持不同的缓存管理器类型
+	Resolver    Resolver    // DNS解析器，为nil时使用系统解析器
+	DNSCache    *DNSCache   // 本次检测的DNS记录集，每个域名只解析一次
 	Config      *Config
-	EarlyExit   bool
 	Error       error
 	Context     context.Context // 添加Context字段
 }
 
+// Resolver DNS解析接口，*net.Resolver 也满足该接口
+type Resolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupNS(ctx context.Context, host string) ([]*net.NS, error)
+}
+
+// DNS 返回阶段应使用的DNS解析器
+func (ctx *PipelineContext) DNS() Resolver {
+	if ctx.Resolver == nil {
+		return net.DefaultResolver
+	}
+	return ctx.Resolver
+}
+
+// FinalDomain 返回重定向后的最终域名，未重定向时返回原始域名
+// 指定连接地址时始终返回原始域名，TLS检测针对该地址和域名
+func (ctx *PipelineContext) FinalDomain() string {
+	if ctx.ConnectIP == "" && ctx.Result != nil && ctx.Result.Network != nil && ctx.Result.Network.FinalDomain != "" {
+		return ctx.Result.Network.FinalDomain
+	}
+	return ctx.Domain
+}
+
+// FinalPort 返回TLS检测应连接的端口：重定向到其他域名时为最终URL的端口，否则为目标端口
+func (ctx *PipelineContext) FinalPort() string {
+	if ctx.ConnectIP == "" && ctx.Result != nil && ctx.Result.Network != nil && ctx.Result.Network.IsRedirected {
+		return ctx.Result.Network.FinalPort()
+	}
+	if ctx.Port == "" {
+		return DefaultPort
+	}
+	return ctx.Port
+}
+
+// ResolvedIP 返回上游阶段解析并定位的IP地址，尚未解析时返回空
+func (ctx *PipelineContext) ResolvedIP() string {
+	if ctx.Result != nil && ctx.Result.Location != nil {
+		return ctx.Result.Location.IPAddress
+	}
+	return ""
+}
+
+// IPVersion 返回配置的地址族选项
+func (ctx *PipelineContext) IPVersion() string {
+	if ctx.Config == nil {
+		return IPVersionAuto
+	}
+	return ctx.Config.Network.IPVersion
+}
+
 // ConnectionManager 连接管理器
 type ConnectionManager struct {
 	HTTPClient  *HTTPClient
@@ -291,29 +871,99 @@ type DNSResolver struct {
 	TTL   time.Duration
 }
 
-// DNSEntry DNS条目
+// DNSEntry DNS条目，一个域名的完整记录集
 type DNSEntry struct {
-	IP        string
-	Timestamp time.Time
-	TTL       time.Duration
+	IP         string   // 选定的连接地址（优先IPv4），各阶段和后续连接都使用该地址
+	A          []string // A记录
+	AAAA       []string // AAAA记录
+	CNAMEChain []string // CNAME链，从查询的域名开始到规范名称结束，没有CNAME时为空
+	NS         []string // NS记录
+	Err        error    // 地址解析失败的原因，CNAME和NS查询失败不影响条目
+	Timestamp  time.Time
+	TTL        time.Duration
+}
+
+// Expired 条目是否过期，TTL为0时不过期
+func (e *DNSEntry) Expired(now time.Time) bool {
+	return e.TTL > 0 && now.Sub(e.Timestamp) > e.TTL
 }
 
 // DNSCache DNS缓存
+// 同一域名的并发查询只解析一次，其余调用等待第一次解析的结果
 type DNSCache struct {
 	Cache map[string]*DNSEntry
 	TTL   time.Duration
+
+	mu      sync.Mutex
+	pending map[string]chan struct{}
+}
+
+// NewDNSCache 创建DNS缓存，ttl为0时条目在缓存的生命周期内一直有效
+func NewDNSCache(ttl time.Duration) *DNSCache {
+	return &DNSCache{
+		Cache:   make(map[string]*DNSEntry),
+		TTL:     ttl,
+		pending: make(map[string]chan struct{}),
+	}
+}
+
+// Get 返回未过期的条目
+func (c *DNSCache) Get(host string) (*DNSEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.Cache[strings.ToLower(host)]
+	if !ok || entry.Expired(time.Now()) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// Resolve 返回域名的条目，缓存中没有时调用 resolve 解析
+// 因context取消或超时失败的条目不写入缓存，后续调用会重新解析
+func (c *DNSCache) Resolve(host string, resolve func() *DNSEntry) *DNSEntry {
+	key := strings.ToLower(host)
+	for {
+		c.mu.Lock()
+		if entry, ok := c.Cache[key]; ok && !entry.Expired(time.Now()) {
+			c.mu.Unlock()
+			return entry
+		}
+		wait, busy := c.pending[key]
+		if !busy {
+			break
+		}
+		c.mu.Unlock()
+		<-wait
+	}
+
+	done := make(chan struct{})
+	c.pending[key] = done
+	c.mu.Unlock()
+
+	entry := resolve()
+	entry.Timestamp = time.Now()
+	entry.TTL = c.TTL
+
+	c.mu.Lock()
+	if !errors.Is(entry.Err, context.Canceled) && !errors.Is(entry.Err, context.DeadlineExceeded) {
+		c.Cache[key] = entry
+	}
+	delete(c.pending, key)
+	c.mu.Unlock()
+	close(done)
+	return entry
 }
 
-// ResultCache 结果缓存
+// ResultCache 结果缓存，键为域名加配置摘要
 type ResultCache struct {
-	Cache map[string]*CachedResult
-	TTL   time.Duration
+	Cache map[string]*CachedResult `json:"entries"`
+	TTL   time.Duration            `json:"-"`
 }
 
 // CachedResult 缓存结果
 type CachedResult struct {
-	Result    *DetectionResult
-	Timestamp time.Time
+	Result    *DetectionResult `json:"result"`
+	Timestamp time.Time        `json:"timestamp"`
 }
 
 // CDNCache CDN缓存
@@ -339,6 +989,16 @@ type Config struct {
 	Output      OutputConfig      `yaml:"output"`
 	Cache       CacheConfig       `yaml:"cache"`
 	Batch       BatchConfig       `yaml:"batch"`
+	Policy      PolicyConfig      `yaml:"policy"`
+	Scoring     ScoringConfig     `yaml:"scoring"`
+}
+
+// PolicyFor 获取适用于指定域名的策略，配置为空时返回默认策略
+func (c *Config) PolicyFor(domain string) PolicyConfig {
+	if c == nil {
+		return PolicyConfig{}
+	}
+	return c.Policy.ForDomain(domain)
 }
 
 // NetworkConfig 网络配置
@@ -346,20 +1006,54 @@ type NetworkConfig struct {
 	Timeout    time.Duration `yaml:"timeout"`
 	Retries    int           `yaml:"retries"`
 	DNSServers []string      `yaml:"dns_servers"`
+	Proxy      string        `yaml:"proxy"` // 上游代理，socks5://host:port 或 http://host:port，为空时直接连接
+	// SourceAddress 和 Interface 指定探测使用的本地地址，二者只能设置一个
+	SourceAddress string `yaml:"source_address"` // 本地源IP
+	Interface     string `yaml:"interface"`      // 本地网卡，按目标地址族使用网卡上的IPv4或IPv6地址
+	// AllAddresses 对域名的每个A/AAAA记录分别进行TLS和证书检测，而不只检测选定的地址
+	AllAddresses bool `yaml:"all_addresses"`
+	// IPVersion 检测使用的地址族：4、6 或 both，为空时优先IPv4，没有IPv4地址时使用IPv6
+	IPVersion string `yaml:"ip_version"`
+	// LatencySamples 握手成功后测量延迟的采样次数，每次采样使用新连接
+	LatencySamples int `yaml:"latency_samples"`
+	// RateLimit 连接限速，所有阶段的拨号器共用
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+}
+
+// RateLimitConfig 连接限速配置，各项为0或负数时不限制
+// 只限制探测目标的连接，不限制DNS查询
+type RateLimitConfig struct {
+	ConnectionsPerSecond float64 `yaml:"connections_per_second"` // 全局每秒新建的连接数
+	PerIP                int     `yaml:"per_ip"`                 // 每个目标IP同时打开的连接数
+	PerSubnet            int     `yaml:"per_subnet"`             // 每个目标网段（IPv4 /24，IPv6 /48）同时打开的连接数
 }
 
+// DefaultLatencySamples 未配置时的延迟采样次数
+const DefaultLatencySamples = 3
+
+// 地址族选项
+const (
+	IPVersionAuto = ""     // 优先IPv4，没有时使用IPv6
+	IPVersion4    = "4"    // 只使用IPv4
+	IPVersion6    = "6"    // 只使用IPv6
+	IPVersionBoth = "both" // 以IPv4完成全部检测（没有IPv4地址时以IPv6），另外单独检测IPv6
+)
+
 // ConcurrencyConfig 并发配置
 type ConcurrencyConfig struct {
-	MaxConcurrent int           `yaml:"max_concurrent"`
-	CheckTimeout  time.Duration `yaml:"check_timeout"`
+	MaxConcurrent int           `yaml:"max_concurrent"` // 并发检测数的上限
+	Fixed         bool          `yaml:"fixed"`          // 固定使用 MaxConcurrent 个并发，不自适应调整
+	CheckTimeout  time.Duration `yaml:"check_timeout"`  // 批量检测中单个域名的时限
+	StageTimeout  time.Duration `yaml:"stage_timeout"`  // 单个检测阶段的时限
 	CacheTTL      time.Duration `yaml:"cache_ttl"`
 }
 
 // OutputConfig 输出配置
 type OutputConfig struct {
-	Color   bool   `yaml:"color"`
-	Verbose bool   `yaml:"verbose"`
-	Format  string `yaml:"format"`
+	Color    bool   `yaml:"color"`
+	Verbose  bool   `yaml:"verbose"`
+	Format   string `yaml:"format"`
+	JSONFile string `yaml:"json_file"` // 批量报告JSON导出路径，为空时不导出
 }
 
 // CacheConfig 缓存配置
@@ -368,6 +1062,18 @@ type CacheConfig struct {
 	ResultEnabled bool          `yaml:"result_enabled"`
 	TTL           time.Duration `yaml:"ttl"`
 	MaxSize       int           `yaml:"max_size"`
+	Path          string        `yaml:"path"` // 结果缓存文件
+}
+
+// ScoringConfig 推荐评分配置
+type ScoringConfig struct {
+	Weights          map[string]float64 `yaml:"weights"`           // 因子权重，0为不参与评分
+	MaxHandshake     time.Duration      `yaml:"max_handshake"`     // 握手时间阈值
+	MinCertDays      int                `yaml:"min_cert_days"`     // 证书剩余天数阈值
+	MaxJitter        time.Duration      `yaml:"max_jitter"`        // 握手抖动阈值
+	MaxRedirects     int                `yaml:"max_redirects"`     // 重定向次数上限
+	PreferredIssuers []string           `yaml:"preferred_issuers"` // 偏好的证书签发者（包含匹配）
+	VPSASN           string             `yaml:"vps_asn"`           // VPS所在ASN，如 AS13335
 }
 
 // BatchConfig 批量配置
@@ -375,7 +1081,7 @@ type BatchConfig struct {
 	StreamOutput bool          `yaml:"stream_output"`
 	ProgressBar  bool          `yaml:"progress_bar"`
 	ReportFormat string        `yaml:"report_format"`
-	Timeout      time.Duration `yaml:"timeout"`
+	Timeout      time.Duration `yaml:"timeout"` // 整个批量检测的时间预算，0为不限制
 }
 
 // ConnectionStats 连接统计
@@ -392,3 +1098,174 @@ type CacheStats struct {
 	CDNCacheSize    int     `json:"cdn_cache_size"`
 	HitRate         float64 `json:"hit_rate"`
 }
+
+// 策略规则名称
+const (
+	RuleNotBlocked  = "not_blocked"  // 未被墙
+	RuleNotDomestic = "not_domestic" // 非国内网站
+	RuleReachable   = "reachable"    // 网络可达且完成TLS检测
+	RuleStatusCode  = "status_code"  // 状态码可接受
+	RuleTLS13       = "tls13"        // 支持TLS 1.3
+	RuleX25519      = "x25519"       // 支持X25519
+	RuleH2          = "h2"           // 支持HTTP/2
+	RuleCertValid   = "cert_valid"   // 证书有效
+	RuleCertExpiry  = "cert_expiry"  // 证书剩余天数充足
+	RuleSNIMatch    = "sni_match"    // SNI匹配
+	RuleHandshake   = "handshake"    // 握手时间不超过阈值
+	RuleAddresses   = "addresses"    // 多地址模式下通过检测的地址比例足够
+	RuleIPv6        = "ipv6"         // 双栈模式下IPv6地址也适合
+)
+
+// DefaultPolicyRules 默认必须满足的规则，按评估顺序排列
+var DefaultPolicyRules = []string{
+	RuleNotBlocked,
+	RuleNotDomestic,
+	RuleReachable,
+	RuleStatusCode,
+	RuleTLS13,
+	RuleX25519,
+	RuleH2,
+	RuleCertValid,
+	RuleCertExpiry,
+	RuleSNIMatch,
+	RuleAddresses,
+	RuleIPv6,
+}
+
+// DefaultDomesticCountries 默认视为国内的国家
+var DefaultDomesticCountries = []string{"CN"}
+
+// PolicyConfig 适合性策略配置
+// 字段为空时使用默认值，因此零值即为默认策略
+type PolicyConfig struct {
+	File               string           `yaml:"file"`                 // 独立策略文件，内容与本节相同
+	Rules              []string         `yaml:"rules"`                // 必须满足的规则，按顺序评估
+	AllowedStatusCodes []int            `yaml:"allowed_status_codes"` // 可接受的状态码
+	DomesticCountries  []string         `yaml:"domestic_countries"`   // 视为国内的国家（ISO代码或名称）
+	MinCertDays        int              `yaml:"min_cert_days"`        // 证书最少剩余天数
+	MaxHandshake       time.Duration    `yaml:"max_handshake"`        // 最大握手时间，0为不限制
+	MinAddressRatio    float64          `yaml:"min_address_ratio"`    // 多地址模式下至少通过的地址比例，0为全部
+	Overrides          []PolicyOverride `yaml:"overrides"`            // 针对部分目标的覆盖
+}
+
+// PolicyOverride 针对部分目标的策略覆盖，非空字段覆盖基础策略
+type PolicyOverride struct {
+	Match              []string      `yaml:"match"` // 域名匹配，支持 *.example.com
+	Rules              []string      `yaml:"rules"`
+	AllowedStatusCodes []int         `yaml:"allowed_status_codes"`
+	DomesticCountries  []string      `yaml:"domestic_countries"`
+	MinCertDays        int           `yaml:"min_cert_days"`
+	MaxHandshake       time.Duration `yaml:"max_handshake"`
+	MinAddressRatio    float64       `yaml:"min_address_ratio"`
+}
+
+// ForDomain 返回应用了匹配覆盖后的策略（只应用第一个匹配的覆盖）
+func (p PolicyConfig) ForDomain(domain string) PolicyConfig {
+	resolved := p
+	resolved.Overrides = nil
+	for _, override := range p.Overrides {
+		if !matchDomainPatterns(domain, override.Match) {
+			continue
+		}
+		if len(override.Rules) > 0 {
+			resolved.Rules = override.Rules
+		}
+		if len(override.AllowedStatusCodes) > 0 {
+			resolved.AllowedStatusCodes = override.AllowedStatusCodes
+		}
+		if len(override.DomesticCountries) > 0 {
+			resolved.DomesticCountries = override.DomesticCountries
+		}
+		if override.MinCertDays > 0 {
+			resolved.MinCertDays = override.MinCertDays
+		}
+		if override.MaxHandshake > 0 {
+			resolved.MaxHandshake = override.MaxHandshake
+		}
+		if override.MinAddressRatio > 0 {
+			resolved.MinAddressRatio = override.MinAddressRatio
+		}
+		break
+	}
+	return resolved
+}
+
+// RuleList 返回生效的规则列表
+func (p PolicyConfig) RuleList() []string {
+	if len(p.Rules) == 0 {
+		return DefaultPolicyRules
+	}
+	return p.Rules
+}
+
+// Requires 检查策略是否要求某条规则
+func (p PolicyConfig) Requires(rule string) bool {
+	for _, r := range p.RuleList() {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassifyStatusCode 按策略分类状态码
+func (p PolicyConfig) ClassifyStatusCode(statusCode int, accessible bool) string {
+	safeCodes := p.AllowedStatusCodes
+	if len(safeCodes) == 0 {
+		safeCodes = DefaultSafeStatusCodes
+	}
+	return ClassifyStatusCodeWith(statusCode, accessible, safeCodes)
+}
+
+// IsDomesticCountry 按策略判断国家是否视为国内
+func (p PolicyConfig) IsDomesticCountry(countryCode, countryName string) bool {
+	countries := p.DomesticCountries
+	if len(countries) == 0 {
+		countries = DefaultDomesticCountries
+	}
+	for _, country := range countries {
+		if (countryCode != "" && strings.EqualFold(country, countryCode)) ||
+			(countryName != "" && country == countryName) {
+			return true
+		}
+	}
+	return false
+}
+
+// CertDaysThreshold 证书最少剩余天数，默认只要求未过期
+func (p PolicyConfig) CertDaysThreshold() int {
+	if p.MinCertDays <= 0 {
+		return 1
+	}
+	return p.MinCertDays
+}
+
+// RequiredAddresses 多地址模式下至少需要通过的地址数，默认要求全部通过
+func (p PolicyConfig) RequiredAddresses(total int) int {
+	if p.MinAddressRatio <= 0 || p.MinAddressRatio >= 1 {
+		return total
+	}
+	// 减去极小值，避免 0.7*10 这类浮点误差多要求一个地址
+	required := int(math.Ceil(p.MinAddressRatio*float64(total) - 1e-9))
+	if required < 1 {
+		return 1
+	}
+	return required
+}
+
+// matchDomainPatterns 检查域名是否匹配任一模式
+func matchDomainPatterns(domain string, patterns []string) bool {
+	domain = strings.ToLower(domain)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if strings.HasPrefix(pattern, "*.") {
+			base := pattern[2:]
+			if domain == base || strings.HasSuffix(domain, "."+base) {
+				return true
+			}
+		} else if domain == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -21,13 +21,31 @@ func PrintUsage() {
 	fmt.Printf("Reality协议目标网站检测器 %s\n\n", version.GetVersion())
 	fmt.Println("用法:")
 	fmt.Println("  reality-checker check <domain>          检测单个域名")
+	fmt.Println("  reality-checker explain <domain>        检测单个域名并说明每个阶段、规则和评分因子")
 	fmt.Println("  reality-checker batch <domain1> <domain2> <domain3> ...  批量检测域名")
 	fmt.Println("  reality-checker csv <csv_file>          从CSV文件批量检测域名")
+	fmt.Println("  reality-checker stream <file|->         流式检测文件或标准输入中的目标列表（支持CSV）")
+	fmt.Println("")
+	fmt.Println("选项:")
+	fmt.Println("  --no-cache                              不读也不写结果缓存")
+	fmt.Println("  --refresh                               忽略已有缓存重新检测，并刷新缓存")
+	fmt.Println("  --source <IP|网卡>                      从指定的本地地址或网卡发起探测")
+	fmt.Println("  --all-ips                               分别检测域名的每个A/AAAA地址")
+	fmt.Println("  --ip-version <4|6|both>                 只用IPv4或IPv6检测，或分别给出两者的结论")
+	fmt.Println("  --samples <N>                           延迟采样次数（默认3次），握手时间取中位数")
+	fmt.Println("  --output <file.jsonl>                   stream 命令逐个写入检测结果的文件（JSON Lines）")
+	fmt.Println("  --budget <时长>                         批量检测的总时间预算，如 30m，用完后未开始的域名不再检测")
+	fmt.Println("  --journal <file>                        batch/csv 将每个完成的检测写入检查点文件")
+	fmt.Println("  --resume <file>                         从检查点文件恢复，跳过已完成的目标并继续写入")
 	fmt.Println("")
 	fmt.Println("示例:")
 	fmt.Println("  reality-checker check apple.com")
+	fmt.Println("  reality-checker check 1.2.3.4@apple.com")
+	fmt.Println("  reality-checker explain apple.com")
 	fmt.Println("  reality-checker batch apple.com tesla.com microsoft.com")
-	fmt.Println("  reality-checker csv file.csv")
+	fmt.Println("  reality-checker csv file.csv --refresh")
+	fmt.Println("  reality-checker csv file.csv --journal scan.journal")
+	fmt.Println("  reality-checker stream domains.txt --output results.jsonl")
 }
 
 // PrintTimestampedMessage 打印带时间戳的消息